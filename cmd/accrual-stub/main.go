@@ -0,0 +1,63 @@
+// accrual-stub - поддельная система расчета баллов для локального запуска
+// gophermart без бинарника accrual. Каждый заказ проходит статусы
+// REGISTERED -> PROCESSING -> PROCESSED с начислением -accrual
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual/accrualtest"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/caarlos0/env/v6"
+)
+
+type config struct {
+	RunAddress  string        `env:"RUN_ADDRESS"          envDefault:"localhost:8081"`
+	Accrual     string        `env:"STUB_ACCRUAL"         envDefault:"500"`
+	Latency     time.Duration `env:"STUB_LATENCY"         envDefault:"0s"`
+	RateLimit   int           `env:"STUB_RATE_LIMIT"      envDefault:"0"`
+	FailureRate float64       `env:"STUB_FAILURE_RATE"    envDefault:"0"`
+	// сколько раз заказ отвечает PROCESSING перед PROCESSED
+	ProcessingSteps int `env:"STUB_PROCESSING_STEPS" envDefault:"1"`
+}
+
+func init() {
+	log.SetOutput(os.Stdout)
+}
+
+func main() {
+	cfg := config{}
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	flag.StringVar(&cfg.RunAddress, "a", cfg.RunAddress, "адрес и порт запуска сервиса")
+	flag.StringVar(&cfg.Accrual, "accrual", cfg.Accrual, "начисление за обработанный заказ")
+	flag.DurationVar(&cfg.Latency, "latency", cfg.Latency, "задержка каждого ответа")
+	flag.IntVar(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "запросов в минуту до ответа 429; 0 - без ограничений")
+	flag.Float64Var(&cfg.FailureRate, "failure-rate", cfg.FailureRate, "доля запросов, на которые отвечаем 500")
+	flag.IntVar(&cfg.ProcessingSteps, "processing-steps", cfg.ProcessingSteps, "сколько раз заказ отвечает PROCESSING")
+	flag.Parse()
+
+	accrual, err := money.Parse(cfg.Accrual)
+	if err != nil {
+		log.Fatalf("Bad accrual %q: %v", cfg.Accrual, err)
+	}
+	steps := []accrualtest.Step{accrualtest.Registered()}
+	for i := 0; i < cfg.ProcessingSteps; i++ {
+		steps = append(steps, accrualtest.Processing())
+	}
+	steps = append(steps, accrualtest.Processed(accrual))
+
+	fake := accrualtest.NewFake()
+	fake.SetDefault(steps...)
+	fake.SetLatency(cfg.Latency)
+	fake.SetRateLimit(cfg.RateLimit)
+	fake.SetFailureRate(cfg.FailureRate)
+
+	log.Printf("Starting accrual stub with config %+v\n", cfg)
+	log.Fatal(http.ListenAndServe(cfg.RunAddress, fake))
+}
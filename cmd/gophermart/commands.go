@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/server/config"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+var errCommandNeedsPostgres = errors.New("command requires postgres storage")
+
+type command func(ctx context.Context, db *database.DatabaseService, args []string) error
+
+var commands = map[string]command{
+	"migrate":   migrateCommand,
+	"queue":     queueCommand,
+	"reconcile": reconcileCommand,
+}
+
+func runCommand(cfg *config.Config, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: %v", errUnknownCommand, args[0])
+	}
+	// служебные команды работают с данными, которые переживают перезапуск
+	if cfg.DatabaseBackend != config.BackendPostgres {
+		return fmt.Errorf("%w: %v storage", errCommandNeedsPostgres, cfg.DatabaseBackend)
+	}
+	ctx := context.Background()
+	db, err := database.NewDatabaseService(cfg, ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return cmd(ctx, db, args[1:])
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 
@@ -20,5 +21,13 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// аргументы после флагов - служебная команда, например
+	// gophermart -d postgres://... queue dead
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	server.RunServer(cfg)
 }
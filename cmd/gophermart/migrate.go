@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/migration"
+)
+
+// migrateCommand - управление схемой БД:
+//
+//	gophermart migrate up              накатить все недостающие миграции
+//	gophermart migrate down [N]        откатить N последних миграций (по умолчанию 1)
+//	gophermart migrate status          список миграций и их состояние
+//	gophermart migrate version         текущая версия схемы
+//	gophermart migrate force <version> записать версию, не выполняя миграций
+func migrateCommand(ctx context.Context, db *database.DatabaseService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: migrate up|down [N]|status|version|force <version>", errUnknownCommand)
+	}
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+		return printVersion(ctx, migrator)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("bad number of steps: %v", args[1])
+			}
+		}
+		if err := migrator.Down(ctx, steps); err != nil {
+			return err
+		}
+		return printVersion(ctx, migrator)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE")
+		for _, m := range status.Applied {
+			state := "applied"
+			if status.Dirty && m.Version == status.Version {
+				state = "dirty"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", m.Version, m.Name, state)
+		}
+		for _, m := range status.Pending {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", m.Version, m.Name, "pending")
+		}
+		if status.Version > status.Latest {
+			fmt.Fprintf(w, "%v\t?\t%v\n", status.Version, "unknown, newer than this binary")
+		}
+		return w.Flush()
+	case "version":
+		return printVersion(ctx, migrator)
+	case "force":
+		if len(args) < 2 {
+			return fmt.Errorf("%w: migrate force <version>", errUnknownCommand)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("bad version: %v", args[1])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		return printVersion(ctx, migrator)
+	default:
+		return fmt.Errorf("%w: migrate %v", errUnknownCommand, args[0])
+	}
+}
+
+func printVersion(ctx context.Context, migrator *migration.Migrator) error {
+	version, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		fmt.Printf("%v (dirty)\n", version)
+		return nil
+	}
+	fmt.Println(version)
+	return nil
+}
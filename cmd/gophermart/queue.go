@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+)
+
+// queueCommand - работа с dead letter очереди заказов:
+//
+//	gophermart queue dead                  список заказов, которые перестали опрашивать
+//	gophermart queue requeue <orderID>...  вернуть заказы в работу
+func queueCommand(ctx context.Context, db *database.DatabaseService, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: queue dead|requeue <orderID>...", errUnknownCommand)
+	}
+	tracker := db.Tracker()
+	switch args[0] {
+	case "dead":
+		tasks, err := tracker.ListDead(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tSTATUS\tATTEMPTS\tCREATED\tDEAD")
+		for _, t := range tasks {
+			fmt.Fprintf(
+				w,
+				"%v\t%v\t%v\t%v\t%v\n",
+				t.OrderID,
+				t.StatusID,
+				t.Attempts,
+				t.CreatedAt.Format(time.RFC3339),
+				t.DeadAt.Format(time.RFC3339),
+			)
+		}
+		return w.Flush()
+	case "requeue":
+		for _, orderID := range args[1:] {
+			if err := tracker.Requeue(ctx, orderID); err != nil {
+				return err
+			}
+			fmt.Printf("requeued %v\n", orderID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: queue %v", errUnknownCommand, args[0])
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+)
+
+var errBalanceDrift = errors.New("balances differ from the ledger")
+
+// reconcileCommand сверяет UserBalance с журналом операций:
+//
+//	gophermart reconcile        только отчет; ошибка, если есть расхождения
+//	gophermart reconcile fix    отчет и исправление балансов по журналу
+func reconcileCommand(ctx context.Context, db *database.DatabaseService, args []string) error {
+	fix := len(args) > 0 && args[0] == "fix"
+	drifts, err := db.Reconcile(ctx, fix)
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		fmt.Println("balances match the ledger")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tSTORED CURRENT\tLEDGER CURRENT\tSTORED WITHDRAWN\tLEDGER WITHDRAWN")
+	for _, d := range drifts {
+		fmt.Fprintf(
+			w,
+			"%v\t%v\t%v\t%v\t%v\n",
+			d.UserID,
+			d.Stored.Current,
+			d.Actual.Current,
+			d.Stored.Withdrawn,
+			d.Actual.Withdrawn,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if fix {
+		fmt.Printf("fixed %v balances\n", len(drifts))
+		return nil
+	}
+	return fmt.Errorf("%w: %v users", errBalanceDrift, len(drifts))
+}
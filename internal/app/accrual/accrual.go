@@ -1,35 +1,188 @@
 package accrual
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 	"github.com/go-resty/resty/v2"
 )
 
+// DefaultRetryAfter - пауза после 429, если система расчета не прислала
+// корректный заголовок Retry-After
+const DefaultRetryAfter = time.Minute
+
+type Config struct {
+	// адрес системы расчета начислений
+	Address string
+	// ограничение на один запрос, включая чтение ответа
+	Timeout time.Duration
+	// сколько запросов в секунду отправляет весь процесс; 0 - пока система
+	// расчета не сообщит свой лимит в ответе 429
+	RateLimit float64
+	// после скольких ошибок подряд перестаем обращаться к системе расчета
+	FailureThreshold int
+	// через сколько после этого пробуем снова
+	OpenTimeout time.Duration
+}
+
+// Health - состояние клиента для проверок работоспособности
+type Health struct {
+	Circuit     string        `json:"circuit"`
+	Failures    int           `json:"consecutive_failures"`
+	RateLimit   float64       `json:"rate_limit"`
+	Throttled   time.Duration `json:"throttled_ns"`
+	PausedUntil time.Time     `json:"paused_until"`
+}
+
+// OrderInfo - ответ системы расчета о заказе
+type OrderInfo struct {
+	Order  string
+	Status models.OrderStatus
+	// начисление, округленное до сотых; ноль, если баллы не начислены
+	Accrual money.Amount
+}
+
+type orderInfoResponse struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual json.Number `json:"accrual"`
+}
+
 type AccrualService struct {
-	client *resty.Client
+	client  *resty.Client
+	limiter *Limiter
+	breaker *Breaker
 }
 
-func NewAccrualService(accrualSystemAddr string) *AccrualService {
+func NewAccrualService(cfg Config) *AccrualService {
 	client := resty.New()
-	client.SetBaseURL(fmt.Sprintf("%v/api/orders/", accrualSystemAddr))
-	return &AccrualService{client: client}
+	client.SetBaseURL(fmt.Sprintf("%v/api/orders/", cfg.Address))
+	client.SetTimeout(cfg.Timeout)
+	return &AccrualService{
+		client:  client,
+		limiter: NewLimiter(cfg.RateLimit),
+		breaker: NewBreaker(cfg.FailureThreshold, cfg.OpenTimeout),
+	}
 }
 
-func (s *AccrualService) GetOrderInfo(orderID string) ([]byte, error) {
-	res, err := s.client.R().Get(orderID)
+// GetOrderInfo запрашивает статус заказа. Кроме сетевых ошибок возвращает
+// ErrOrderNotRegistered (204), *ErrTooManyRequests (429),
+// *ErrUnexpectedResponse (5xx и прочие коды) и ErrBadResponse. Запросы всех
+// вызывающих проходят через общий лимитер; если своей очереди не дождаться до
+// дедлайна ctx, запрос не отправляется и возвращается *ErrLimiterDeadline.
+// Пока система расчета недоступна, возвращает ErrCircuitOpen
+func (s *AccrualService) GetOrderInfo(ctx context.Context, orderID string) (*OrderInfo, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	info, err := s.getOrderInfo(ctx, orderID)
+	s.breaker.Done(err)
+	return info, err
+}
+
+func (s *AccrualService) getOrderInfo(ctx context.Context, orderID string) (*OrderInfo, error) {
+	res, err := s.client.R().SetContext(ctx).Get(orderID)
 	if err != nil {
 		return nil, err
 	}
 
-	if res.StatusCode() == http.StatusTooManyRequests {
-		retryAfter, err := strconv.Atoi(res.Header().Get("Retry-After"))
+	switch res.StatusCode() {
+	case http.StatusOK:
+		return ParseOrderInfo(res.Body())
+	case http.StatusNoContent:
+		return nil, fmt.Errorf("%w: %v", ErrOrderNotRegistered, orderID)
+	case http.StatusTooManyRequests:
+		// ждать будут все воркеры, а не только получивший 429
+		retryAfter := parseRetryAfter(res.Header().Get("Retry-After"), time.Now())
+		s.limiter.Pause(retryAfter)
+		s.limiter.Learn(res.String(), retryAfter)
+		return nil, &ErrTooManyRequests{RetryAfter: retryAfter}
+	default:
+		return nil, &ErrUnexpectedResponse{StatusCode: res.StatusCode(), Body: res.String()}
+	}
+}
+
+// WaitAvailable блокируется, пока система расчета просит не присылать
+// запросы (Retry-After) или считается недоступной
+func (s *AccrualService) WaitAvailable(ctx context.Context) error {
+	if err := s.limiter.WaitPause(ctx); err != nil {
+		return err
+	}
+	return s.breaker.WaitClosed(ctx)
+}
+
+// LimiterStats возвращает статистику ожидания общего лимитера
+func (s *AccrualService) LimiterStats() LimiterStats {
+	return s.limiter.Stats()
+}
+
+// Health возвращает состояние выключателя и лимитера
+func (s *AccrualService) Health() Health {
+	stats := s.limiter.Stats()
+	return Health{
+		Circuit:     s.breaker.State().String(),
+		Failures:    s.breaker.Failures(),
+		RateLimit:   stats.Rate,
+		Throttled:   stats.Throttled,
+		PausedUntil: stats.PausedUntil,
+	}
+}
+
+// ParseOrderInfo разбирает сведения о заказе в формате ответа системы
+// расчета; так же выглядят и ее уведомления. Ошибки оборачивают ErrBadResponse
+func ParseOrderInfo(body []byte) (*OrderInfo, error) {
+	resp := orderInfoResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadResponse, err)
+	}
+	status, err := models.ParseOrderStatus(resp.Status)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadResponse, err)
+	}
+	info := OrderInfo{Order: resp.Order, Status: status}
+	// система расчета может вернуть больше двух знаков - округляем до сотых
+	if resp.Accrual != "" {
+		info.Accrual, err = money.Parse(resp.Accrual.String())
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: accrual %v: %v", ErrBadResponse, resp.Accrual, err)
 		}
-		return nil, NewErrTooManyRequests(retryAfter)
+		if info.Accrual < 0 {
+			return nil, fmt.Errorf("%w: negative accrual %v", ErrBadResponse, info.Accrual)
+		}
+	}
+	return &info, nil
+}
+
+// parseRetryAfter разбирает Retry-After в обоих форматах из RFC 9110:
+// число секунд или HTTP-дата
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return DefaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return DefaultRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	at, err := http.ParseTime(header)
+	if err != nil {
+		return DefaultRetryAfter
+	}
+	// дата уже прошла - можно повторять сразу
+	if wait := at.Sub(now); wait > 0 {
+		return wait
 	}
-	return res.Body(), nil
+	return 0
 }
@@ -0,0 +1,161 @@
+package accrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService поднимает сервер, который на любой запрос отвечает handler
+func newTestService(t *testing.T, handler http.HandlerFunc) *AccrualService {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewAccrualService(Config{Address: srv.URL, Timeout: time.Second})
+}
+
+func respond(code int, body string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}
+}
+
+func TestGetOrderInfo(t *testing.T) {
+	tests := []struct {
+		body string
+		want OrderInfo
+	}{
+		{
+			`{"order":"18","status":"PROCESSED","accrual":500.5}`,
+			OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 50050},
+		},
+		{
+			`{"order":"18","status":"PROCESSED","accrual":729.98000}`,
+			OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 72998},
+		},
+		{
+			`{"order":"18","status":"PROCESSED","accrual":0.005}`,
+			OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 1},
+		},
+		{
+			`{"order":"18","status":"REGISTERED"}`,
+			OrderInfo{Order: "18", Status: models.StatusRegistered},
+		},
+		{
+			`{"order":"18","status":"INVALID"}`,
+			OrderInfo{Order: "18", Status: models.StatusInvalid},
+		},
+	}
+	for _, tt := range tests {
+		var path string
+		s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			respond(http.StatusOK, tt.body, "Content-Type", "application/json")(w, r)
+		})
+		info, err := s.GetOrderInfo(context.Background(), "18")
+		require.NoError(t, err, tt.body)
+		assert.Equal(t, tt.want, *info, tt.body)
+		assert.Equal(t, "/api/orders/18", path)
+	}
+}
+
+func TestGetOrderInfoBadResponse(t *testing.T) {
+	for _, body := range []string{
+		`<html></html>`,
+		`{"order":"18","status":"LOST"}`,
+		`{"order":"18","status":""}`,
+		`{"order":"18","status":"PROCESSED","accrual":-1}`,
+		`{"order":"18","status":"PROCESSED","accrual":"many"}`,
+	} {
+		s := newTestService(t, respond(http.StatusOK, body))
+		_, err := s.GetOrderInfo(context.Background(), "18")
+		assert.ErrorIs(t, err, ErrBadResponse, body)
+	}
+}
+
+func TestGetOrderInfoNotRegistered(t *testing.T) {
+	s := newTestService(t, respond(http.StatusNoContent, ""))
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	assert.ErrorIs(t, err, ErrOrderNotRegistered)
+}
+
+func TestGetOrderInfoTooManyRequests(t *testing.T) {
+	s := newTestService(t, respond(
+		http.StatusTooManyRequests,
+		"No more than 10 requests per minute allowed",
+		"Retry-After", "60",
+	))
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	var tmrErr *ErrTooManyRequests
+	require.ErrorAs(t, err, &tmrErr)
+	assert.Equal(t, 60*time.Second, tmrErr.RetryAfter)
+}
+
+func TestGetOrderInfoServerError(t *testing.T) {
+	s := newTestService(t, respond(http.StatusInternalServerError, "internal error"))
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	var respErr *ErrUnexpectedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusInternalServerError, respErr.StatusCode)
+	assert.True(t, respErr.Temporary())
+}
+
+func TestGetOrderInfoTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}
+
+	s := newTestService(t, slow)
+	s.client.SetTimeout(50 * time.Millisecond)
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	assert.Error(t, err)
+
+	s = newTestService(t, slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = s.GetOrderInfo(ctx, "18")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"120", 2 * time.Minute},
+		{" 0 ", 0},
+		{"Wed, 21 Oct 2015 07:30:00 GMT", 2 * time.Minute},
+		{"Wednesday, 21-Oct-15 07:28:30 GMT", 30 * time.Second},
+		// дата в прошлом - ждать не нужно
+		{"Wed, 21 Oct 2015 07:00:00 GMT", 0},
+		{"", DefaultRetryAfter},
+		{"-5", DefaultRetryAfter},
+		{"soon", DefaultRetryAfter},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseRetryAfter(tt.header, now), tt.header)
+	}
+}
+
+func TestZeroAccrual(t *testing.T) {
+	info, err := ParseOrderInfo([]byte(`{"order":"18","status":"PROCESSED","accrual":0}`))
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(0), info.Accrual)
+}
@@ -0,0 +1,280 @@
+// Package accrualtest - поддельная система расчета баллов для тестов и
+// локального запуска. Отвечает на GET /api/orders/{number} так же, как
+// настоящая: 200 с JSON, 204 для незарегистрированного заказа, 429 с
+// Retry-After и 500
+package accrualtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+)
+
+const ordersPath = "/api/orders/"
+
+// Step - один ответ системы расчета на запрос о заказе
+type Step struct {
+	// код ответа; 0 - 200 с телом из Status и Accrual
+	Code    int
+	Status  models.OrderStatus
+	Accrual money.Amount
+	// заголовок Retry-After для 429
+	RetryAfter time.Duration
+	// тело ответа с кодом, отличным от 200
+	Body string
+	// задержка перед ответом
+	Latency time.Duration
+}
+
+// Registered - заказ зарегистрирован, начисление не рассчитано
+func Registered() Step {
+	return Step{Status: models.StatusRegistered}
+}
+
+// Processing - расчет начисления в процессе
+func Processing() Step {
+	return Step{Status: models.StatusProcessing}
+}
+
+// Processed - расчет окончен, начислено accrual
+func Processed(accrual money.Amount) Step {
+	return Step{Status: models.StatusProcessed, Accrual: accrual}
+}
+
+// Invalid - заказ не принят к расчету
+func Invalid() Step {
+	return Step{Status: models.StatusInvalid}
+}
+
+// NotRegistered - 204: заказ системе расчета неизвестен
+func NotRegistered() Step {
+	return Step{Code: http.StatusNoContent}
+}
+
+// TooManyRequests - 429 с заголовком Retry-After
+func TooManyRequests(retryAfter time.Duration) Step {
+	return Step{Code: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+// ServerError - 500
+func ServerError() Step {
+	return Step{Code: http.StatusInternalServerError}
+}
+
+// Fake - обработчик API системы расчета. Для каждого заказа задается
+// последовательность ответов: каждый запрос берет следующий, последний
+// повторяется. Нулевое значение не готово к работе - используйте NewFake
+type Fake struct {
+	mu sync.Mutex
+	// сценарии заказов и сколько шагов каждого уже пройдено
+	orders   map[string][]Step
+	progress map[string]int
+	// сценарий для заказов без своего; nil - такие заказы не зарегистрированы
+	defaults []Step
+	// ответы, которые получат ближайшие запросы к любому заказу
+	injected []Step
+	requests map[string]int
+	total    int
+	latency  time.Duration
+	// сколько запросов в минуту отвечаем без 429; 0 - без ограничений
+	rateLimit   int
+	windowStart time.Time
+	windowCount int
+	// доля запросов, на которые отвечаем 500
+	failureRate float64
+	rnd         *rand.Rand
+	now         func() time.Time
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		orders:   make(map[string][]Step),
+		progress: make(map[string]int),
+		requests: make(map[string]int),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:      time.Now,
+	}
+}
+
+// SetOrder задает ответы на запросы о заказе и сбрасывает его прогресс
+func (f *Fake) SetOrder(orderID string, steps ...Step) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.orders[orderID] = steps
+	delete(f.progress, orderID)
+}
+
+// SetDefault задает сценарий для заказов, у которых нет своего; каждый
+// заказ проходит его независимо
+func (f *Fake) SetDefault(steps ...Step) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.defaults = steps
+}
+
+// Inject отдает steps ближайшим запросам, о каком бы заказе они ни были;
+// сценарии заказов при этом не продвигаются
+func (f *Fake) Inject(steps ...Step) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.injected = append(f.injected, steps...)
+}
+
+// SetLatency задерживает каждый ответ на d
+func (f *Fake) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// SetRateLimit ограничивает количество запросов в минуту, как настоящая
+// система расчета: сверх лимита - 429 до конца минуты
+func (f *Fake) SetRateLimit(perMinute int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimit = perMinute
+	f.windowCount = 0
+}
+
+// SetFailureRate отвечает 500 на долю rate случайных запросов
+func (f *Fake) SetFailureRate(rate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failureRate = rate
+}
+
+// Requests возвращает, сколько раз спрашивали о заказе
+func (f *Fake) Requests(orderID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[orderID]
+}
+
+// TotalRequests возвращает количество запросов обо всех заказах
+func (f *Fake) TotalRequests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.total
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	orderID := strings.TrimPrefix(r.URL.Path, ordersPath)
+	if r.Method != http.MethodGet || orderID == r.URL.Path || orderID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	step, latency := f.next(orderID)
+	if d := latency + step.Latency; d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeStep(w, orderID, step)
+}
+
+// next выбирает ответ на очередной запрос о заказе
+func (f *Fake) next(orderID string) (Step, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[orderID]++
+	f.total++
+	if step, ok := f.throttle(); ok {
+		return step, f.latency
+	}
+	if len(f.injected) > 0 {
+		step := f.injected[0]
+		f.injected = f.injected[1:]
+		return step, f.latency
+	}
+	if f.failureRate > 0 && f.rnd.Float64() < f.failureRate {
+		return ServerError(), f.latency
+	}
+	steps, ok := f.orders[orderID]
+	if !ok {
+		steps = f.defaults
+	}
+	if len(steps) == 0 {
+		return NotRegistered(), f.latency
+	}
+	i := f.progress[orderID]
+	if i < len(steps)-1 {
+		f.progress[orderID]++
+	}
+	return steps[i], f.latency
+}
+
+// throttle считает запросы в текущей минуте и возвращает 429 сверх лимита
+func (f *Fake) throttle() (Step, bool) {
+	if f.rateLimit <= 0 {
+		return Step{}, false
+	}
+	now := f.now()
+	if now.Sub(f.windowStart) >= time.Minute {
+		f.windowStart = now
+		f.windowCount = 0
+	}
+	f.windowCount++
+	if f.windowCount <= f.rateLimit {
+		return Step{}, false
+	}
+	step := TooManyRequests(f.windowStart.Add(time.Minute).Sub(now))
+	step.Body = fmt.Sprintf("No more than %v requests per minute allowed", f.rateLimit)
+	return step, true
+}
+
+type orderInfoResponse struct {
+	Order   string      `json:"order"`
+	Status  string      `json:"status"`
+	Accrual json.Number `json:"accrual,omitempty"`
+}
+
+func writeStep(w http.ResponseWriter, orderID string, step Step) {
+	switch step.Code {
+	case 0, http.StatusOK:
+	case http.StatusTooManyRequests:
+		// Retry-After - целое число секунд, округленное вверх
+		seconds := int((step.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		fallthrough
+	default:
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(step.Code)
+		w.Write([]byte(step.Body))
+		return
+	}
+	resp := orderInfoResponse{Order: orderID, Status: string(step.Status)}
+	if step.Status == models.StatusProcessed {
+		resp.Accrual = json.Number(step.Accrual.String())
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// Server - Fake, запущенный на httptest.Server
+type Server struct {
+	*httptest.Server
+	*Fake
+}
+
+// NewServer запускает поддельную систему расчета на локальном порту;
+// адрес для accrual.Config - поле URL. Сервер нужно закрыть
+func NewServer() *Server {
+	fake := NewFake()
+	return &Server{Server: httptest.NewServer(fake), Fake: fake}
+}
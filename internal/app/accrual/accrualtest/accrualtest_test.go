@@ -0,0 +1,99 @@
+package accrualtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newService(t *testing.T) (*Server, *accrual.AccrualService) {
+	t.Helper()
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	return srv, accrual.NewAccrualService(accrual.Config{
+		Address:          srv.URL,
+		Timeout:          time.Second,
+		FailureThreshold: 100,
+	})
+}
+
+func TestOrderSequence(t *testing.T) {
+	srv, s := newService(t)
+	srv.SetOrder("18", NotRegistered(), Registered(), Processing(), Processed(50050))
+	ctx := context.Background()
+
+	_, err := s.GetOrderInfo(ctx, "18")
+	assert.ErrorIs(t, err, accrual.ErrOrderNotRegistered)
+	for _, want := range []models.OrderStatus{
+		models.StatusRegistered,
+		models.StatusProcessing,
+		models.StatusProcessed,
+		// последний шаг повторяется
+		models.StatusProcessed,
+	} {
+		info, err := s.GetOrderInfo(ctx, "18")
+		require.NoError(t, err)
+		assert.Equal(t, want, info.Status)
+	}
+	info, _ := s.GetOrderInfo(ctx, "18")
+	assert.Equal(t, "18", info.Order)
+	assert.EqualValues(t, 50050, info.Accrual)
+	assert.Equal(t, 6, srv.Requests("18"))
+
+	_, err = s.GetOrderInfo(ctx, "26")
+	assert.ErrorIs(t, err, accrual.ErrOrderNotRegistered)
+	srv.SetDefault(Invalid())
+	info, err = s.GetOrderInfo(ctx, "26")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusInvalid, info.Status)
+	assert.Equal(t, 8, srv.TotalRequests())
+}
+
+func TestInject(t *testing.T) {
+	srv, s := newService(t)
+	srv.SetOrder("18", Processed(100))
+	srv.Inject(ServerError(), TooManyRequests(2*time.Second))
+	ctx := context.Background()
+
+	_, err := s.GetOrderInfo(ctx, "18")
+	var respErr *accrual.ErrUnexpectedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, 500, respErr.StatusCode)
+
+	_, err = s.GetOrderInfo(ctx, "18")
+	var tmrErr *accrual.ErrTooManyRequests
+	require.ErrorAs(t, err, &tmrErr)
+	assert.Equal(t, 2*time.Second, tmrErr.RetryAfter)
+}
+
+func TestRateLimit(t *testing.T) {
+	srv, s := newService(t)
+	srv.SetDefault(Registered())
+	srv.SetRateLimit(60)
+	ctx := context.Background()
+	for i := 0; i < 60; i++ {
+		_, err := s.GetOrderInfo(ctx, "18")
+		require.NoError(t, err)
+	}
+	_, err := s.GetOrderInfo(ctx, "18")
+	var tmrErr *accrual.ErrTooManyRequests
+	require.ErrorAs(t, err, &tmrErr)
+	assert.Greater(t, tmrErr.RetryAfter, time.Duration(0))
+	// клиент узнал лимит из тела ответа
+	assert.InDelta(t, 1.0, s.LimiterStats().Rate, 1e-9)
+}
+
+func TestLatency(t *testing.T) {
+	srv, s := newService(t)
+	srv.SetDefault(Registered())
+	srv.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := s.GetOrderInfo(ctx, "18")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
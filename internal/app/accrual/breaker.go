@@ -0,0 +1,168 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen - система расчета недоступна, запрос не отправлялся
+var ErrCircuitOpen = errors.New("accrual system circuit is open")
+
+type BreakerState int
+
+const (
+	// запросы проходят, ошибки подряд считаются
+	StateClosed BreakerState = iota
+	// запросы не отправляются, пока не пройдет OpenTimeout
+	StateOpen
+	// пропускается один пробный запрос: успех закрывает цепь, ошибка - снова открывает
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker - автоматический выключатель: после FailureThreshold ошибок подряд
+// перестает обращаться к системе расчета на OpenTimeout, затем проверяет ее
+// одним запросом
+type Breaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	state            BreakerState
+	failures         int
+	openedAt         time.Time
+	// в полуоткрытом состоянии уже идет пробный запрос
+	probing bool
+	now     func() time.Time
+}
+
+func NewBreaker(failureThreshold int, openTimeout time.Duration) *Breaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &Breaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
+
+// Allow возвращает ErrCircuitOpen, если запрос отправлять нельзя. После
+// разрешенного запроса нужно вызвать Done с его результатом
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if b.now().Before(b.openedAt.Add(b.openTimeout)) {
+			return ErrCircuitOpen
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// Done учитывает результат запроса, разрешенного Allow
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// запрос отменил сам вызывающий - о системе расчета это ничего не говорит
+	if errors.Is(err, context.Canceled) {
+		b.probing = false
+		return
+	}
+	if !isFailure(err) {
+		b.failures = 0
+		b.probing = false
+		if b.state != StateClosed {
+			b.setState(StateClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.failureThreshold {
+		b.probing = false
+		b.openedAt = b.now()
+		b.setState(StateOpen)
+	}
+}
+
+// State возвращает текущее состояние; открытая цепь, у которой истек
+// OpenTimeout, считается полуоткрытой
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.openTimeout)) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Failures возвращает количество ошибок подряд
+func (b *Breaker) Failures() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+// WaitClosed блокируется, пока цепь открыта и пробный запрос делать рано
+func (b *Breaker) WaitClosed(ctx context.Context) error {
+	b.mu.Lock()
+	var wait time.Duration
+	if b.state == StateOpen {
+		wait = b.openedAt.Add(b.openTimeout).Sub(b.now())
+	}
+	b.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+func (b *Breaker) setState(state BreakerState) {
+	log.Printf("Accrual system circuit: %v -> %v", b.state, state)
+	b.state = state
+}
+
+// isFailure отличает недоступность системы расчета от ответов, которые
+// говорят, что она работает: 204, 429 и даже непонятное тело ответа
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var respErr *ErrUnexpectedResponse
+	if errors.As(err, &respErr) {
+		return respErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var tmrErr *ErrTooManyRequests
+	if errors.Is(err, ErrOrderNotRegistered) ||
+		errors.Is(err, ErrBadResponse) ||
+		errors.As(err, &tmrErr) {
+		return false
+	}
+	// прочие ошибки транспорта: отказ в соединении, обрыв и т.п.
+	return true
+}
@@ -0,0 +1,123 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errRefused = errors.New("connection refused")
+
+func newFakeClockBreaker(threshold int, openTimeout time.Duration) (*Breaker, *time.Time) {
+	now := time.Date(2022, time.November, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBreaker(threshold, openTimeout)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := newFakeClockBreaker(3, time.Minute)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		b.Done(errRefused)
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	// успех обнуляет счетчик
+	require.NoError(t, b.Allow())
+	b.Done(nil)
+	assert.Equal(t, 0, b.Failures())
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Allow())
+		b.Done(errRefused)
+	}
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, now := newFakeClockBreaker(1, time.Minute)
+	require.NoError(t, b.Allow())
+	b.Done(errRefused)
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, StateHalfOpen, b.State())
+	// пробный запрос только один
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+	// неудачная проба снова размыкает цепь
+	b.Done(errRefused)
+	assert.Equal(t, StateOpen, b.State())
+
+	*now = now.Add(time.Minute)
+	require.NoError(t, b.Allow())
+	b.Done(nil)
+	assert.Equal(t, StateClosed, b.State())
+	assert.NoError(t, b.Allow())
+}
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	b, now := newFakeClockBreaker(1, time.Minute)
+	require.NoError(t, b.Allow())
+	b.Done(errRefused)
+	*now = now.Add(time.Minute)
+
+	require.NoError(t, b.Allow())
+	b.Done(context.Canceled)
+	// отмена ничего не говорит о системе расчета: пробу можно повторить
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.NoError(t, b.Allow())
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		err     error
+		failure bool
+	}{
+		{nil, false},
+		{errRefused, true},
+		{context.DeadlineExceeded, true},
+		{&ErrUnexpectedResponse{StatusCode: 503}, true},
+		{&ErrUnexpectedResponse{StatusCode: 404}, false},
+		{NewErrTooManyRequests(time.Second), false},
+		{fmt.Errorf("%w: 18", ErrOrderNotRegistered), false},
+		{fmt.Errorf("%w: bad json", ErrBadResponse), false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.failure, isFailure(tt.err), "%v", tt.err)
+	}
+}
+
+func TestServiceCircuit(t *testing.T) {
+	calls := 0
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		respond(http.StatusInternalServerError, "down")(w, r)
+	})
+	s.breaker = NewBreaker(2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		_, err := s.GetOrderInfo(context.Background(), "18")
+		var respErr *ErrUnexpectedResponse
+		assert.ErrorAs(t, err, &respErr)
+	}
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	health := s.Health()
+	assert.Equal(t, "open", health.Circuit)
+	assert.Equal(t, 2, health.Failures)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.WaitAvailable(ctx), context.DeadlineExceeded)
+}
@@ -1,11 +1,18 @@
 package accrual
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
-// var ErrTooManyRequests = errors.New("too many requests for the accrual system")
+// ErrOrderNotRegistered - система расчета ответила 204: заказ ей неизвестен
+var ErrOrderNotRegistered = errors.New("order is not registered in the accrual system")
+
+// ErrBadResponse - система расчета ответила 200, но тело ответа не
+// соответствует спецификации
+var ErrBadResponse = errors.New("bad response from the accrual system")
 
 type ErrTooManyRequests struct {
 	RetryAfter time.Duration
@@ -15,8 +22,39 @@ func (e *ErrTooManyRequests) Error() string {
 	return fmt.Sprintf("too many requests for the accrual system; wait %v", e.RetryAfter)
 }
 
-func NewErrTooManyRequests(retryAfter int) error {
-	return &ErrTooManyRequests{
-		RetryAfter: time.Duration(retryAfter) * time.Second,
-	}
+func NewErrTooManyRequests(retryAfter time.Duration) error {
+	return &ErrTooManyRequests{RetryAfter: retryAfter}
+}
+
+// ErrLimiterDeadline - очередь в общем лимитере не подойдет до дедлайна
+// контекста, поэтому запрос не отправлялся. В отличие от ErrTooManyRequests,
+// система расчета об ожидании не просила
+type ErrLimiterDeadline struct {
+	// через сколько подошла бы очередь
+	Wait time.Duration
+}
+
+func (e *ErrLimiterDeadline) Error() string {
+	return fmt.Sprintf("accrual system rate limit: next request in %v is past the deadline", e.Wait)
+}
+
+func (e *ErrLimiterDeadline) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// ErrUnexpectedResponse - система расчета ответила кодом, который не
+// описан в ее спецификации, или внутренней ошибкой (5xx)
+type ErrUnexpectedResponse struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ErrUnexpectedResponse) Error() string {
+	return fmt.Sprintf("unexpected response from the accrual system: %v %v", e.StatusCode, e.Body)
+}
+
+// Temporary возвращает true для ошибок на стороне системы расчета: запрос
+// имеет смысл повторить позже
+func (e *ErrUnexpectedResponse) Temporary() bool {
+	return e.StatusCode >= 500
 }
@@ -0,0 +1,237 @@
+package accrual
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ниже этой частоты лимитер не опускается, сколько бы 429 ни пришло
+	minRate = 0.1
+	// сколько запросов можно отправить подряд после простоя
+	burst = 1
+)
+
+// allowedRateRe разбирает тело ответа 429 системы расчета:
+// "No more than N requests per minute allowed"
+var allowedRateRe = regexp.MustCompile(`(?i)no more than (\d+) requests? per (second|minute|hour)`)
+
+// LimiterStats - сколько времени вызывающие провели в ожидании лимитера
+type LimiterStats struct {
+	// текущая разрешенная частота запросов в секунду; 0 - без ограничений
+	Rate float64
+	// сколько раз запрос пришлось задержать
+	Waits int64
+	// суммарное время ожидания всех вызывающих
+	Throttled time.Duration
+	// сколько раз система расчета просила подождать (429)
+	Pauses int64
+	// до какого момента запросы приостановлены
+	PausedUntil time.Time
+}
+
+// Limiter - token bucket на процесс: все воркеры делят одну частоту запросов
+// к системе расчета и вместе ждут окончания Retry-After
+type Limiter struct {
+	mu sync.Mutex
+	// токенов в секунду; 0 - без ограничений
+	rate float64
+	// частота из настроек; к ней лимитер возвращается в learnedUntil
+	configured   float64
+	learnedUntil time.Time
+	// токенов может не хватать: отрицательный остаток - очередь ожидающих
+	tokens float64
+	// момент, до которого пополнение уже учтено; во время паузы - в будущем
+	last        time.Time
+	pausedUntil time.Time
+	stats       LimiterStats
+	now         func() time.Time
+}
+
+// NewLimiter создает лимитер на rate запросов в секунду; rate <= 0 - без
+// ограничений, пока частота не станет известна из ответа 429
+func NewLimiter(rate float64) *Limiter {
+	if rate < 0 {
+		rate = 0
+	}
+	l := &Limiter{rate: rate, configured: rate, now: time.Now}
+	l.tokens = burst
+	l.last = l.now()
+	return l
+}
+
+// advance пополняет ведро за время с прошлого вызова
+func (l *Limiter) advance(now time.Time) {
+	l.restore(now)
+	if !now.After(l.last) {
+		return
+	}
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	} else {
+		l.tokens = burst
+	}
+	l.last = now
+}
+
+// reserve забирает токен и возвращает, сколько нужно подождать перед запросом
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.advance(now)
+	l.tokens--
+	wait := l.last.Sub(now)
+	if l.tokens < 0 && l.rate > 0 {
+		wait += time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// Wait блокируется, пока не подойдет очередь запроса. Если ждать придется
+// дольше дедлайна ctx, сразу возвращает *ErrLimiterDeadline со сроком
+// ожидания, не занимая очередь
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	wait := l.reserve(now)
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		// возвращаем токен: запроса не будет
+		l.tokens++
+		l.mu.Unlock()
+		return &ErrLimiterDeadline{Wait: wait}
+	}
+	if wait > 0 {
+		l.stats.Waits++
+		l.stats.Throttled += wait
+	}
+	l.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+// WaitPause блокируется до окончания паузы после 429, не занимая очередь
+func (l *Limiter) WaitPause(ctx context.Context) error {
+	l.mu.Lock()
+	wait := l.pausedUntil.Sub(l.now())
+	l.mu.Unlock()
+	return sleep(ctx, wait)
+}
+
+// Pause приостанавливает все запросы на d: новые токены начнут
+// появляться только после паузы
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.advance(now)
+	l.stats.Pauses++
+	until := now.Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	if l.pausedUntil.After(l.last) {
+		l.last = l.pausedUntil
+	}
+}
+
+// restore возвращает частоту из настроек, когда истекла выученная
+func (l *Limiter) restore(now time.Time) {
+	if l.learnedUntil.IsZero() || now.Before(l.learnedUntil) {
+		return
+	}
+	l.learnedUntil = time.Time{}
+	if l.rate != l.configured {
+		log.Printf("Accrual system rate limit: %.3f -> %.3f requests/s (restored)", l.rate, l.configured)
+		l.rate = l.configured
+	}
+}
+
+// SetRate меняет частоту запросов из настроек; rate <= 0 снимает
+// ограничение. Выученная по 429 частота при этом забывается
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.now())
+	if rate < 0 {
+		rate = 0
+	}
+	l.rate, l.configured = rate, rate
+	l.learnedUntil = time.Time{}
+}
+
+// Learn подстраивает частоту по ответу 429: берет ее из тела ответа, а если
+// его не удалось разобрать - вдвое снижает текущую. Лимит системы расчета
+// может быть временным, поэтому выученная частота действует только window
+// (Retry-After), а потом лимитер возвращается к частоте из настроек
+func (l *Limiter) Learn(body string, window time.Duration) {
+	rate, ok := parseAllowedRate(body)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.advance(now)
+	current := l.rate
+	if !ok {
+		if current == 0 {
+			return
+		}
+		rate = current / 2
+	}
+	if rate < minRate {
+		rate = minRate
+	}
+	if until := now.Add(window); until.After(l.learnedUntil) {
+		l.learnedUntil = until
+	}
+	if rate != current {
+		log.Printf("Accrual system rate limit: %.3f -> %.3f requests/s", current, rate)
+		l.rate = rate
+	}
+}
+
+// Stats возвращает накопленную статистику ожидания
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.restore(l.now())
+	stats := l.stats
+	stats.Rate = l.rate
+	stats.PausedUntil = l.pausedUntil
+	return stats
+}
+
+// parseAllowedRate достает разрешенную частоту в запросах в секунду
+func parseAllowedRate(body string) (float64, bool) {
+	m := allowedRateRe.FindStringSubmatch(body)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	seconds := map[string]float64{"second": 1, "minute": 60, "hour": 3600}[strings.ToLower(m[2])]
+	return float64(n) / seconds, true
+}
+
+// sleep ждет d или отмены ctx
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
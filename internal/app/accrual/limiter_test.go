@@ -0,0 +1,180 @@
+package accrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeClockLimiter возвращает лимитер с часами, которые двигает тест
+func newFakeClockLimiter(rate float64) (*Limiter, *time.Time) {
+	now := time.Date(2022, time.November, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(rate)
+	l.now = func() time.Time { return now }
+	l.last = now
+	return l, &now
+}
+
+func TestLimiterRate(t *testing.T) {
+	l, now := newFakeClockLimiter(10)
+	assert.Equal(t, time.Duration(0), l.reserve(*now))
+	assert.Equal(t, 100*time.Millisecond, l.reserve(*now))
+	assert.Equal(t, 200*time.Millisecond, l.reserve(*now))
+
+	// за секунду простоя копится не больше burst токенов
+	*now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), l.reserve(*now))
+	assert.Equal(t, 100*time.Millisecond, l.reserve(*now))
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l, now := newFakeClockLimiter(0)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), l.reserve(*now))
+	}
+}
+
+func TestLimiterPause(t *testing.T) {
+	l, now := newFakeClockLimiter(10)
+	l.Pause(time.Second)
+	assert.Equal(t, time.Second, l.reserve(*now))
+	// после паузы запросы идут с прежней частотой, а не все разом
+	assert.Equal(t, time.Second+100*time.Millisecond, l.reserve(*now))
+
+	*now = now.Add(2 * time.Second)
+	assert.Equal(t, time.Duration(0), l.reserve(*now))
+
+	stats := l.Stats()
+	assert.Equal(t, int64(1), stats.Pauses)
+	assert.Equal(t, now.Add(-time.Second), stats.PausedUntil)
+}
+
+func TestLimiterWaitBeyondDeadline(t *testing.T) {
+	l := NewLimiter(0)
+	l.Pause(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := l.Wait(ctx)
+	var deadlineErr *ErrLimiterDeadline
+	require.ErrorAs(t, err, &deadlineErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.InDelta(t, time.Minute, deadlineErr.Wait, float64(time.Second))
+	// это не ответ системы расчета
+	var tmrErr *ErrTooManyRequests
+	assert.False(t, errors.As(err, &tmrErr))
+	// отказ не занимает очередь и не считается ожиданием
+	assert.Equal(t, int64(0), l.Stats().Waits)
+	assert.Equal(t, float64(1), l.tokens)
+}
+
+func TestLimiterThrottledStats(t *testing.T) {
+	l := NewLimiter(100)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Wait(context.Background()))
+	}
+	stats := l.Stats()
+	assert.Equal(t, int64(2), stats.Waits)
+	assert.Greater(t, stats.Throttled, time.Duration(0))
+	assert.LessOrEqual(t, stats.Throttled, 30*time.Millisecond)
+}
+
+func TestLimiterLearn(t *testing.T) {
+	l := NewLimiter(0)
+	// пока лимит неизвестен, непонятный ответ ничего не меняет
+	l.Learn("slow down", time.Minute)
+	assert.Equal(t, float64(0), l.Stats().Rate)
+
+	l.Learn("No more than 120 requests per minute allowed", time.Minute)
+	assert.Equal(t, float64(2), l.Stats().Rate)
+
+	l.Learn("slow down", time.Minute)
+	assert.Equal(t, float64(1), l.Stats().Rate)
+
+	for i := 0; i < 10; i++ {
+		l.Learn("", time.Minute)
+	}
+	assert.Equal(t, minRate, l.Stats().Rate)
+}
+
+// выученная по 429 частота действует, пока не истечет Retry-After
+func TestLimiterLearnRestores(t *testing.T) {
+	l, now := newFakeClockLimiter(10)
+	l.Learn("No more than 60 requests per minute allowed", time.Minute)
+	assert.Equal(t, float64(1), l.Stats().Rate)
+
+	*now = now.Add(30 * time.Second)
+	l.Learn("slow down", 10*time.Second)
+	assert.Equal(t, 0.5, l.Stats().Rate)
+
+	// окно продлевается только вперед: до конца первой минуты частота прежняя
+	*now = now.Add(29 * time.Second)
+	assert.Equal(t, 0.5, l.Stats().Rate)
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, float64(10), l.Stats().Rate)
+	assert.Equal(t, time.Duration(0), l.reserve(*now))
+	assert.Equal(t, 100*time.Millisecond, l.reserve(*now))
+
+	// без лимита в настройках лимитер снова перестает ограничивать
+	l, now = newFakeClockLimiter(0)
+	l.Learn("No more than 1 request per second allowed", time.Second)
+	assert.Equal(t, float64(1), l.Stats().Rate)
+	*now = now.Add(time.Second)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), l.reserve(*now))
+	}
+}
+
+func TestParseAllowedRate(t *testing.T) {
+	tests := []struct {
+		body string
+		rate float64
+		ok   bool
+	}{
+		{"No more than 10 requests per minute allowed", 10.0 / 60, true},
+		{"no more than 5 requests per second allowed", 5, true},
+		{"No more than 1 request per hour", 1.0 / 3600, true},
+		{"No more than 0 requests per minute allowed", 0, false},
+		{"Too many requests", 0, false},
+	}
+	for _, tt := range tests {
+		rate, ok := parseAllowedRate(tt.body)
+		assert.Equal(t, tt.ok, ok, tt.body)
+		assert.InDelta(t, tt.rate, rate, 1e-9, tt.body)
+	}
+}
+
+func TestRetryAfterPausesAllCallers(t *testing.T) {
+	var calls atomic.Int32
+	s := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		respond(
+			http.StatusTooManyRequests,
+			"No more than 60 requests per minute allowed",
+			"Retry-After", "60",
+		)(w, r)
+	})
+
+	_, err := s.GetOrderInfo(context.Background(), "18")
+	var tmrErr *ErrTooManyRequests
+	require.ErrorAs(t, err, &tmrErr)
+	assert.Equal(t, time.Minute, tmrErr.RetryAfter)
+	assert.Equal(t, float64(1), s.LimiterStats().Rate)
+
+	// следующий вызов до конца паузы в систему расчета не уходит
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = s.GetOrderInfo(ctx, "26")
+	var deadlineErr *ErrLimiterDeadline
+	require.ErrorAs(t, err, &deadlineErr)
+	assert.Equal(t, int32(1), calls.Load())
+
+	assert.ErrorIs(t, s.WaitAvailable(ctx), context.DeadlineExceeded)
+}
@@ -5,6 +5,7 @@
 package accrual
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,16 +35,30 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 }
 
 // GetOrderInfo mocks base method.
-func (m *MockService) GetOrderInfo(arg0 string) ([]byte, error) {
+func (m *MockService) GetOrderInfo(arg0 context.Context, arg1 string) (*OrderInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrderInfo", arg0)
-	ret0, _ := ret[0].([]byte)
+	ret := m.ctrl.Call(m, "GetOrderInfo", arg0, arg1)
+	ret0, _ := ret[0].(*OrderInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOrderInfo indicates an expected call of GetOrderInfo.
-func (mr *MockServiceMockRecorder) GetOrderInfo(arg0 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetOrderInfo(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderInfo", reflect.TypeOf((*MockService)(nil).GetOrderInfo), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderInfo", reflect.TypeOf((*MockService)(nil).GetOrderInfo), arg0, arg1)
+}
+
+// WaitAvailable mocks base method.
+func (m *MockService) WaitAvailable(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitAvailable", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitAvailable indicates an expected call of WaitAvailable.
+func (mr *MockServiceMockRecorder) WaitAvailable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitAvailable", reflect.TypeOf((*MockService)(nil).WaitAvailable), arg0)
 }
@@ -1,5 +1,8 @@
 package accrual
 
+import "context"
+
 type Service interface {
-	GetOrderInfo(orderID string) ([]byte, error)
+	GetOrderInfo(ctx context.Context, orderID string) (*OrderInfo, error)
+	WaitAvailable(ctx context.Context) error
 }
@@ -0,0 +1,83 @@
+package accrual
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader - заголовок с подписью уведомления системы расчета:
+// "t=<unix-время>,v1=<hex HMAC-SHA256>"
+const SignatureHeader = "X-Accrual-Signature"
+
+// SignatureTolerance - насколько время подписи может расходиться с нашим:
+// старые уведомления не принимаются, чтобы их нельзя было проиграть повторно
+const SignatureTolerance = 5 * time.Minute
+
+// ErrBadSignature - подпись уведомления отсутствует, устарела или не сходится
+var ErrBadSignature = errors.New("bad accrual callback signature")
+
+// Sign подписывает тело уведомления: HMAC-SHA256 от "<unix-время>.<тело>"
+func Sign(secret []byte, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%v,v1=%v", ts, signature(secret, ts, body))
+}
+
+// VerifySignature проверяет заголовок SignatureHeader для тела body
+func VerifySignature(
+	secret []byte,
+	header string,
+	body []byte,
+	now time.Time,
+	tolerance time.Duration,
+) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return fmt.Errorf("%w: malformed header", ErrBadSignature)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrBadSignature)
+	}
+	skew := now.Sub(time.Unix(unix, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return fmt.Errorf("%w: timestamp is out of tolerance", ErrBadSignature)
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrBadSignature)
+	}
+	want, _ := hex.DecodeString(signature(secret, ts, body))
+	if !hmac.Equal(got, want) {
+		return fmt.Errorf("%w: signature mismatch", ErrBadSignature)
+	}
+	return nil
+}
+
+func signature(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
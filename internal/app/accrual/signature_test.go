@@ -0,0 +1,38 @@
+package accrual
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"order":"18","status":"PROCESSED","accrual":500}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign(secret, now, body)
+
+	assert.NoError(t, VerifySignature(secret, header, body, now, SignatureTolerance))
+	assert.NoError(t, VerifySignature(secret, header, body, now.Add(time.Minute), SignatureTolerance))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		{"other secret", []byte("other"), header, body, now},
+		{"tampered body", secret, header, []byte(`{"order":"18","status":"PROCESSED","accrual":5000}`), now},
+		{"expired", secret, header, body, now.Add(SignatureTolerance + time.Second)},
+		{"from the future", secret, header, body, now.Add(-SignatureTolerance - time.Second)},
+		{"empty", secret, "", body, now},
+		{"no timestamp", secret, "v1=00", body, now},
+		{"not hex", secret, "t=1700000000,v1=zz", body, now},
+	}
+	for _, tt := range tests {
+		err := VerifySignature(tt.secret, tt.header, tt.body, tt.now, SignatureTolerance)
+		assert.ErrorIs(t, err, ErrBadSignature, tt.name)
+	}
+}
@@ -2,8 +2,11 @@ package auth
 
 import "github.com/golang-jwt/jwt/v4"
 
+// Claims - содержимое access-токена. RegisteredClaims.ID (jti) позволяет
+// отозвать отдельный токен, SessionID - все токены одного входа
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
 }
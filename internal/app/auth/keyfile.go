@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const keyFileExt = ".pem"
+
+// ParsePrivateKeyPEM читает закрытый ключ RSA или Ed25519 в PEM: PKCS#8
+// ("PRIVATE KEY") или PKCS#1 ("RSA PRIVATE KEY")
+func ParsePrivateKeyPEM(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block", ErrUnsupportedKey)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type)
+}
+
+// GenerateKey создает новый ключ для RS256 или EdDSA
+func GenerateKey(alg string, activeFrom time.Time) (*Key, error) {
+	private, err := generatePrivateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	id, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(id, private, activeFrom)
+}
+
+func generatePrivateKey(alg string) (any, error) {
+	switch alg {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, minRSABits)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+	return nil, fmt.Errorf("%w: can't generate %v keys", ErrUnsupportedKey, alg)
+}
+
+// KeyDir - каталог ключей: по файлу <kid>.pem на ключ. Ключ вступает в силу
+// в момент последнего изменения файла, поэтому новый ключ достаточно
+// положить в каталог, а запланировать его можно, выставив файлу время в
+// будущем
+type KeyDir string
+
+// Load читает все ключи каталога
+func (d KeyDir) Load() ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(string(d), "*"+keyFileExt))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		private, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		key, err := NewKey(strings.TrimSuffix(filepath.Base(path), keyFileExt), private, info.ModTime())
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Add сохраняет ключ в каталог. Файл появляется целиком и сразу с нужным
+// временем, поэтому другой процесс не прочитает его наполовину
+func (d KeyDir) Add(key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.signKey)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(string(d), ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), key.ActiveFrom, key.ActiveFrom); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(key.ID))
+}
+
+func (d KeyDir) Remove(id string) error {
+	return os.Remove(d.path(id))
+}
+
+func (d KeyDir) path(id string) string {
+	return filepath.Join(string(d), id+keyFileExt)
+}
+
+// Rotation перечитывает каталог ключей и, если задан Interval, сама
+// выпускает новые ключи и удаляет отслужившие
+type Rotation struct {
+	Dir KeyDir
+	// алгоритм новых ключей
+	Algorithm string
+	// как часто менять ключ; 0 - ключи меняет администратор
+	Interval time.Duration
+	// новый ключ публикуется за Delay до того, как начнет подписывать:
+	// за это время его загружают остальные экземпляры сервиса и клиенты JWKS
+	Delay time.Duration
+}
+
+// Reload загружает ключи в ring, при необходимости выпустив новый
+func (rot Rotation) Reload(ring *KeyRing) error {
+	keys, err := rot.Dir.Load()
+	if err != nil {
+		return err
+	}
+	if rot.Interval > 0 {
+		key, err := rot.next(keys, ring.now())
+		if err != nil {
+			return err
+		}
+		if key != nil {
+			if err := rot.Dir.Add(key); err != nil {
+				return err
+			}
+			log.Printf("Generated %v signing key %v, active from %v", key.Algorithm, key.ID, key.ActiveFrom.Format(time.RFC3339))
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w in %v", ErrNoKeys, rot.Dir)
+	}
+	if err := ring.SetKeys(keys); err != nil {
+		return err
+	}
+	if rot.Interval > 0 {
+		rot.prune(ring)
+	}
+	return nil
+}
+
+// next возвращает новый ключ, если пора: через Interval после вступления в
+// силу последнего ключа, с учетом Delay на публикацию
+func (rot Rotation) next(keys []*Key, now time.Time) (*Key, error) {
+	if len(keys) == 0 {
+		// ключей еще нет - подписывать нечем, ждать публикации незачем
+		return GenerateKey(rot.Algorithm, now)
+	}
+	latest := keys[0].ActiveFrom
+	for _, k := range keys {
+		if k.ActiveFrom.After(latest) {
+			latest = k.ActiveFrom
+		}
+	}
+	scheduled := latest.Add(rot.Interval)
+	if now.Add(rot.Delay).Before(scheduled) {
+		return nil, nil
+	}
+	if earliest := now.Add(rot.Delay); scheduled.Before(earliest) {
+		scheduled = earliest
+	}
+	return GenerateKey(rot.Algorithm, scheduled)
+}
+
+// prune удаляет файлы ключей, у которых кончился льготный период
+func (rot Rotation) prune(ring *KeyRing) {
+	expired := ring.Expired()
+	if len(expired) == 0 {
+		return
+	}
+	for _, k := range expired {
+		if err := rot.Dir.Remove(k.ID); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error while removing expired signing key %v: %v", k.ID, err)
+			continue
+		}
+		log.Printf("Removed expired signing key %v", k.ID)
+	}
+	if err := ring.SetKeys(ring.Valid()); err != nil {
+		log.Printf("Error while dropping expired signing keys: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	jwxjwt "github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// алгоритмы подписи токенов
+const (
+	// общий секрет: проверить токен может только тот, кто может его выдать
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// ключи RSA короче этого не принимаем
+const minRSABits = 2048
+
+var (
+	ErrNoKeys         = errors.New("no signing keys")
+	ErrUnsupportedKey = errors.New("unsupported signing key")
+)
+
+// Key - ключ подписи токенов. Токен хранит ID ключа в заголовке kid, по нему
+// проверяющая сторона находит открытый ключ
+type Key struct {
+	ID        string
+	Algorithm string
+	// с этого момента ключ подписывает новые токены; до этого он только
+	// публикуется, чтобы проверяющие успели его получить
+	ActiveFrom time.Time
+	signKey    any
+	verifyKey  jwk.Key
+	// nil для общего секрета - его не публикуем
+	publicKey jwk.Key
+}
+
+// NewKey создает ключ из закрытого ключа: []byte для HS256, *rsa.PrivateKey
+// для RS256 или ed25519.PrivateKey для EdDSA
+func NewKey(id string, private any, activeFrom time.Time) (*Key, error) {
+	if id == "" {
+		return nil, fmt.Errorf("%w: empty key id", ErrUnsupportedKey)
+	}
+	key := Key{ID: id, ActiveFrom: activeFrom, signKey: private}
+	var alg jwa.SignatureAlgorithm
+	var public any
+	switch k := private.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return nil, fmt.Errorf("%w: empty secret", ErrUnsupportedKey)
+		}
+		alg = jwa.HS256
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%w: RSA key %v is shorter than %v bits", ErrUnsupportedKey, id, minRSABits)
+		}
+		alg, public = jwa.RS256, &k.PublicKey
+	case ed25519.PrivateKey:
+		alg, public = jwa.EdDSA, k.Public()
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, private)
+	}
+	key.Algorithm = alg.String()
+
+	var err error
+	if public == nil {
+		key.verifyKey, err = newJWK(id, alg, private)
+	} else {
+		key.verifyKey, err = newJWK(id, alg, public)
+		key.publicKey = key.verifyKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func newJWK(id string, alg jwa.SignatureAlgorithm, raw any) (jwk.Key, error) {
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range map[string]any{
+		jwk.KeyIDKey:     id,
+		jwk.AlgorithmKey: alg,
+		jwk.KeyUsageKey:  jwk.ForSignature,
+	} {
+		if err := key.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// KeyRing - набор ключей подписи. Токены подписывает последний вступивший в
+// силу ключ; замененный ключ еще grace принимается при проверке и
+// публикуется, чтобы выданные им токены дожили до конца срока
+type KeyRing struct {
+	mu sync.RWMutex
+	// по возрастанию ActiveFrom
+	keys  []*Key
+	grace time.Duration
+	now   func() time.Time
+}
+
+func NewKeyRing(grace time.Duration, keys ...*Key) (*KeyRing, error) {
+	r := &KeyRing{grace: grace, now: time.Now}
+	if len(keys) == 0 {
+		return r, nil
+	}
+	return r, r.SetKeys(keys)
+}
+
+// SetKeys заменяет набор ключей
+func (r *KeyRing) SetKeys(keys []*Key) error {
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+	sorted := append([]*Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ActiveFrom.Equal(sorted[j].ActiveFrom) {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].ActiveFrom.Before(sorted[j].ActiveFrom)
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].ID == sorted[i-1].ID {
+			return fmt.Errorf("%w: duplicate key id %v", ErrUnsupportedKey, sorted[i].ID)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = sorted
+	return nil
+}
+
+// state возвращает ключи и индекс текущего: последнего, чей ActiveFrom уже
+// наступил, а если такого нет - самого раннего
+func (r *KeyRing) state() ([]*Key, int, time.Time) {
+	r.mu.RLock()
+	keys := r.keys
+	r.mu.RUnlock()
+	now := r.now()
+	current := 0
+	for i, k := range keys {
+		if !k.ActiveFrom.After(now) {
+			current = i
+		}
+	}
+	return keys, current, now
+}
+
+// expired сообщает, что льготный период ключа i кончился: его заменили
+// (вступил в силу следующий ключ) больше grace назад
+func (r *KeyRing) expired(keys []*Key, i, current int, now time.Time) bool {
+	return i < current && !now.Before(keys[i+1].ActiveFrom.Add(r.grace))
+}
+
+// Current возвращает ключ, которым подписываются новые токены
+func (r *KeyRing) Current() (*Key, error) {
+	keys, current, _ := r.state()
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys[current], nil
+}
+
+// Valid возвращает ключи, которые принимаются при проверке: текущий,
+// будущие и замененные не больше grace назад
+func (r *KeyRing) Valid() []*Key {
+	keys, current, now := r.state()
+	valid := make([]*Key, 0, len(keys))
+	for i, k := range keys {
+		if !r.expired(keys, i, current, now) {
+			valid = append(valid, k)
+		}
+	}
+	return valid
+}
+
+// Expired возвращает ключи, у которых кончился льготный период
+func (r *KeyRing) Expired() []*Key {
+	keys, current, now := r.state()
+	var expired []*Key
+	for i, k := range keys {
+		if r.expired(keys, i, current, now) {
+			expired = append(expired, k)
+		}
+	}
+	return expired
+}
+
+// Verify проверяет подпись и срок токена. Ключ выбирается по kid, алгоритм
+// должен совпадать с алгоритмом ключа
+func (r *KeyRing) Verify(token string) (jwxjwt.Token, error) {
+	set := jwk.NewSet()
+	for _, k := range r.Valid() {
+		if err := set.AddKey(k.verifyKey); err != nil {
+			return nil, err
+		}
+	}
+	return jwxjwt.Parse(
+		[]byte(strings.TrimSpace(token)),
+		jwxjwt.WithKeySet(set),
+		jwxjwt.WithValidate(true),
+	)
+}
+
+// PublicKeys возвращает открытые ключи для JWKS. Общий секрет не
+// публикуется, поэтому для HS256 набор пуст
+func (r *KeyRing) PublicKeys() (jwk.Set, error) {
+	set := jwk.NewSet()
+	for _, k := range r.Valid() {
+		if k.publicKey == nil {
+			continue
+		}
+		if err := set.AddKey(k.publicKey); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
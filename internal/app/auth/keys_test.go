@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustKey(t *testing.T, id, alg string, activeFrom time.Time) *Key {
+	t.Helper()
+	var private any
+	var err error
+	if alg == AlgHS256 {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		private = secret
+	} else {
+		private, err = generatePrivateKey(alg)
+	}
+	require.NoError(t, err)
+	key, err := NewKey(id, private, activeFrom)
+	require.NoError(t, err)
+	return key
+}
+
+func sign(t *testing.T, ring *KeyRing) string {
+	t.Helper()
+	claims, err := NewClaims(&models.User{ID: 1, Username: "nikita"}, "session", time.Hour)
+	require.NoError(t, err)
+	token, err := ring.Sign(claims)
+	require.NoError(t, err)
+	return token
+}
+
+// часы, которые двигает тест
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestSignVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ring, err := NewKeyRing(time.Hour, mustKey(t, "k1", alg, time.Time{}))
+			require.NoError(t, err)
+			token, err := ring.Verify(sign(t, ring))
+			require.NoError(t, err)
+			assert.Equal(t, "session", token.PrivateClaims()["sid"])
+			assert.NotEmpty(t, token.JwtID())
+
+			// чужой ключ с тем же kid подпись не проверит
+			other, err := NewKeyRing(time.Hour, mustKey(t, "k1", alg, time.Time{}))
+			require.NoError(t, err)
+			_, err = other.Verify(sign(t, ring))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifyRejectsForgedHeader(t *testing.T) {
+	key := mustKey(t, "k1", AlgRS256, time.Time{})
+	ring, err := NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+	claims, err := NewClaims(&models.User{ID: 1}, "session", time.Hour)
+	require.NoError(t, err)
+
+	// без kid
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key.signKey)
+	require.NoError(t, err)
+	_, err = ring.Verify(token)
+	assert.Error(t, err)
+
+	// HS256 с открытым ключом вместо секрета
+	public, err := x509.MarshalPKIXPublicKey(&key.signKey.(*rsa.PrivateKey).PublicKey)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "k1"
+	token, err = forged.SignedString(public)
+	require.NoError(t, err)
+	_, err = ring.Verify(token)
+	assert.Error(t, err)
+
+	// истекший
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	token, err = ring.Sign(claims)
+	require.NoError(t, err)
+	_, err = ring.Verify(token)
+	assert.Error(t, err)
+}
+
+func TestNewKeyRejectsWeakRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewKey("k1", private, time.Time{})
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestRotationGracePeriod(t *testing.T) {
+	start := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	c := &clock{now: start}
+	old := mustKey(t, "old", AlgEdDSA, start)
+	ring, err := NewKeyRing(time.Hour, old)
+	require.NoError(t, err)
+	ring.now = c.Now
+	oldToken := sign(t, ring)
+
+	// новый ключ заранее публикуется, но пока не подписывает
+	require.NoError(t, ring.SetKeys([]*Key{old, mustKey(t, "new", AlgEdDSA, start.Add(10*time.Minute))}))
+	current, err := ring.Current()
+	require.NoError(t, err)
+	assert.Equal(t, "old", current.ID)
+	assert.Len(t, ring.Valid(), 2)
+
+	c.now = start.Add(10 * time.Minute)
+	current, err = ring.Current()
+	require.NoError(t, err)
+	assert.Equal(t, "new", current.ID)
+	_, err = ring.Verify(oldToken)
+	assert.NoError(t, err, "old key is accepted during the grace period")
+	assert.Empty(t, ring.Expired())
+
+	c.now = start.Add(70 * time.Minute)
+	_, err = ring.Verify(oldToken)
+	assert.Error(t, err)
+	assert.Len(t, ring.Valid(), 1)
+	require.Len(t, ring.Expired(), 1)
+	assert.Equal(t, "old", ring.Expired()[0].ID)
+	set, err := ring.PublicKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 1, set.Len())
+}
+
+func TestPublicKeys(t *testing.T) {
+	now := time.Now()
+	ring, err := NewKeyRing(
+		time.Hour,
+		mustKey(t, "secret", AlgHS256, now.Add(-2*time.Minute)),
+		mustKey(t, "rsa", AlgRS256, now.Add(-time.Minute)),
+		mustKey(t, "ed", AlgEdDSA, now.Add(time.Minute)),
+	)
+	require.NoError(t, err)
+	set, err := ring.PublicKeys()
+	require.NoError(t, err)
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	var jwks struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(data, &jwks))
+	// общий секрет не публикуется, закрытые части ключей - тоже
+	require.Len(t, jwks.Keys, 2)
+	for _, k := range jwks.Keys {
+		assert.Contains(t, []string{"rsa", "ed"}, k["kid"])
+		assert.Equal(t, "sig", k["use"])
+		assert.NotContains(t, k, "d")
+	}
+}
+
+func TestKeyDir(t *testing.T) {
+	dir := KeyDir(t.TempDir())
+	activeFrom := time.Now().Add(-time.Hour).Truncate(time.Second)
+	key := mustKey(t, "k1", AlgEdDSA, activeFrom)
+	require.NoError(t, dir.Add(key))
+
+	// ключ RSA в PKCS#1, как его создает openssl genrsa -traditional
+	private, err := generatePrivateKey(AlgRS256)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(private.(*rsa.PrivateKey)),
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(string(dir), "k2.pem"), data, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(string(dir), "README"), []byte("not a key"), 0o600))
+
+	keys, err := dir.Load()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "k1", keys[0].ID)
+	assert.Equal(t, AlgEdDSA, keys[0].Algorithm)
+	assert.True(t, activeFrom.Equal(keys[0].ActiveFrom))
+	assert.Equal(t, "k2", keys[1].ID)
+	assert.Equal(t, AlgRS256, keys[1].Algorithm)
+
+	// подпись ключом из файла проверяется исходным ключом
+	ring, err := NewKeyRing(time.Hour, keys[0])
+	require.NoError(t, err)
+	original, err := NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+	_, err = original.Verify(sign(t, ring))
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(string(dir), "bad.pem"), []byte("garbage"), 0o600))
+	_, err = dir.Load()
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestRotation(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	c := &clock{now: start}
+	ring, err := NewKeyRing(time.Hour)
+	require.NoError(t, err)
+	ring.now = c.Now
+	rotation := Rotation{
+		Dir:       KeyDir(t.TempDir()),
+		Algorithm: AlgEdDSA,
+		Interval:  24 * time.Hour,
+		Delay:     time.Minute,
+	}
+
+	// в пустом каталоге сразу появляется действующий ключ
+	require.NoError(t, rotation.Reload(ring))
+	first, err := ring.Current()
+	require.NoError(t, err)
+	require.NoError(t, rotation.Reload(ring))
+	assert.Len(t, ring.Valid(), 1)
+
+	// новый ключ выпускается за Delay до срока
+	c.now = start.Add(24*time.Hour - time.Minute)
+	require.NoError(t, rotation.Reload(ring))
+	require.Len(t, ring.Valid(), 2)
+	current, err := ring.Current()
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, current.ID)
+
+	c.now = start.Add(24 * time.Hour)
+	current, err = ring.Current()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, current.ID)
+
+	// после льготного периода файл старого ключа удаляется
+	c.now = start.Add(25 * time.Hour)
+	require.NoError(t, rotation.Reload(ring))
+	keys, err := rotation.Dir.Load()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, current.ID, keys[0].ID)
+}
+
+func TestRotationEmptyDir(t *testing.T) {
+	ring, err := NewKeyRing(time.Hour)
+	require.NoError(t, err)
+	err = Rotation{Dir: KeyDir(t.TempDir())}.Reload(ring)
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
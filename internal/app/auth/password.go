@@ -3,21 +3,276 @@ package auth
 import (
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// схемы хэширования паролей, из которых можно выбрать PASSWORD_HASH
+const (
+	SchemeArgon2id = "argon2id"
+	SchemeBcrypt   = "bcrypt"
+	// двойной md5 с солью - только для проверки старых хэшей
+	SchemeLegacyMD5 = "md5"
 )
 
+// ErrUnknownHashFormat - хэш сделан неизвестной схемой или поврежден
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
 const saltBytes = 16
 
-func GenerateSalt() (string, error) {
+// Scheme - одна схема хэширования. Хэши кодируются в формате PHC
+// ($схема$параметры$соль$хэш), поэтому соль и параметры хранятся вместе с
+// хэшем, и их можно менять, не трогая уже сохраненные пароли
+type Scheme interface {
+	Name() string
+	// Match проверяет, что encoded сделан этой схемой
+	Match(encoded string) bool
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Current проверяет, что encoded сделан с текущими параметрами схемы
+	Current(encoded string) bool
+}
+
+// Hasher хэширует новые пароли выбранной схемой и проверяет хэши всех
+// известных схем
+type Hasher struct {
+	preferred Scheme
+	known     []Scheme
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHasher создает Hasher, который хэширует пароли схемой preferred
+func NewHasher(preferred Scheme) *Hasher {
+	return &Hasher{
+		preferred: preferred,
+		known:     []Scheme{preferred, DefaultArgon2id, DefaultBcrypt, LegacyMD5{}},
+	}
+}
+
+// NewHasherByName создает Hasher для схемы из настроек
+func NewHasherByName(name string) (*Hasher, error) {
+	switch name {
+	case SchemeArgon2id:
+		return NewHasher(DefaultArgon2id), nil
+	case SchemeBcrypt:
+		return NewHasher(DefaultBcrypt), nil
+	}
+	return nil, fmt.Errorf("unknown password hash scheme %q", name)
+}
+
+// MaxPasswordBytes - самый длинный пароль, который схема новых хэшей
+// различает целиком; 0 - без ограничения. Более длинные пароли надо
+// отклонять политикой
+func (h *Hasher) MaxPasswordBytes() int {
+	if _, ok := h.preferred.(Bcrypt); ok {
+		return BcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify проверяет пароль. rehash - пароль верный, но хэш сделан другой
+// схемой или с другими параметрами: его стоит заменить на Hash(password)
+func (h *Hasher) Verify(password, encoded string) (ok, rehash bool, err error) {
+	for _, s := range h.known {
+		if !s.Match(encoded) {
+			continue
+		}
+		ok, err := s.Verify(password, encoded)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, s.Name() != h.preferred.Name() || !h.preferred.Current(encoded), nil
+	}
+	return false, false, ErrUnknownHashFormat
+}
+
+// VerifyDummy тратит на проверку столько же, сколько Verify с хэшем
+// основной схемы. Вызывается, когда пользователя нет: по времени ответа
+// нельзя будет понять, существует ли логин
+func (h *Hasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		salt, err := generateSalt()
+		if err == nil {
+			h.dummy, _ = h.preferred.Hash(base64.RawStdEncoding.EncodeToString(salt))
+		}
+	})
+	if h.dummy != "" {
+		h.preferred.Verify(password, h.dummy)
+	}
+}
+
+func generateSalt() ([]byte, error) {
 	salt := make([]byte, saltBytes)
-	_, err := rand.Read(salt)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Argon2id - схема по умолчанию:
+// $argon2id$v=19$m=<KiB>,t=<проходы>,p=<потоки>$<соль>$<хэш>
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+}
+
+// DefaultArgon2id - параметры из рекомендаций OWASP
+var DefaultArgon2id = Argon2id{Time: 2, Memory: 19 * 1024, Threads: 1, KeyLen: 32}
+
+func (a Argon2id) Name() string {
+	return SchemeArgon2id
+}
+
+func (a Argon2id) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt, err := generateSalt()
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(salt), nil
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.Memory,
+		a.Time,
+		a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (a Argon2id) Current(encoded string) bool {
+	params, _, key, err := parseArgon2id(encoded)
+	return err == nil &&
+		params.Time == a.Time &&
+		params.Memory == a.Memory &&
+		params.Threads == a.Threads &&
+		uint32(len(key)) == a.KeyLen
+}
+
+func parseArgon2id(encoded string) (params Argon2id, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хэш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != SchemeArgon2id {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: argon2 version %v", ErrUnknownHashFormat, parts[2])
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, fmt.Errorf("%w: argon2 parameters %v", ErrUnknownHashFormat, parts[3])
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: bad argon2 key", ErrUnknownHashFormat)
+	}
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptMaxPasswordBytes - bcrypt учитывает только первые 72 байта пароля
+const BcryptMaxPasswordBytes = 72
+
+// Bcrypt - bcrypt в собственном формате $2a$<cost>$<соль и хэш>. Пароли
+// длиннее BcryptMaxPasswordBytes bcrypt не принимает
+type Bcrypt struct {
+	Cost int
+}
+
+var DefaultBcrypt = Bcrypt{Cost: bcrypt.DefaultCost}
+
+func (b Bcrypt) Name() string {
+	return SchemeBcrypt
+}
+
+func (b Bcrypt) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	return true, nil
+}
+
+func (b Bcrypt) Current(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.Cost
+}
+
+// LegacyMD5 - прежняя схема: md5(md5(пароль) + соль), после миграции
+// хранится как $md5$<соль>$<хэш>. Новые пароли ею не хэшируются
+type LegacyMD5 struct{}
+
+func (LegacyMD5) Name() string {
+	return SchemeLegacyMD5
+}
+
+func (LegacyMD5) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$md5$")
+}
+
+func (LegacyMD5) Hash(password string) (string, error) {
+	return "", errors.New("md5 password hashes are verify-only")
+}
+
+func (LegacyMD5) Verify(password, encoded string) (bool, error) {
+	// "", "md5", соль, хэш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return false, ErrUnknownHashFormat
+	}
+	actual := legacyMD5Hash(password, parts[2])
+	return subtle.ConstantTimeCompare([]byte(actual), []byte(parts[3])) == 1, nil
+}
+
+func (LegacyMD5) Current(encoded string) bool {
+	return false
 }
 
-func GenerateHash(password, salt string) string {
+func legacyMD5Hash(password, salt string) string {
 	pwdSum := md5.Sum([]byte(password))
 	pwdSaltSum := md5.Sum(append(pwdSum[:], []byte(salt)...))
 	return base64.StdEncoding.EncodeToString(pwdSaltSum[:])
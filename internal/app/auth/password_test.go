@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// дешевые параметры, чтобы тесты не тормозили
+var (
+	testArgon2id = Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 16}
+	testBcrypt   = Bcrypt{Cost: bcrypt.MinCost}
+)
+
+func TestHashVerify(t *testing.T) {
+	for _, scheme := range []Scheme{testArgon2id, testBcrypt} {
+		t.Run(scheme.Name(), func(t *testing.T) {
+			h := NewHasher(scheme)
+			hash, err := h.Hash("secret")
+			require.NoError(t, err)
+			assert.True(t, scheme.Match(hash))
+
+			ok, rehash, err := h.Verify("secret", hash)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, rehash)
+
+			ok, _, err = h.Verify("Secret", hash)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			// соль случайная - хэши одного пароля различаются
+			other, err := h.Hash("secret")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other)
+		})
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	hash, err := testArgon2id.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+	params, salt, key, err := parseArgon2id(hash)
+	require.NoError(t, err)
+	assert.Equal(t, testArgon2id, params)
+	assert.Len(t, salt, saltBytes)
+	assert.Len(t, key, 16)
+
+	for _, bad := range []string{
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+	} {
+		_, _, err := NewHasher(testArgon2id).Verify("secret", bad)
+		assert.ErrorIs(t, err, ErrUnknownHashFormat, bad)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	h := NewHasher(testArgon2id)
+
+	legacy := "$md5$456$" + legacyMD5Hash("secret", "456")
+	ok, rehash, err := h.Verify("secret", legacy)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	ok, rehash, err = h.Verify("wrong", legacy)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+
+	// другая схема и другие параметры той же схемы
+	bcryptHash, err := testBcrypt.Hash("secret")
+	require.NoError(t, err)
+	stronger := testArgon2id
+	stronger.Time = 2
+	strongerHash, err := stronger.Hash("secret")
+	require.NoError(t, err)
+	for _, hash := range []string{bcryptHash, strongerHash} {
+		ok, rehash, err := h.Verify("secret", hash)
+		require.NoError(t, err)
+		assert.True(t, ok, hash)
+		assert.True(t, rehash, hash)
+	}
+
+	_, _, err = h.Verify("secret", "plain-text")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+}
+
+func TestNewHasherByName(t *testing.T) {
+	for _, name := range []string{SchemeArgon2id, SchemeBcrypt} {
+		h, err := NewHasherByName(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, h.preferred.Name())
+	}
+	_, err := NewHasherByName(SchemeLegacyMD5)
+	assert.Error(t, err)
+}
+
+func TestMaxPasswordBytes(t *testing.T) {
+	assert.Equal(t, 0, NewHasher(DefaultArgon2id).MaxPasswordBytes())
+	assert.Equal(t, BcryptMaxPasswordBytes, NewHasher(DefaultBcrypt).MaxPasswordBytes())
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrWeakPassword - пароль не подходит под политику
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// PasswordPolicy - требования к новым паролям при регистрации и смене.
+// Нулевое значение ничего не требует
+type PasswordPolicy struct {
+	// длина в символах; 0 - без ограничения
+	MinLength int
+	MaxLength int
+	// длина в байтах UTF-8; 0 - без ограничения. Нужна схемам, которые
+	// учитывают только начало пароля (см. Hasher.MaxPasswordBytes)
+	MaxBytes int
+	// сколько разных классов символов нужно: строчные, заглавные буквы,
+	// цифры, остальное
+	MinCharClasses int
+	// пароль не может совпадать с логином
+	ForbidLogin bool
+}
+
+// Check проверяет пароль password пользователя login. Ошибка объясняет, что
+// не так, но сам пароль не содержит
+func (p PasswordPolicy) Check(login, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: at least %v characters required", ErrWeakPassword, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: at most %v characters allowed", ErrWeakPassword, p.MaxLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("%w: at most %v bytes allowed", ErrWeakPassword, p.MaxBytes)
+	}
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		return fmt.Errorf(
+			"%w: characters of %v classes required (lowercase, uppercase, digits, other)",
+			ErrWeakPassword,
+			p.MinCharClasses,
+		)
+	}
+	if p.ForbidLogin && strings.EqualFold(password, login) {
+		return fmt.Errorf("%w: password must differ from login", ErrWeakPassword)
+	}
+	return nil
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 16, MinCharClasses: 3, ForbidLogin: true}
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{password: "Secret-1", ok: true},
+		{password: "Пароль-123", ok: true},
+		{password: "Se-1", ok: false},
+		{password: "secret-password", ok: false},
+		{password: "Secret-1Secret-1Secret-1", ok: false},
+		{password: "Nikita-1", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Check("nikita-1", tt.password)
+			if tt.ok {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrWeakPassword)
+			assert.NotContains(t, err.Error(), tt.password)
+		})
+	}
+	// кириллица - два байта на символ
+	policy = PasswordPolicy{MaxLength: 128, MaxBytes: 72}
+	assert.NoError(t, policy.Check("nikita", strings.Repeat("п", 36)))
+	assert.ErrorIs(t, policy.Check("nikita", strings.Repeat("п", 37)), ErrWeakPassword)
+
+	// нулевая политика ничего не требует
+	assert.NoError(t, PasswordPolicy{}.Check("nikita", "nikita"))
+}
@@ -7,19 +7,35 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func GenerateJWTToken(
+// NewClaims создает содержимое access-токена сессии sessionID с новым jti
+func NewClaims(
 	user *models.User,
-	signingKey []byte,
+	sessionID string,
 	expireDuration time.Duration,
-) *jwt.Token {
-	claims := Claims{
+) (*Claims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expireDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: sessionID,
+	}, nil
+}
+
+// Sign подписывает токен текущим ключом и указывает его в заголовке kid
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	key, err := r.Current()
+	if err != nil {
+		return "", err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
 }
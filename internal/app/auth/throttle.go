@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrTooManyAttempts - вход временно запрещен из-за неудачных попыток
+var ErrTooManyAttempts = errors.New("too many login attempts")
+
+// TooManyAttemptsError сообщает, когда можно попробовать снова
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ErrTooManyAttempts, e.RetryAfter)
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// AttemptLimits - пороги неудачных попыток для одного логина или адреса
+type AttemptLimits struct {
+	// столько неудач подряд проходят без задержки
+	Free int
+	// после стольких неудач вход блокируется на LockoutDuration
+	Lockout int
+}
+
+type ThrottleConfig struct {
+	Login AttemptLimits
+	IP    AttemptLimits
+	// задержка после первой неудачи сверх Free; каждая следующая удваивает
+	// ее, но не больше MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// на сколько блокируется вход после Lockout неудач. Неудачи забываются,
+	// если после последней из них и конца паузы прошло еще LockoutDuration;
+	// до этого каждая новая неудача снова блокирует вход
+	LockoutDuration time.Duration
+}
+
+type attempts struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	// по логину идет попытка: параллельные попытки не пропускаем, иначе
+	// пачка одновременных запросов обошла бы задержку
+	inFlight bool
+}
+
+// LoginThrottle ограничивает подбор паролей: считает неудачные входы по
+// логину и по адресу клиента, после нескольких неудач требует паузу, которая
+// растет с каждой следующей, а затем блокирует вход на время. Успешный вход
+// обнуляет счетчик логина, но не адреса: иначе свой аккаунт помог бы
+// подбирать чужие. Состояние хранится в памяти процесса
+type LoginThrottle struct {
+	mu        sync.Mutex
+	cfg       ThrottleConfig
+	logins    map[string]*attempts
+	ips       map[string]*attempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLoginThrottle(cfg ThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		cfg:    cfg,
+		logins: make(map[string]*attempts),
+		ips:    make(map[string]*attempts),
+		now:    time.Now,
+	}
+}
+
+// LoginAttempt - разрешенная попытка входа. Ее результат сообщается ровно
+// одним из методов Fail, Succeed или Abort
+type LoginAttempt struct {
+	throttle *LoginThrottle
+	login    string
+	ip       string
+}
+
+// Begin разрешает попытку входа или возвращает *TooManyAttemptsError
+func (t *LoginThrottle) Begin(login, ip string) (*LoginAttempt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.sweep(now)
+	byLogin := t.record(t.logins, login, now)
+	byIP := t.record(t.ips, ip, now)
+	var wait time.Duration
+	for _, a := range []*attempts{byLogin, byIP} {
+		if d := a.blockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 && byLogin.inFlight {
+		wait = time.Second
+	}
+	if wait > 0 {
+		return nil, &TooManyAttemptsError{RetryAfter: wait}
+	}
+	byLogin.inFlight = true
+	return &LoginAttempt{throttle: t, login: login, ip: ip}, nil
+}
+
+// Fail учитывает неудачную попытку
+func (a *LoginAttempt) Fail() {
+	t := a.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	byLogin := t.record(t.logins, a.login, now)
+	byLogin.inFlight = false
+	if t.fail(byLogin, t.cfg.Login, now) {
+		log.Printf("Login %q locked for %v after %v failed attempts", a.login, t.cfg.LockoutDuration, byLogin.failures)
+	}
+	if t.fail(t.record(t.ips, a.ip, now), t.cfg.IP, now) {
+		log.Printf("Logins from %v locked for %v", a.ip, t.cfg.LockoutDuration)
+	}
+}
+
+// Succeed обнуляет неудачи логина
+func (a *LoginAttempt) Succeed() {
+	t := a.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.logins, a.login)
+}
+
+// Abort завершает попытку, которая не дошла до проверки пароля, например
+// из-за ошибки хранилища; она не считается неудачной
+func (a *LoginAttempt) Abort() {
+	t := a.throttle
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if byLogin, ok := t.logins[a.login]; ok {
+		byLogin.inFlight = false
+	}
+}
+
+func (t *LoginThrottle) record(m map[string]*attempts, key string, now time.Time) *attempts {
+	a, ok := m[key]
+	if !ok || t.forgotten(a, now) {
+		a = &attempts{}
+		m[key] = a
+	}
+	return a
+}
+
+// forgotten сообщает, что неудачи давно не повторялись и их можно забыть
+func (t *LoginThrottle) forgotten(a *attempts, now time.Time) bool {
+	last := a.lastFailure
+	if a.blockedUntil.After(last) {
+		last = a.blockedUntil
+	}
+	return !a.inFlight && !now.Before(last.Add(t.cfg.LockoutDuration))
+}
+
+// fail учитывает неудачу и назначает паузу; true - вход заблокирован
+func (t *LoginThrottle) fail(a *attempts, limits AttemptLimits, now time.Time) bool {
+	a.failures++
+	a.lastFailure = now
+	switch {
+	case limits.Lockout > 0 && a.failures >= limits.Lockout:
+		a.blockedUntil = now.Add(t.cfg.LockoutDuration)
+		return true
+	case a.failures > limits.Free:
+		a.blockedUntil = now.Add(t.delay(a.failures - limits.Free))
+	}
+	return false
+}
+
+// delay - пауза после n-й неудачи сверх бесплатных
+func (t *LoginThrottle) delay(n int) time.Duration {
+	d := t.cfg.BaseDelay
+	for i := 1; i < n && d < t.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > t.cfg.MaxDelay {
+		d = t.cfg.MaxDelay
+	}
+	return d
+}
+
+// sweep раз в LockoutDuration удаляет забытые записи, чтобы перебор
+// случайных логинов не занимал память бесконечно
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Before(t.lastSweep.Add(t.cfg.LockoutDuration)) {
+		return
+	}
+	t.lastSweep = now
+	for _, m := range []map[string]*attempts{t.logins, t.ips} {
+		for key, a := range m {
+			if t.forgotten(a, now) {
+				delete(m, key)
+			}
+		}
+	}
+}
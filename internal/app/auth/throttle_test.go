@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeClockThrottle(cfg ThrottleConfig) (*LoginThrottle, *time.Time) {
+	now := time.Date(2022, time.December, 1, 12, 0, 0, 0, time.UTC)
+	t := NewLoginThrottle(cfg)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+var testThrottle = ThrottleConfig{
+	Login:           AttemptLimits{Free: 2, Lockout: 5},
+	IP:              AttemptLimits{Free: 4, Lockout: 8},
+	BaseDelay:       time.Second,
+	MaxDelay:        4 * time.Second,
+	LockoutDuration: time.Minute,
+}
+
+// retryAfter возвращает паузу из ошибки Begin или 0, если попытка разрешена
+func retryAfter(t *testing.T, throttle *LoginThrottle, login, ip string) (*LoginAttempt, time.Duration) {
+	t.Helper()
+	attempt, err := throttle.Begin(login, ip)
+	if err == nil {
+		return attempt, 0
+	}
+	require.ErrorIs(t, err, ErrTooManyAttempts)
+	var tooMany *TooManyAttemptsError
+	require.True(t, errors.As(err, &tooMany))
+	return nil, tooMany.RetryAfter
+}
+
+// check проверяет, разрешен ли вход, не занимая попытку
+func check(t *testing.T, throttle *LoginThrottle, login, ip string) time.Duration {
+	t.Helper()
+	attempt, wait := retryAfter(t, throttle, login, ip)
+	if attempt != nil {
+		attempt.Abort()
+	}
+	return wait
+}
+
+func TestThrottleProgressiveDelay(t *testing.T) {
+	throttle, now := newFakeClockThrottle(testThrottle)
+	// две бесплатные неудачи, затем пауза 1s, 2s, 4s (не больше MaxDelay)
+	// и блокировка на пятой
+	for i, expected := range []time.Duration{0, 0, time.Second, 2 * time.Second, time.Minute} {
+		attempt, wait := retryAfter(t, throttle, "nikita", "10.0.0.1")
+		require.Zero(t, wait, "attempt %v", i+1)
+		attempt.Fail()
+		wait = check(t, throttle, "nikita", "10.0.0.1")
+		assert.Equal(t, expected, wait, "after failure %v", i+1)
+		*now = now.Add(wait)
+	}
+
+	// после блокировки каждая неудача блокирует снова
+	attempt, wait := retryAfter(t, throttle, "nikita", "10.0.0.1")
+	require.Zero(t, wait)
+	attempt.Fail()
+	wait = check(t, throttle, "nikita", "10.0.0.1")
+	assert.Equal(t, time.Minute, wait)
+
+	// пока не пройдет LockoutDuration без неудач
+	*now = now.Add(2 * time.Minute)
+	attempt, wait = retryAfter(t, throttle, "nikita", "10.0.0.1")
+	require.Zero(t, wait)
+	attempt.Fail()
+	wait = check(t, throttle, "nikita", "10.0.0.1")
+	assert.Zero(t, wait)
+}
+
+func TestThrottleSuccessResetsLoginOnly(t *testing.T) {
+	throttle, _ := newFakeClockThrottle(testThrottle)
+	for _, login := range []string{"a", "b", "c", "mine"} {
+		attempt, wait := retryAfter(t, throttle, login, "10.0.0.1")
+		require.Zero(t, wait)
+		attempt.Fail()
+	}
+	attempt, wait := retryAfter(t, throttle, "mine", "10.0.0.1")
+	require.Zero(t, wait)
+	attempt.Succeed()
+
+	// адрес подбирает пароли к разным логинам: пятая неудача с него
+	// требует паузу, хотя у каждого логина неудач мало
+	attempt, wait = retryAfter(t, throttle, "d", "10.0.0.1")
+	require.Zero(t, wait)
+	attempt.Fail()
+	wait = check(t, throttle, "e", "10.0.0.1")
+	assert.Equal(t, time.Second, wait)
+	// с другого адреса вход свободен
+	wait = check(t, throttle, "e", "10.0.0.2")
+	assert.Zero(t, wait)
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	throttle, _ := newFakeClockThrottle(testThrottle)
+	attempt, wait := retryAfter(t, throttle, "nikita", "10.0.0.1")
+	require.Zero(t, wait)
+	wait = check(t, throttle, "nikita", "10.0.0.2")
+	assert.Equal(t, time.Second, wait)
+
+	// прерванная попытка не считается неудачной
+	attempt.Abort()
+	for i := 0; i < testThrottle.Login.Free; i++ {
+		attempt, wait = retryAfter(t, throttle, "nikita", "10.0.0.1")
+		require.Zero(t, wait)
+		attempt.Fail()
+	}
+	wait = check(t, throttle, "nikita", "10.0.0.1")
+	assert.Zero(t, wait)
+}
+
+func TestThrottleSweep(t *testing.T) {
+	throttle, now := newFakeClockThrottle(testThrottle)
+	for _, login := range []string{"a", "b", "c"} {
+		attempt, _ := retryAfter(t, throttle, login, "10.0.0.1")
+		attempt.Fail()
+	}
+	*now = now.Add(2 * time.Minute)
+	wait := check(t, throttle, "d", "10.0.0.2")
+	require.Zero(t, wait)
+	// остались только записи текущей попытки
+	assert.Len(t, throttle.logins, 1)
+	assert.Len(t, throttle.ips, 1)
+}
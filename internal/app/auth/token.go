@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	tokenIDBytes     = 16
+	opaqueTokenBytes = 32
+)
+
+// NewTokenID возвращает случайный идентификатор для jti и сессий
+func NewTokenID() (string, error) {
+	id := make([]byte, tokenIDBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// NewOpaqueToken возвращает новый случайный токен (refresh-токен, токен
+// сброса пароля) и его хэш. Клиент получает сам токен, в БД сохраняется
+// только хэш
+func NewOpaqueToken() (token, hash string, err error) {
+	raw := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken - хэш, под которым токен хранится в БД. У токена 256 бит
+// случайности, поэтому медленный хэш, как для паролей, не нужен
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
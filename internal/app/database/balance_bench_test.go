@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtest"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+)
+
+// так баланс считается по журналу - агрегатом по всем проводкам пользователя
+const ledgerBalanceSQL = `
+SELECT COALESCE(SUM(p.amount), 0)::BIGINT AS balance,
+	(-COALESCE(SUM(CASE WHEN e.kind IN ('WITHDRAWAL', 'REFUND') THEN p.amount END), 0))::BIGINT
+		AS withdrawn
+FROM Posting p
+JOIN JournalEntry e ON e.id = p.entry_id
+WHERE p.account_id = $1;
+`
+
+// setupHeavyUser создает пользователя с nOrders начисленными заказами
+func setupHeavyUser(b *testing.B, nOrders int) (*DatabaseService, int) {
+	b.Helper()
+	ctx := context.Background()
+	db := &DatabaseService{conn: dbtest.Connect(b)}
+	user, err := db.AddUser(ctx, "heavy", "123")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < nOrders; i++ {
+		orderID := fmt.Sprintf("%v", i)
+		if err := db.AddOrder(ctx, orderID, user.ID); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.AddAccrualRecord(ctx, orderID, money.FromUnits(1)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return db, user.ID
+}
+
+func BenchmarkGetBalance(b *testing.B) {
+	for _, nOrders := range []int{10, 1000, 10000} {
+		db, userID := setupHeavyUser(b, nOrders)
+		ctx := context.Background()
+
+		b.Run(fmt.Sprintf("table/orders=%v", nOrders), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.GetBalance(ctx, userID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("ledger/orders=%v", nOrders), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				balance := models.Balance{}
+				err := db.conn.QueryRow(ctx, ledgerBalanceSQL, ledger.UserAccount(userID)).
+					Scan(&balance.Current, &balance.Withdrawn)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,777 @@
+// Package conformance - общие тесты реализаций database.Service и
+// ordertracker.Tracker. Хранилища на Postgres и в памяти прогоняют один и тот
+// же набор, поэтому ведут себя одинаково, включая ошибки.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/suite"
+)
+
+// TestLease - срок аренды задач в тестах очереди
+const TestLease = 200 * time.Millisecond
+
+// Factory создает пустое хранилище для одного теста; policy и lease
+// настраивают его очередь
+type Factory func(t *testing.T, policy ordertracker.RetryPolicy, lease time.Duration) database.Service
+
+// Run прогоняет все тесты на хранилищах из newService
+func Run(t *testing.T, newService Factory) {
+	t.Run("Service", func(t *testing.T) {
+		suite.Run(t, &ServiceSuite{newService: newService})
+	})
+	t.Run("Tracker", func(t *testing.T) {
+		suite.Run(t, &TrackerSuite{newService: newService})
+	})
+}
+
+// ServiceSuite проверяет database.Service; в каждом тесте есть пользователь
+// с заказом "18", поставленным в очередь
+type ServiceSuite struct {
+	suite.Suite
+	newService Factory
+	db         database.Service
+	ctx        context.Context
+	userID     int
+}
+
+func (suite *ServiceSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.db = suite.newService(suite.T(), ordertracker.RetryPolicy{}, time.Minute)
+	user, err := suite.db.AddUser(suite.ctx, "nikita", "123")
+	suite.Require().NoError(err)
+	suite.userID = user.ID
+	suite.Require().NoError(suite.db.AddOrder(suite.ctx, "18", suite.userID))
+	suite.Require().NoError(suite.db.Tracker().Add(suite.ctx, "18"))
+}
+
+func (suite *ServiceSuite) balance() models.Balance {
+	balance, err := suite.db.GetBalance(suite.ctx, suite.userID)
+	suite.Require().NoError(err)
+	return *balance
+}
+
+func (suite *ServiceSuite) TestUsers() {
+	_, err := suite.db.AddUser(suite.ctx, "nikita", "456")
+	suite.ErrorIs(err, database.ErrUserAlreadyExists)
+
+	// хэширует пароль вызывающий - хранилище сохраняет то, что получило
+	user, err := suite.db.FindUser(suite.ctx, "nikita")
+	suite.Require().NoError(err)
+	suite.Equal(suite.userID, user.ID)
+	suite.Equal("123", user.HashedPassword)
+
+	other, err := suite.db.AddUser(suite.ctx, "other", "123")
+	suite.Require().NoError(err)
+	suite.NotEqual(suite.userID, other.ID)
+
+	_, err = suite.db.FindUser(suite.ctx, "nobody")
+	suite.ErrorIs(err, database.ErrUserNotFound)
+}
+
+func (suite *ServiceSuite) TestUpdatePasswordHash() {
+	suite.Require().NoError(suite.db.UpdatePasswordHash(suite.ctx, suite.userID, "123", "$new$"))
+	user, err := suite.db.FindUser(suite.ctx, "nikita")
+	suite.Require().NoError(err)
+	suite.Equal("$new$", user.HashedPassword)
+
+	// хэш уже поменяли - устаревшая замена не применяется
+	suite.Require().NoError(suite.db.UpdatePasswordHash(suite.ctx, suite.userID, "123", "$stale$"))
+	user, err = suite.db.FindUser(suite.ctx, "nikita")
+	suite.Require().NoError(err)
+	suite.Equal("$new$", user.HashedPassword)
+}
+
+func (suite *ServiceSuite) TestSetPasswordHash() {
+	suite.Require().NoError(suite.db.SetPasswordHash(suite.ctx, suite.userID, "$new$"))
+	user, err := suite.db.FindUserByID(suite.ctx, suite.userID)
+	suite.Require().NoError(err)
+	suite.Equal("nikita", user.Username)
+	suite.Equal("$new$", user.HashedPassword)
+
+	_, err = suite.db.FindUserByID(suite.ctx, suite.userID+100)
+	suite.ErrorIs(err, database.ErrUserNotFound)
+	err = suite.db.SetPasswordHash(suite.ctx, suite.userID+100, "$new$")
+	suite.ErrorIs(err, database.ErrUserNotFound)
+}
+
+func (suite *ServiceSuite) newSession(id, refreshHash string) models.Session {
+	session := models.Session{ID: id, UserID: suite.userID, Username: "nikita"}
+	suite.Require().NoError(suite.db.CreateSession(suite.ctx, session, refreshHash, time.Hour))
+	return session
+}
+
+func (suite *ServiceSuite) TestRotateRefreshToken() {
+	session := suite.newSession("s1", "r1")
+
+	rotated, err := suite.db.RotateRefreshToken(suite.ctx, "r1", "r2", time.Hour)
+	suite.Require().NoError(err)
+	suite.Equal(session, *rotated)
+	rotated, err = suite.db.RotateRefreshToken(suite.ctx, "r2", "r3", time.Hour)
+	suite.Require().NoError(err)
+	suite.Equal(session, *rotated)
+
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "unknown", "r4", time.Hour)
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+	// истекший токен неотличим от неизвестного
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "r3", "expired-next", -time.Second)
+	suite.Require().NoError(err)
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "expired-next", "r5", time.Hour)
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+}
+
+// повторное использование refresh-токена отзывает всю сессию: и новые
+// refresh-токены, и access-токены
+func (suite *ServiceSuite) TestRefreshTokenReuse() {
+	suite.newSession("s1", "r1")
+	other := suite.newSession("s2", "o1")
+	_, err := suite.db.RotateRefreshToken(suite.ctx, "r1", "r2", time.Hour)
+	suite.Require().NoError(err)
+
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "r1", "stolen", time.Hour)
+	suite.ErrorIs(err, database.ErrTokenReused)
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "r2", "r3", time.Hour)
+	suite.ErrorIs(err, database.ErrTokenRevoked)
+	revoked, err := suite.db.IsAccessTokenRevoked(suite.ctx, "jti", "s1")
+	suite.Require().NoError(err)
+	suite.True(revoked)
+
+	// другие сессии пользователя не затронуты
+	revoked, err = suite.db.IsAccessTokenRevoked(suite.ctx, "jti", other.ID)
+	suite.Require().NoError(err)
+	suite.False(revoked)
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "o1", "o2", time.Hour)
+	suite.NoError(err)
+}
+
+func (suite *ServiceSuite) TestRevokeTokens() {
+	suite.newSession("s1", "r1")
+	revoked, err := suite.db.IsAccessTokenRevoked(suite.ctx, "jti1", "s1")
+	suite.Require().NoError(err)
+	suite.False(revoked)
+	// токен несуществующей сессии не принимается
+	revoked, err = suite.db.IsAccessTokenRevoked(suite.ctx, "jti1", "unknown")
+	suite.Require().NoError(err)
+	suite.True(revoked)
+
+	suite.Require().NoError(suite.db.RevokeAccessToken(suite.ctx, "jti1", time.Hour))
+	suite.Require().NoError(suite.db.RevokeAccessToken(suite.ctx, "jti1", time.Hour))
+	revoked, err = suite.db.IsAccessTokenRevoked(suite.ctx, "jti1", "s1")
+	suite.Require().NoError(err)
+	suite.True(revoked)
+	revoked, err = suite.db.IsAccessTokenRevoked(suite.ctx, "jti2", "s1")
+	suite.Require().NoError(err)
+	suite.False(revoked)
+
+	suite.Require().NoError(suite.db.RevokeSession(suite.ctx, "s1"))
+	revoked, err = suite.db.IsAccessTokenRevoked(suite.ctx, "jti2", "s1")
+	suite.Require().NoError(err)
+	suite.True(revoked)
+	_, err = suite.db.RotateRefreshToken(suite.ctx, "r1", "r2", time.Hour)
+	suite.ErrorIs(err, database.ErrTokenRevoked)
+}
+
+func (suite *ServiceSuite) TestRevokeUserSessions() {
+	suite.newSession("s1", "r1")
+	suite.newSession("s2", "r2")
+	other, err := suite.db.AddUser(suite.ctx, "other", "123")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.CreateSession(
+		suite.ctx,
+		models.Session{ID: "s3", UserID: other.ID, Username: "other"},
+		"r3",
+		time.Hour,
+	))
+
+	suite.Require().NoError(suite.db.RevokeUserSessions(suite.ctx, suite.userID, "s1"))
+	for id, expected := range map[string]bool{"s1": false, "s2": true, "s3": false} {
+		revoked, err := suite.db.IsAccessTokenRevoked(suite.ctx, "jti", id)
+		suite.Require().NoError(err)
+		suite.Equal(expected, revoked, id)
+	}
+	suite.Require().NoError(suite.db.RevokeUserSessions(suite.ctx, suite.userID, ""))
+	revoked, err := suite.db.IsAccessTokenRevoked(suite.ctx, "jti", "s1")
+	suite.Require().NoError(err)
+	suite.True(revoked)
+}
+
+func (suite *ServiceSuite) TestResetTokens() {
+	suite.Require().NoError(suite.db.CreateResetToken(suite.ctx, suite.userID, "t1", time.Hour))
+	userID, err := suite.db.ConsumeResetToken(suite.ctx, "t1")
+	suite.Require().NoError(err)
+	suite.Equal(suite.userID, userID)
+	// токен одноразовый
+	_, err = suite.db.ConsumeResetToken(suite.ctx, "t1")
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+	_, err = suite.db.ConsumeResetToken(suite.ctx, "unknown")
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+
+	// новый токен отменяет прежний
+	suite.Require().NoError(suite.db.CreateResetToken(suite.ctx, suite.userID, "t2", time.Hour))
+	suite.Require().NoError(suite.db.CreateResetToken(suite.ctx, suite.userID, "t3", time.Hour))
+	_, err = suite.db.ConsumeResetToken(suite.ctx, "t2")
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+
+	suite.Require().NoError(suite.db.CreateResetToken(suite.ctx, suite.userID, "expired", -time.Second))
+	_, err = suite.db.ConsumeResetToken(suite.ctx, "expired")
+	suite.ErrorIs(err, database.ErrTokenNotFound)
+}
+
+func (suite *ServiceSuite) TestOrders() {
+	order, err := suite.db.FindOrderByID(suite.ctx, "18")
+	suite.Require().NoError(err)
+	suite.Equal(suite.userID, order.UserID)
+	suite.Equal(database.STATUSES["NEW"], order.StatusID)
+	suite.False(order.UploadedAt.IsZero())
+
+	suite.ErrorIs(suite.db.AddOrder(suite.ctx, "18", suite.userID), database.ErrOrderAlreadyAddedByThisUser)
+	other, err := suite.db.AddUser(suite.ctx, "other", "123")
+	suite.Require().NoError(err)
+	suite.ErrorIs(suite.db.AddOrder(suite.ctx, "18", other.ID), database.ErrOrderAlreadyAddedByOtherUser)
+
+	_, err = suite.db.FindOrderByID(suite.ctx, "26")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+	_, err = suite.db.FindOrdersByUserID(suite.ctx, other.ID, models.ListQuery{})
+	suite.ErrorIs(err, database.ErrEmptyResult)
+}
+
+func (suite *ServiceSuite) TestFindOrdersByUserID() {
+	suite.Require().NoError(suite.db.AddOrder(suite.ctx, "26", suite.userID))
+	suite.Require().NoError(suite.db.UpdateOrderStatus(suite.ctx, "18", "PROCESSED"))
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(500)))
+	suite.Require().NoError(suite.db.UpdateOrderStatus(suite.ctx, "26", "PROCESSING"))
+
+	orders, err := suite.db.FindOrdersByUserID(suite.ctx, suite.userID, models.ListQuery{})
+	suite.Require().NoError(err)
+	suite.Require().Len(orders, 2)
+	suite.Equal("18", orders[0].ID)
+	suite.Equal("PROCESSED", orders[0].Status)
+	suite.Equal(money.NullAmount{Amount: money.FromUnits(500), Valid: true}, orders[0].Accrual)
+	suite.Equal("26", orders[1].ID)
+	suite.Equal("PROCESSING", orders[1].Status)
+	suite.False(orders[1].Accrual.Valid)
+}
+
+func (suite *ServiceSuite) TestListOrders() {
+	for _, id := range []string{"26", "34", "42", "59"} {
+		suite.Require().NoError(suite.db.AddOrder(suite.ctx, id, suite.userID))
+	}
+	suite.Require().NoError(suite.db.UpdateOrderStatus(suite.ctx, "26", "INVALID"))
+	suite.Require().NoError(suite.db.UpdateOrderStatus(suite.ctx, "42", "PROCESSED"))
+	all, err := suite.db.FindOrdersByUserID(suite.ctx, suite.userID, models.ListQuery{})
+	suite.Require().NoError(err)
+	suite.Require().Len(all, 5)
+
+	// страницы по два заказа, каждая продолжает предыдущую
+	var paged []models.Order
+	query := models.ListQuery{Limit: 2}
+	for {
+		page, err := suite.db.FindOrdersByUserID(suite.ctx, suite.userID, query)
+		if errors.Is(err, database.ErrEmptyResult) {
+			break
+		}
+		suite.Require().NoError(err)
+		suite.Require().LessOrEqual(len(page), 2)
+		paged = append(paged, page...)
+		last := page[len(page)-1]
+		query.After = &models.Cursor{At: last.UploadedAt, Order: last.ID}
+	}
+	suite.Equal(orderIDs(all), orderIDs(paged))
+
+	orders, err := suite.db.FindOrdersByUserID(suite.ctx, suite.userID, models.ListQuery{
+		Statuses: []models.OrderStatus{models.StatusInvalid, models.StatusProcessed},
+	})
+	suite.Require().NoError(err)
+	suite.Equal([]string{"26", "42"}, orderIDs(orders))
+	_, err = suite.db.FindOrdersByUserID(suite.ctx, suite.userID, models.ListQuery{
+		Statuses: []models.OrderStatus{models.StatusProcessing},
+	})
+	suite.ErrorIs(err, database.ErrEmptyResult)
+
+	// интервал [From, To) по времени загрузки
+	from, to := all[1].UploadedAt, all[3].UploadedAt
+	orders, err = suite.db.FindOrdersByUserID(suite.ctx, suite.userID, models.ListQuery{From: from, To: to})
+	suite.Require().NoError(err)
+	var expected []string
+	for _, o := range all {
+		if !o.UploadedAt.Before(from) && o.UploadedAt.Before(to) {
+			expected = append(expected, o.ID)
+		}
+	}
+	suite.Equal(expected, orderIDs(orders))
+}
+
+func orderIDs(orders []models.Order) []string {
+	ids := make([]string, len(orders))
+	for i, o := range orders {
+		ids[i] = o.ID
+	}
+	return ids
+}
+
+func (suite *ServiceSuite) TestLockOrderStatus() {
+	suite.Require().NoError(suite.db.UpdateOrderStatus(suite.ctx, "18", "PROCESSING"))
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		status, err := suite.db.LockOrderStatus(ctx, "18")
+		suite.Equal(models.StatusProcessing, status)
+		return err
+	})
+	suite.Require().NoError(err)
+
+	_, err = suite.db.LockOrderStatus(suite.ctx, "26")
+	suite.ErrorIs(err, database.ErrMissingOrderID)
+}
+
+func (suite *ServiceSuite) TestAccrualForMissingOrder() {
+	suite.ErrorIs(suite.db.AddAccrualRecord(suite.ctx, "26", money.FromUnits(1)), database.ErrMissingOrderID)
+	// нулевое начисление не записывается
+	suite.NoError(suite.db.AddAccrualRecord(suite.ctx, "18", 0))
+	suite.NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(1)))
+	suite.Equal(money.FromUnits(1), suite.balance().Current)
+}
+
+func (suite *ServiceSuite) TestTransactionCommit() {
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		if err := suite.db.UpdateOrderStatus(ctx, "18", "PROCESSED"); err != nil {
+			return err
+		}
+		if err := suite.db.AddAccrualRecord(ctx, "18", money.FromUnits(500)); err != nil {
+			return err
+		}
+		return suite.db.Tracker().Delete(ctx, "18")
+	})
+	suite.Require().NoError(err)
+
+	suite.Equal(money.FromUnits(500), suite.balance().Current)
+	_, err = suite.db.Tracker().Acquire(suite.ctx, "w1")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+}
+
+func (suite *ServiceSuite) TestTransactionRollback() {
+	errAbort := errors.New("abort")
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		if err := suite.db.UpdateOrderStatus(ctx, "18", "PROCESSED"); err != nil {
+			return err
+		}
+		if err := suite.db.AddAccrualRecord(ctx, "18", money.FromUnits(500)); err != nil {
+			return err
+		}
+		if err := suite.db.Tracker().Delete(ctx, "18"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	suite.ErrorIs(err, errAbort)
+
+	// ничего из сделанного в транзакции не сохранилось
+	order, err := suite.db.FindOrderByID(suite.ctx, "18")
+	suite.Require().NoError(err)
+	suite.Equal(database.STATUSES["NEW"], order.StatusID)
+	suite.Equal(money.Amount(0), suite.balance().Current)
+	task, err := suite.db.Tracker().Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Equal("18", task.OrderID)
+	// и начисление по заказу все еще можно сделать
+	suite.NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(500)))
+}
+
+func (suite *ServiceSuite) TestOneAccrualPerOrder() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(500)))
+	suite.ErrorIs(
+		suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(500)),
+		database.ErrAccrualAlreadyAdded,
+	)
+
+	// повтор внутри транзакции не ломает ее
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		err := suite.db.AddAccrualRecord(ctx, "18", money.FromUnits(500))
+		suite.ErrorIs(err, database.ErrAccrualAlreadyAdded)
+		return suite.db.Tracker().Delete(ctx, "18")
+	})
+	suite.Require().NoError(err)
+
+	suite.Equal(money.FromUnits(500), suite.balance().Current)
+}
+
+func (suite *ServiceSuite) TestTrackerJoinsTransaction() {
+	tracker := suite.db.Tracker()
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		task, err := tracker.Acquire(ctx, "w1")
+		if err != nil {
+			return err
+		}
+		return tracker.UpdateStatusAndRelease(ctx, task, database.STATUSES["PROCESSING"])
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *ServiceSuite) TestWithdrawInsufficientFunds() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+
+	err := suite.db.AddWithdrawalRecord(suite.ctx, "26", money.FromUnits(150), suite.userID)
+	var fundsErr *database.ErrInsufficientFunds
+	suite.Require().ErrorAs(err, &fundsErr)
+	suite.Equal(money.FromUnits(100), fundsErr.Current)
+	suite.Equal(money.FromUnits(150), fundsErr.Requested)
+
+	// неудачное списание не оставило следов
+	_, err = suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{})
+	suite.ErrorIs(err, database.ErrEmptyResult)
+}
+
+func (suite *ServiceSuite) TestWithdrawals() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, "26", money.FromUnits(30), suite.userID))
+	suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, "34", money.FromUnits(20), suite.userID))
+
+	withdrawals, err := suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{})
+	suite.Require().NoError(err)
+	suite.Require().Len(withdrawals, 2)
+	suite.Equal("26", withdrawals[0].Order)
+	suite.Equal(money.FromUnits(30), withdrawals[0].Sum)
+	suite.False(withdrawals[0].ProcessedAt.IsZero())
+	suite.Equal("34", withdrawals[1].Order)
+	suite.Equal(money.FromUnits(20), withdrawals[1].Sum)
+	suite.Equal(models.Balance{Current: money.FromUnits(50), Withdrawn: money.FromUnits(50)}, suite.balance())
+}
+
+func (suite *ServiceSuite) TestListWithdrawals() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	for _, id := range []string{"26", "34", "42"} {
+		suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, id, money.FromUnits(10), suite.userID))
+	}
+	all, err := suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{})
+	suite.Require().NoError(err)
+	suite.Require().Len(all, 3)
+
+	page, err := suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{Limit: 2})
+	suite.Require().NoError(err)
+	suite.Equal(all[:2], page)
+	last := page[1]
+	page, err = suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{
+		Limit: 2,
+		After: &models.Cursor{At: last.ProcessedAt, Order: last.Order, ID: last.EntryID},
+	})
+	suite.Require().NoError(err)
+	suite.Equal(all[2:], page)
+
+	_, err = suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{
+		From: all[2].ProcessedAt.Add(time.Second),
+	})
+	suite.ErrorIs(err, database.ErrEmptyResult)
+	page, err = suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{
+		To: all[2].ProcessedAt.Add(time.Second),
+	})
+	suite.Require().NoError(err)
+	suite.Equal(all, page)
+}
+
+// по одному заказу может быть несколько списаний с одним временем: в одной
+// транзакции NOW() не меняется. Страницы не должны их терять или повторять
+func (suite *ServiceSuite) TestListWithdrawalsSameOrder() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		for i := 1; i <= 3; i++ {
+			err := suite.db.AddWithdrawalRecord(ctx, "26", money.FromUnits(int64(i)), suite.userID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	suite.Require().NoError(err)
+	all, err := suite.db.GetWithdrawals(suite.ctx, suite.userID, models.ListQuery{})
+	suite.Require().NoError(err)
+	suite.Require().Len(all, 3)
+
+	var paged []models.Withdrawal
+	query := models.ListQuery{Limit: 1}
+	for len(paged) < len(all)+1 {
+		page, err := suite.db.GetWithdrawals(suite.ctx, suite.userID, query)
+		if errors.Is(err, database.ErrEmptyResult) {
+			break
+		}
+		suite.Require().NoError(err)
+		paged = append(paged, page...)
+		after := page[len(page)-1].Cursor()
+		query.After = &after
+	}
+	suite.Equal(all, paged)
+}
+
+func (suite *ServiceSuite) TestConcurrentWithdrawals() {
+	const (
+		accrual   = money.Amount(100 * money.Scale)
+		sum       = money.Amount(10 * money.Scale)
+		attempts  = 50
+		succeeded = int(accrual / sum)
+	)
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", accrual))
+
+	var wg sync.WaitGroup
+	var ok, insufficient atomic.Int32
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := suite.db.AddWithdrawalRecord(suite.ctx, fmt.Sprintf("w%v", i), sum, suite.userID)
+			var fundsErr *database.ErrInsufficientFunds
+			switch {
+			case err == nil:
+				ok.Add(1)
+			case errors.As(err, &fundsErr):
+				insufficient.Add(1)
+			default:
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		suite.NoError(err)
+	}
+
+	suite.Equal(int32(succeeded), ok.Load())
+	suite.Equal(int32(attempts-succeeded), insufficient.Load())
+	suite.Equal(models.Balance{Current: 0, Withdrawn: accrual}, suite.balance())
+}
+
+func (suite *ServiceSuite) TestBooksBalance() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, "26", money.FromUnits(30), suite.userID))
+	suite.Require().NoError(suite.db.PostEntry(suite.ctx, ledger.Refund(suite.userID, "26", money.FromUnits(10))))
+	suite.Require().NoError(suite.db.PostEntry(
+		suite.ctx,
+		ledger.Correction(suite.userID, money.FromUnits(-5), "manual fix"),
+	))
+
+	suite.Equal(models.Balance{Current: money.FromUnits(75), Withdrawn: money.FromUnits(20)}, suite.balance())
+}
+
+func (suite *ServiceSuite) TestUnbalancedEntryRejected() {
+	unbalanced := ledger.Entry{
+		Kind: ledger.KindCorrection,
+		Postings: []ledger.Posting{
+			{Account: ledger.Adjustments, Amount: -50},
+			{Account: ledger.UserAccount(suite.userID), Amount: 100},
+		},
+	}
+	suite.ErrorIs(suite.db.PostEntry(suite.ctx, unbalanced), ledger.ErrUnbalanced)
+	suite.Equal(models.Balance{}, suite.balance())
+}
+
+// TrackerSuite проверяет ordertracker.Tracker: повтор задачи откладывается
+// на час, после двух попыток задача уходит в dead letter
+type TrackerSuite struct {
+	suite.Suite
+	newService Factory
+	db         database.Service
+	tracker    ordertracker.Tracker
+	ctx        context.Context
+}
+
+func (suite *TrackerSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.setPolicy(ordertracker.RetryPolicy{
+		BaseDelay:   time.Hour,
+		MaxDelay:    time.Hour,
+		MaxAttempts: 2,
+	})
+}
+
+// setPolicy пересоздает хранилище с другой политикой повторов
+func (suite *TrackerSuite) setPolicy(policy ordertracker.RetryPolicy) {
+	suite.db = suite.newService(suite.T(), policy, TestLease)
+	suite.tracker = suite.db.Tracker()
+}
+
+func (suite *TrackerSuite) TestAcquireOnce() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+
+	task, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Equal("18", task.OrderID)
+	suite.Equal("w1", task.Owner)
+	suite.Equal(0, task.Attempts)
+	suite.False(task.Reclaimed)
+
+	_, err = suite.tracker.Acquire(suite.ctx, "w2")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+}
+
+func (suite *TrackerSuite) TestAddTwice() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	suite.ErrorIs(suite.tracker.Add(suite.ctx, "18"), ordertracker.ErrTaskExists)
+}
+
+func (suite *TrackerSuite) TestAcquireBatch() {
+	for _, orderID := range []string{"18", "26", "34"} {
+		suite.Require().NoError(suite.tracker.Add(suite.ctx, orderID))
+	}
+	depth, err := suite.tracker.Depth(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Equal(3, depth)
+
+	tasks, err := suite.tracker.AcquireBatch(suite.ctx, "w1", 2)
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 2)
+	for _, task := range tasks {
+		suite.Equal("w1", task.Owner)
+	}
+	depth, err = suite.tracker.Depth(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Equal(1, depth)
+
+	// арендованные задачи другому воркеру не достаются
+	tasks, err = suite.tracker.AcquireBatch(suite.ctx, "w2", 5)
+	suite.Require().NoError(err)
+	suite.Require().Len(tasks, 1)
+
+	// каждую задачу из пачки можно отпустить отдельно
+	suite.Require().NoError(suite.tracker.Release(suite.ctx, tasks[0], 0))
+	tasks, err = suite.tracker.AcquireBatch(suite.ctx, "w3", 5)
+	suite.Require().NoError(err)
+	suite.Len(tasks, 1)
+
+	tasks, err = suite.tracker.AcquireBatch(suite.ctx, "w3", 5)
+	suite.NoError(err)
+	suite.Empty(tasks)
+}
+
+func (suite *TrackerSuite) TestBackoff() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	task, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.tracker.UpdateStatusAndRelease(suite.ctx, task, 1))
+
+	// следующая попытка отложена на час
+	_, err = suite.tracker.Acquire(suite.ctx, "w1")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+}
+
+func (suite *TrackerSuite) TestReleaseDoesNotCountAttempt() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	task, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.tracker.Release(suite.ctx, task, 0))
+
+	task, err = suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Equal(0, task.Attempts)
+}
+
+func (suite *TrackerSuite) TestDeadLetterAndRequeue() {
+	// повторяем сразу, чтобы не ждать задержку
+	suite.setPolicy(ordertracker.RetryPolicy{MaxAttempts: 2})
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	for i := 0; i < 2; i++ {
+		task, err := suite.tracker.Acquire(suite.ctx, "w1")
+		suite.Require().NoError(err)
+		suite.Require().NoError(suite.tracker.UpdateStatusAndRelease(suite.ctx, task, 1))
+	}
+
+	_, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+
+	dead, err := suite.tracker.ListDead(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(dead, 1)
+	suite.Equal("18", dead[0].OrderID)
+	suite.Equal(2, dead[0].Attempts)
+	suite.False(dead[0].DeadAt.IsZero())
+
+	suite.Require().NoError(suite.tracker.Requeue(suite.ctx, "18"))
+	task, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	suite.Equal(0, task.Attempts)
+
+	suite.ErrorIs(suite.tracker.Requeue(suite.ctx, "18"), ordertracker.ErrTaskNotFound)
+}
+
+// воркер w1 взял задачу и упал, не отпустив ее
+func (suite *TrackerSuite) TestCrashedWorkerLeaseIsReclaimed() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	crashed, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+
+	// пока аренда действует, задачу никто не получит
+	_, err = suite.tracker.Acquire(suite.ctx, "w2")
+	suite.ErrorIs(err, pgx.ErrNoRows)
+
+	time.Sleep(2 * TestLease)
+
+	task, err := suite.tracker.Acquire(suite.ctx, "w2")
+	suite.Require().NoError(err)
+	suite.Equal("18", task.OrderID)
+	suite.Equal("w2", task.Owner)
+	suite.True(task.Reclaimed)
+
+	// "оживший" w1 не может ни отпустить, ни перепланировать чужую задачу
+	suite.ErrorIs(suite.tracker.Release(suite.ctx, crashed, 0), ordertracker.ErrLeaseLost)
+	suite.ErrorIs(suite.tracker.UpdateStatusAndRelease(suite.ctx, crashed, 1), ordertracker.ErrLeaseLost)
+
+	// а w2 может
+	suite.NoError(suite.tracker.UpdateStatusAndRelease(suite.ctx, task, 1))
+}
+
+func (suite *TrackerSuite) TestCrashedWorkerDoesNotBlockOthers() {
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "26"))
+
+	first, err := suite.tracker.Acquire(suite.ctx, "w1")
+	suite.Require().NoError(err)
+	second, err := suite.tracker.Acquire(suite.ctx, "w2")
+	suite.Require().NoError(err)
+	suite.NotEqual(first.OrderID, second.OrderID)
+}
+
+// waitSignal ждет сигнала из ch не дольше timeout
+func waitSignal(ch <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case _, ok := <-ch:
+		return ok
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (suite *TrackerSuite) TestAddNotifies() {
+	ctx, cancel := context.WithCancel(suite.ctx)
+	notifications := suite.tracker.Notifications(ctx)
+	// первый сигнал приходит сразу после подписки
+	suite.Require().True(waitSignal(notifications, time.Second))
+
+	suite.Require().NoError(suite.tracker.Add(suite.ctx, "18"))
+	suite.True(waitSignal(notifications, time.Second))
+
+	// внутри транзакции уведомление уходит только после фиксации
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		if err := suite.tracker.Add(ctx, "26"); err != nil {
+			return err
+		}
+		suite.False(waitSignal(notifications, 100*time.Millisecond))
+		return nil
+	})
+	suite.Require().NoError(err)
+	suite.True(waitSignal(notifications, time.Second))
+
+	cancel()
+	// после отмены канал закрывается
+	for range notifications {
+	}
+}
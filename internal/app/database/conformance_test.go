@@ -0,0 +1,38 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/conformance"
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtest"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/server/config"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(
+		t *testing.T,
+		policy ordertracker.RetryPolicy,
+		lease time.Duration,
+	) database.Service {
+		// пересоздаем схему; пул dbtest закроется сам
+		dbtest.Connect(t)
+		db, err := database.NewDatabaseService(&config.Config{
+			DatabaseURI:           dbtest.URI(t),
+			AccrualRetryBaseDelay: policy.BaseDelay,
+			AccrualRetryMaxDelay:  policy.MaxDelay,
+			AccrualRetryJitter:    policy.Jitter,
+			AccrualMaxAttempts:    policy.MaxAttempts,
+			AccrualMaxAge:         policy.MaxAge,
+			AccrualLeaseDuration:  lease,
+		}, context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(db.Close)
+		return db
+	})
+}
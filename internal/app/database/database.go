@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtx"
+	"github.com/blokhinnv/gophermart/internal/app/database/migration"
 	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
 	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 
 	"github.com/blokhinnv/gophermart/internal/app/server/config"
 	"github.com/jackc/pgerrcode"
@@ -25,8 +29,20 @@ var STATUSES = map[string]int{
 	"PROCESSED":  4,
 }
 
+// StatusByID возвращает статус заказа по его идентификатору в OrderStatus
+func StatusByID(id int) (models.OrderStatus, error) {
+	for status, statusID := range STATUSES {
+		if statusID == id {
+			return models.OrderStatus(status), nil
+		}
+	}
+	return "", fmt.Errorf("%w: id=%v", models.ErrUnknownStatus, id)
+}
+
 type DatabaseService struct {
-	conn *pgxpool.Pool
+	conn          *pgxpool.Pool
+	retryPolicy   ordertracker.RetryPolicy
+	leaseDuration time.Duration
 }
 
 func NewDatabaseService(
@@ -41,26 +57,82 @@ func NewDatabaseService(
 	if err != nil {
 		return nil, err
 	}
+	return &DatabaseService{
+		conn:          conn,
+		retryPolicy:   NewRetryPolicy(cfg),
+		leaseDuration: cfg.AccrualLeaseDuration,
+	}, nil
+}
+
+// NewRetryPolicy собирает политику повторов очереди из настроек; ее
+// используют все реализации хранилища
+func NewRetryPolicy(cfg *config.Config) ordertracker.RetryPolicy {
+	policy := ordertracker.RetryPolicy{
+		BaseDelay:   cfg.AccrualRetryBaseDelay,
+		MaxDelay:    cfg.AccrualRetryMaxDelay,
+		Jitter:      cfg.AccrualRetryJitter,
+		MaxAttempts: cfg.AccrualMaxAttempts,
+		MaxAge:      cfg.AccrualMaxAge,
+	}
+	if cfg.AccrualCallbackSecret != "" {
+		// статусы присылает сама система расчета - опрос остается запасным
+		// путем на случай потерянных уведомлений и может быть редким
+		policy.BaseDelay = maxDuration(policy.BaseDelay, cfg.AccrualCallbackPollDelay)
+		policy.MaxDelay = maxDuration(policy.MaxDelay, policy.BaseDelay)
+	}
+	return policy
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// q возвращает транзакцию из контекста, если она есть, иначе пул
+func (db *DatabaseService) q(ctx context.Context) dbtx.Querier {
+	return dbtx.From(ctx, db.conn)
+}
 
-	return &DatabaseService{conn: conn}, nil
+// WithinTransaction выполняет fn в одной транзакции: все вызовы DatabaseService
+// и трекера с переданным в fn контекстом либо фиксируются вместе, либо
+// откатываются, если fn вернула ошибку
+func (db *DatabaseService) WithinTransaction(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+) error {
+	return dbtx.Run(ctx, db.conn, fn)
+}
+
+// Migrator возвращает миграции схемы, вшитые в бинарник, для этой БД
+func (db *DatabaseService) Migrator() (*migration.Migrator, error) {
+	return migration.NewMigrator(db.conn)
 }
 
 func (db *DatabaseService) Tracker() ordertracker.Tracker {
-	return ordertracker.NewDBTracker(db.conn)
+	return ordertracker.NewDBTracker(db.conn, db.retryPolicy, db.leaseDuration)
 }
 
+// AddUser создает пользователя; пароль хэширует вызывающий (см. auth.Hasher)
 func (db *DatabaseService) AddUser(
 	ctx context.Context,
-	username, pwd string,
+	username, passwordHash string,
 ) (*models.User, error) {
 	log.Printf("Adding user %v...", username)
-	salt, err := auth.GenerateSalt()
-	if err != nil {
-		return nil, err
-	}
-	pwdHash := auth.GenerateHash(pwd, salt)
 	var addedID int
-	err = db.conn.QueryRow(ctx, addUserSQL, username, pwdHash, salt).Scan(&addedID)
+	err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := db.q(ctx).QueryRow(ctx, addUserSQL, username, passwordHash).Scan(&addedID)
+		if err != nil {
+			return err
+		}
+		_, err = db.q(ctx).Exec(ctx, addUserBalanceSQL, addedID)
+		if err != nil {
+			return err
+		}
+		_, err = db.q(ctx).Exec(ctx, addUserLedgerAccountSQL, ledger.UserAccount(addedID), addedID)
+		return err
+	})
 	if err != nil {
 		var pgerr *pgconn.PgError
 		if errors.As(err, &pgerr) {
@@ -70,24 +142,35 @@ func (db *DatabaseService) AddUser(
 		}
 		return nil, err
 	}
-	return &models.User{ID: addedID, Username: username, HashedPassword: pwdHash, Salt: salt}, nil
+	return &models.User{ID: addedID, Username: username, HashedPassword: passwordHash}, nil
 }
 
 func (db *DatabaseService) FindUser(
 	ctx context.Context,
-	username, pwd string,
+	username string,
 ) (*models.User, error) {
-	var storedHash, salt string
+	var storedHash string
 	var id int
-	err := db.conn.QueryRow(ctx, selectUserByLoginSQL, username).Scan(&id, &storedHash, &salt)
+	err := db.q(ctx).QueryRow(ctx, selectUserByLoginSQL, username).Scan(&id, &storedHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%w: %v", ErrUserNotFound, username)
 		}
 		return nil, err
 	}
-	return &models.User{ID: id, Username: username, HashedPassword: storedHash, Salt: salt}, nil
+	return &models.User{ID: id, Username: username, HashedPassword: storedHash}, nil
+}
 
+// UpdatePasswordHash заменяет хэш пароля пользователя, если он все еще
+// равен oldHash. Если хэш уже поменяли, ничего не делает: более свежий
+// хэш важнее
+func (db *DatabaseService) UpdatePasswordHash(
+	ctx context.Context,
+	userID int,
+	oldHash, newHash string,
+) error {
+	_, err := db.q(ctx).Exec(ctx, updatePasswordHashSQL, userID, oldHash, newHash)
+	return err
 }
 
 func (db *DatabaseService) FindOrderByID(
@@ -95,7 +178,7 @@ func (db *DatabaseService) FindOrderByID(
 	orderID string,
 ) (*models.Order, error) {
 	order := models.Order{}
-	err := db.conn.QueryRow(ctx, selectOrderByIDSQL, orderID).
+	err := db.q(ctx).QueryRow(ctx, selectOrderByIDSQL, orderID).
 		Scan(&order.ID, &order.UserID, &order.StatusID, &order.UploadedAt)
 	if err != nil {
 		return nil, err
@@ -114,7 +197,7 @@ func (db *DatabaseService) AddOrder(
 	if err != nil {
 		// не нашли заказ - надо добавить
 		if errors.Is(err, pgx.ErrNoRows) {
-			_, err = db.conn.Exec(ctx, addOrderSQL, orderID, userID)
+			_, err = db.q(ctx).Exec(ctx, addOrderSQL, orderID, userID)
 			return err
 		}
 		// любая другая ошибка - плохо
@@ -134,26 +217,75 @@ func (db *DatabaseService) AddOrder(
 }
 
 func (db *DatabaseService) UpdateOrderStatus(ctx context.Context, orderID, newStatus string) error {
-	_, err := db.conn.Exec(ctx, updateOrderStatusSQL, newStatus, orderID)
+	_, err := db.q(ctx).Exec(ctx, updateOrderStatusSQL, newStatus, orderID)
 	return err
 }
 
+// LockOrderStatus возвращает статус заказа и блокирует заказ до конца
+// транзакции из ctx; вне транзакции блокировка сразу снимается
+func (db *DatabaseService) LockOrderStatus(
+	ctx context.Context,
+	orderID string,
+) (models.OrderStatus, error) {
+	var status string
+	err := db.q(ctx).QueryRow(ctx, lockOrderStatusSQL, orderID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%w: %v", ErrMissingOrderID, orderID)
+		}
+		return "", err
+	}
+	return models.ParseOrderStatus(status)
+}
+
+// AddAccrualRecord начисляет баллы за заказ владельцу заказа. Нулевое
+// начисление ничего не меняет в журнале и не записывается
 func (db *DatabaseService) AddAccrualRecord(
 	ctx context.Context,
 	orderID string,
-	sum float64,
+	sum money.Amount,
 ) error {
 	log.Printf("Adding accrual record orderID=%v sum=%v...", orderID, sum)
-	_, err := db.conn.Exec(ctx, addTransactionSQL, orderID, sum, "ACCRUAL")
-	return err
+	if sum == 0 {
+		return nil
+	}
+	var userID int
+	err := db.q(ctx).QueryRow(ctx, selectOrderOwnerSQL, orderID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: %v", ErrMissingOrderID, orderID)
+		}
+		return err
+	}
+	return db.PostEntry(ctx, ledger.Accrual(userID, orderID, sum))
 }
 
 func (db *DatabaseService) FindOrdersByUserID(
 	ctx context.Context,
 	userID int,
+	query models.ListQuery,
 ) ([]models.Order, error) {
 	orders := make([]models.Order, 0)
-	rows, err := db.conn.Query(ctx, getOrdersByUserID, userID)
+	var statuses any
+	if len(query.Statuses) > 0 {
+		names := make([]string, len(query.Statuses))
+		for i, s := range query.Statuses {
+			names[i] = string(s)
+		}
+		statuses = names
+	}
+	after, afterOrder, _ := nullCursor(query.After)
+	rows, err := db.q(ctx).Query(
+		ctx,
+		getOrdersByUserID,
+		userID,
+		statuses,
+		nullTime(query.From),
+		nullTime(query.To),
+		after,
+		afterOrder,
+		nullLimit(query.Limit),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -176,54 +308,68 @@ func (db *DatabaseService) FindOrdersByUserID(
 
 func (db *DatabaseService) GetBalance(ctx context.Context, userID int) (*models.Balance, error) {
 	balance := models.Balance{}
-	err := db.conn.QueryRow(ctx, getBalanceSQL, userID).
+	err := db.q(ctx).QueryRow(ctx, getBalanceSQL, userID).
 		Scan(&balance.Current, &balance.Withdrawn)
 	if err != nil {
+		// у пользователя еще не было ни одной операции
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &balance, nil
+		}
 		return nil, err
 	}
 	return &balance, err
 }
 
+// AddWithdrawalRecord списывает sum с баланса пользователя. Проверка баланса
+// и списание выполняются в одной транзакции под блокировкой строки баланса,
+// поэтому параллельные списания не могут увести баланс в минус
 func (db *DatabaseService) AddWithdrawalRecord(
 	ctx context.Context,
 	orderID string,
-	sum float64,
+	sum money.Amount,
 	userID int,
 ) error {
 	log.Printf("Adding withdrawal record orderID=%v sum=%v...", orderID, sum)
-	// если заказа не было - добавим
-	err := db.AddOrder(ctx, orderID, userID)
-	if err != nil {
-		if !errors.Is(err, ErrOrderAlreadyAddedByOtherUser) &&
-			!errors.Is(err, ErrOrderAlreadyAddedByThisUser) {
+	return db.WithinTransaction(ctx, func(ctx context.Context) error {
+		// все списания пользователя выстраиваются в очередь на этой блокировке
+		balance := models.Balance{}
+		err := db.q(ctx).QueryRow(ctx, lockBalanceSQL, userID).
+			Scan(&balance.Current, &balance.Withdrawn)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 			return err
 		}
-	}
-	_, err = db.conn.Exec(ctx, addTransactionSQL, orderID, sum, "WITHDRAWAL")
-	if err != nil {
-		var pgerr *pgconn.PgError
-		if errors.As(err, &pgerr) {
-			if pgerr.Code == pgerrcode.ForeignKeyViolation {
-				return fmt.Errorf("%w: %v", ErrMissingOrderID, orderID)
-			}
+		if balance.Current < sum {
+			return NewErrInsufficientFunds(userID, balance.Current, sum)
 		}
-	}
-	return err
+		return db.PostEntry(ctx, ledger.Withdrawal(userID, orderID, sum))
+	})
 }
 
 func (db *DatabaseService) GetWithdrawals(
 	ctx context.Context,
 	userID int,
+	query models.ListQuery,
 ) ([]models.Withdrawal, error) {
 	withdrawals := make([]models.Withdrawal, 0)
-	rows, err := db.conn.Query(ctx, getWithdrawalsSQL, userID)
+	after, afterOrder, afterID := nullCursor(query.After)
+	rows, err := db.q(ctx).Query(
+		ctx,
+		getWithdrawalsSQL,
+		ledger.UserAccount(userID),
+		nullTime(query.From),
+		nullTime(query.To),
+		after,
+		afterOrder,
+		afterID,
+		nullLimit(query.Limit),
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		wd := models.Withdrawal{}
-		if err := rows.Scan(&wd.Order, &wd.Sum, &wd.ProcessedAt); err != nil {
+		if err := rows.Scan(&wd.Order, &wd.Sum, &wd.ProcessedAt, &wd.EntryID); err != nil {
 			return nil, err
 		}
 		withdrawals = append(withdrawals, wd)
@@ -237,6 +383,87 @@ func (db *DatabaseService) GetWithdrawals(
 	return withdrawals, nil
 }
 
+// незаданные фильтры ListQuery передаются в запросы как NULL. Время в БД
+// хранится без часового пояса, в UTC
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+func nullLimit(limit int) any {
+	if limit <= 0 {
+		return nil
+	}
+	return limit
+}
+
+func nullCursor(c *models.Cursor) (at, order, id any) {
+	if c == nil {
+		return nil, nil, nil
+	}
+	return c.At.UTC(), c.Order, c.ID
+}
+
+// Reconcile пересчитывает балансы пользователей по журналу операций и
+// возвращает те, что разошлись с UserBalance. Если fix - исправляет их.
+// Если сам журнал не сбалансирован, возвращает ErrLedgerUnbalanced
+func (db *DatabaseService) Reconcile(ctx context.Context, fix bool) ([]BalanceDrift, error) {
+	drifts := make([]BalanceDrift, 0)
+	err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+		// пока идет сверка, балансы не должны меняться
+		_, err := db.q(ctx).Exec(ctx, "LOCK TABLE UserBalance, Posting IN SHARE ROW EXCLUSIVE MODE;")
+		if err != nil {
+			return err
+		}
+		var total money.Amount
+		if err := db.q(ctx).QueryRow(ctx, ledgerTotalSQL).Scan(&total); err != nil {
+			return err
+		}
+		if total != 0 {
+			return fmt.Errorf("%w: sum of all postings is %v", ErrLedgerUnbalanced, total)
+		}
+		rows, err := db.q(ctx).Query(ctx, balanceDriftSQL)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			d := BalanceDrift{}
+			err := rows.Scan(
+				&d.UserID,
+				&d.Stored.Current,
+				&d.Stored.Withdrawn,
+				&d.Actual.Current,
+				&d.Actual.Withdrawn,
+			)
+			if err != nil {
+				return err
+			}
+			drifts = append(drifts, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if !fix {
+			return nil
+		}
+		for _, d := range drifts {
+			log.Printf("Fixing balance userID=%v: %+v -> %+v", d.UserID, d.Stored, d.Actual)
+			_, err := db.q(ctx).Exec(ctx, fixBalanceSQL, d.UserID, d.Actual.Current, d.Actual.Withdrawn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
 func (db *DatabaseService) Close() {
 	log.Println("Closing DB connection...")
 	db.conn.Close()
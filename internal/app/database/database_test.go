@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtest"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/stretchr/testify/suite"
+)
+
+type DatabaseTestSuite struct {
+	suite.Suite
+	db     *DatabaseService
+	ctx    context.Context
+	userID int
+}
+
+func (suite *DatabaseTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.db = &DatabaseService{conn: dbtest.Connect(suite.T()), leaseDuration: time.Minute}
+	user, err := suite.db.AddUser(suite.ctx, "nikita", "123")
+	suite.Require().NoError(err)
+	suite.userID = user.ID
+	suite.Require().NoError(suite.db.AddOrder(suite.ctx, "18", suite.userID))
+	suite.Require().NoError(suite.db.Tracker().Add(suite.ctx, "18"))
+}
+
+func (suite *DatabaseTestSuite) TestBalanceFollowsLedger() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, "26", money.FromUnits(30), suite.userID))
+
+	balance, err := suite.db.GetBalance(suite.ctx, suite.userID)
+	suite.Require().NoError(err)
+	suite.Equal(money.FromUnits(70), balance.Current)
+	suite.Equal(money.FromUnits(30), balance.Withdrawn)
+
+	drifts, err := suite.db.Reconcile(suite.ctx, false)
+	suite.Require().NoError(err)
+	suite.Empty(drifts)
+}
+
+func (suite *DatabaseTestSuite) TestReconcile() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	_, err := suite.db.conn.Exec(suite.ctx, "UPDATE UserBalance SET current = 1")
+	suite.Require().NoError(err)
+
+	drifts, err := suite.db.Reconcile(suite.ctx, false)
+	suite.Require().NoError(err)
+	suite.Require().Len(drifts, 1)
+	suite.Equal(suite.userID, drifts[0].UserID)
+	suite.Equal(money.Amount(1), drifts[0].Stored.Current)
+	suite.Equal(money.FromUnits(100), drifts[0].Actual.Current)
+
+	_, err = suite.db.Reconcile(suite.ctx, true)
+	suite.Require().NoError(err)
+	drifts, err = suite.db.Reconcile(suite.ctx, false)
+	suite.Require().NoError(err)
+	suite.Empty(drifts)
+	balance, err := suite.db.GetBalance(suite.ctx, suite.userID)
+	suite.Require().NoError(err)
+	suite.Equal(money.FromUnits(100), balance.Current)
+}
+
+// assertBooksBalanced проверяет, что каждая проводка и журнал в целом
+// сбалансированы
+func (suite *DatabaseTestSuite) assertBooksBalanced() {
+	var total int64
+	err := suite.db.conn.QueryRow(suite.ctx, "SELECT COALESCE(SUM(amount), 0)::BIGINT FROM Posting").
+		Scan(&total)
+	suite.Require().NoError(err)
+	suite.Zero(total)
+	var unbalanced int
+	err = suite.db.conn.QueryRow(suite.ctx, `
+		SELECT COUNT(*) FROM (
+			SELECT entry_id FROM Posting GROUP BY entry_id HAVING SUM(amount) <> 0
+		) t`).Scan(&unbalanced)
+	suite.Require().NoError(err)
+	suite.Zero(unbalanced)
+}
+
+func (suite *DatabaseTestSuite) TestBooksBalance() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	suite.Require().NoError(suite.db.AddWithdrawalRecord(suite.ctx, "26", money.FromUnits(30), suite.userID))
+	suite.Require().NoError(suite.db.PostEntry(suite.ctx, ledger.Refund(suite.userID, "26", money.FromUnits(10))))
+	suite.Require().NoError(suite.db.PostEntry(
+		suite.ctx,
+		ledger.Correction(suite.userID, money.FromUnits(-5), "manual fix"),
+	))
+	suite.assertBooksBalanced()
+
+	balance, err := suite.db.GetBalance(suite.ctx, suite.userID)
+	suite.Require().NoError(err)
+	suite.Equal(money.FromUnits(75), balance.Current)
+	suite.Equal(money.FromUnits(20), balance.Withdrawn)
+
+	drifts, err := suite.db.Reconcile(suite.ctx, false)
+	suite.Require().NoError(err)
+	suite.Empty(drifts)
+}
+
+func (suite *DatabaseTestSuite) TestUnbalancedEntryRejected() {
+	unbalanced := ledger.Entry{
+		Kind: ledger.KindCorrection,
+		Postings: []ledger.Posting{
+			{Account: ledger.Adjustments, Amount: -50},
+			{Account: ledger.UserAccount(suite.userID), Amount: 100},
+		},
+	}
+	suite.ErrorIs(suite.db.PostEntry(suite.ctx, unbalanced), ledger.ErrUnbalanced)
+
+	// в обход PostEntry запись отклоняет триггер при фиксации транзакции
+	err := suite.db.WithinTransaction(suite.ctx, func(ctx context.Context) error {
+		var entryID int64
+		err := suite.db.q(ctx).QueryRow(ctx, addJournalEntrySQL, ledger.KindCorrection, "", "").
+			Scan(&entryID, new(time.Time))
+		if err != nil {
+			return err
+		}
+		_, err = suite.db.q(ctx).Exec(ctx, addPostingSQL, entryID, ledger.UserAccount(suite.userID), 100)
+		return err
+	})
+	suite.Error(err)
+	suite.assertBooksBalanced()
+}
+
+func (suite *DatabaseTestSuite) TestLedgerIsAppendOnly() {
+	suite.Require().NoError(suite.db.AddAccrualRecord(suite.ctx, "18", money.FromUnits(100)))
+	_, err := suite.db.conn.Exec(suite.ctx, "UPDATE Posting SET amount = amount * 2")
+	suite.Error(err)
+	_, err = suite.db.conn.Exec(suite.ctx, "DELETE FROM JournalEntry")
+	suite.Error(err)
+}
+
+func TestDatabaseTestSuite(t *testing.T) {
+	suite.Run(t, new(DatabaseTestSuite))
+}
@@ -0,0 +1,48 @@
+// Package dbtest поднимает чистую схему в тестовой БД Postgres.
+// Адрес БД берется из TEST_DATABASE_URI; если переменная не задана,
+// тесты, которым нужна БД, пропускаются.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/blokhinnv/gophermart/internal/app/database/migration"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const EnvDatabaseURI = "TEST_DATABASE_URI"
+
+// URI возвращает адрес тестовой БД или пропускает тест
+func URI(t testing.TB) string {
+	t.Helper()
+	uri := os.Getenv(EnvDatabaseURI)
+	if uri == "" {
+		t.Skipf("%v is not set", EnvDatabaseURI)
+	}
+	return uri
+}
+
+// Connect пересоздает схему public, накатывает все миграции и
+// возвращает пул соединений, который закроется по окончании теста
+func Connect(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := pgxpool.New(ctx, URI(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	if _, err := conn.Exec(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public;"); err != nil {
+		t.Fatal(err)
+	}
+	migrator, err := migration.NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
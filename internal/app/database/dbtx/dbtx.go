@@ -0,0 +1,44 @@
+// Package dbtx позволяет нескольким хранилищам, работающим с одним пулом
+// соединений, выполнять запросы в общей транзакции: транзакция кладется в
+// контекст, и все запросы с этим контекстом идут через нее.
+package dbtx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier - общее подмножество методов pgxpool.Pool и pgx.Tx
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type txKey struct{}
+
+// From возвращает транзакцию из контекста, а если ее нет - сам пул
+func From(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
+
+// Run выполняет fn в транзакции и фиксирует ее, если fn не вернула ошибку.
+// Если транзакция уже открыта, fn выполняется во вложенной (через SAVEPOINT)
+func Run(ctx context.Context, pool *pgxpool.Pool, fn func(ctx context.Context) error) error {
+	tx, err := From(ctx, pool).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -1,6 +1,11 @@
 package database
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
+)
 
 var ErrUserAlreadyExists = errors.New("user already exists")
 var ErrUserNotFound = errors.New("user not found")
@@ -8,3 +13,33 @@ var ErrOrderAlreadyAddedByThisUser = errors.New("order already added by this use
 var ErrOrderAlreadyAddedByOtherUser = errors.New("order already added by other user")
 var ErrEmptyResult = errors.New("empty result set")
 var ErrMissingOrderID = errors.New("no such orderID in db")
+var ErrAccrualAlreadyAdded = errors.New("accrual for this order already added")
+var ErrLedgerUnbalanced = errors.New("ledger is unbalanced")
+
+type ErrInsufficientFunds struct {
+	UserID    int
+	Current   money.Amount
+	Requested money.Amount
+}
+
+func (e *ErrInsufficientFunds) Error() string {
+	return fmt.Sprintf(
+		"not enough points on balance: userID=%v current=%v requested=%v",
+		e.UserID,
+		e.Current,
+		e.Requested,
+	)
+}
+
+func NewErrInsufficientFunds(userID int, current, requested money.Amount) error {
+	return &ErrInsufficientFunds{UserID: userID, Current: current, Requested: requested}
+}
+
+var (
+	// refresh-токен неизвестен или истек
+	ErrTokenNotFound = errors.New("refresh token not found")
+	// сессия токена отозвана: выход или повторное использование токена
+	ErrTokenRevoked = errors.New("refresh token revoked")
+	// токен уже обменяли на новый - скорее всего, его украли; сессия отозвана
+	ErrTokenReused = errors.New("refresh token reused")
+)
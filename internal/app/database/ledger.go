@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostEntry записывает проводку в журнал и в той же транзакции обновляет
+// балансы пользователей, чьих счетов она касается. Несбалансированная проводка
+// отклоняется до обращения к БД; кроме того, баланс каждой проводки проверяет
+// триггер при фиксации транзакции
+func (db *DatabaseService) PostEntry(ctx context.Context, entry ledger.Entry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	return db.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := db.q(ctx).QueryRow(ctx, addJournalEntrySQL, entry.Kind, entry.OrderID, entry.Memo).
+			Scan(&entry.ID, &entry.CreatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: %v", ErrAccrualAlreadyAdded, entry.OrderID)
+			}
+			return err
+		}
+		for _, p := range entry.Postings {
+			_, err := db.q(ctx).Exec(ctx, addPostingSQL, entry.ID, p.Account, p.Amount)
+			if err != nil {
+				return err
+			}
+			userID, err := p.Account.UserID()
+			if err != nil {
+				// системный счет - проекции баланса у него нет
+				continue
+			}
+			// списания уменьшают баланс и увеличивают "списано", возвраты - наоборот
+			withdrawn := int64(0)
+			if entry.Kind == ledger.KindWithdrawal || entry.Kind == ledger.KindRefund {
+				withdrawn = -int64(p.Amount)
+			}
+			_, err = db.q(ctx).Exec(ctx, updateBalanceSQL, userID, p.Amount, withdrawn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
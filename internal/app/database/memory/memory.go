@@ -0,0 +1,447 @@
+// Package memory - хранилище gophermart в памяти процесса: реализация
+// database.Service и ordertracker.Tracker без Postgres для локального
+// запуска и тестов. Ошибки те же, что у реализаций на Postgres; данные
+// теряются при остановке процесса.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/jackc/pgx/v5"
+)
+
+// store - общие данные Service и Tracker; все обращения идут через run
+type store struct {
+	mu         sync.Mutex
+	users      map[string]*models.User
+	nextUserID int
+	orders     map[string]*models.Order
+	entries    []ledger.Entry
+	// заказы, за которые уже начислены баллы
+	accrued  map[string]bool
+	balances map[int]models.Balance
+	queue    map[string]*queueItem
+	// время добавления в очередь - для порядка задач с одинаковым сроком
+	queueSeq    int64
+	subscribers map[chan struct{}]struct{}
+	// сессии, refresh-токены по sha256 и отозванные access-токены
+	sessions      map[string]*session
+	refreshTokens map[string]*refreshToken
+	revokedTokens map[string]time.Time
+	// токены сброса пароля по sha256
+	resetTokens map[string]*resetToken
+	now         func() time.Time
+}
+
+func newStore() *store {
+	return &store{
+		users:         make(map[string]*models.User),
+		orders:        make(map[string]*models.Order),
+		accrued:       make(map[string]bool),
+		balances:      make(map[int]models.Balance),
+		queue:         make(map[string]*queueItem),
+		subscribers:   make(map[chan struct{}]struct{}),
+		sessions:      make(map[string]*session),
+		refreshTokens: make(map[string]*refreshToken),
+		revokedTokens: make(map[string]time.Time),
+		resetTokens:   make(map[string]*resetToken),
+		now:           time.Now,
+	}
+}
+
+// Service - database.Service в памяти
+type Service struct {
+	store   *store
+	tracker *Tracker
+}
+
+// NewService создает пустое хранилище; policy и leaseDuration работают
+// так же, как у очереди в Postgres
+func NewService(policy ordertracker.RetryPolicy, leaseDuration time.Duration) *Service {
+	s := newStore()
+	return &Service{
+		store:   s,
+		tracker: &Tracker{store: s, policy: policy, leaseDuration: leaseDuration},
+	}
+}
+
+// WithinTransaction выполняет fn в одной транзакции: все вызовы Service и
+// трекера с переданным в fn контекстом либо сохраняются вместе, либо
+// отменяются, если fn вернула ошибку. Пока транзакция открыта, остальные
+// обращения к хранилищу ждут
+func (db *Service) WithinTransaction(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		return fn(ctx)
+	})
+}
+
+func (db *Service) Tracker() ordertracker.Tracker {
+	return db.tracker
+}
+
+func (db *Service) AddUser(
+	ctx context.Context,
+	username, passwordHash string,
+) (*models.User, error) {
+	log.Printf("Adding user %v...", username)
+	user := &models.User{Username: username, HashedPassword: passwordHash}
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		s := t.store
+		if _, ok := s.users[username]; ok {
+			return fmt.Errorf("%w: %v", database.ErrUserAlreadyExists, username)
+		}
+		s.nextUserID++
+		user.ID = s.nextUserID
+		s.users[username] = user
+		s.balances[user.ID] = models.Balance{}
+		t.onRollback(func() {
+			delete(s.users, username)
+			delete(s.balances, user.ID)
+			s.nextUserID--
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (db *Service) FindUser(
+	ctx context.Context,
+	username string,
+) (*models.User, error) {
+	var user models.User
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		found, ok := t.store.users[username]
+		if !ok {
+			return fmt.Errorf("%w: %v", database.ErrUserNotFound, username)
+		}
+		user = *found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdatePasswordHash заменяет хэш, только если он все еще равен oldHash
+func (db *Service) UpdatePasswordHash(
+	ctx context.Context,
+	userID int,
+	oldHash, newHash string,
+) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		for _, user := range t.store.users {
+			if user.ID != userID || user.HashedPassword != oldHash {
+				continue
+			}
+			user.HashedPassword = newHash
+			t.onRollback(func() { user.HashedPassword = oldHash })
+		}
+		return nil
+	})
+}
+
+// FindOrderByID, как и реализация на Postgres, возвращает pgx.ErrNoRows,
+// если заказа нет
+func (db *Service) FindOrderByID(
+	ctx context.Context,
+	orderID string,
+) (*models.Order, error) {
+	var order models.Order
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		found, ok := t.store.orders[orderID]
+		if !ok {
+			return pgx.ErrNoRows
+		}
+		order = models.Order{
+			ID:         found.ID,
+			UserID:     found.UserID,
+			StatusID:   found.StatusID,
+			UploadedAt: found.UploadedAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (db *Service) AddOrder(
+	ctx context.Context,
+	orderID string,
+	userID int,
+) error {
+	log.Printf("Adding order orderID=%v userID=%v...", orderID, userID)
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		s := t.store
+		if order, ok := s.orders[orderID]; ok {
+			if order.UserID == userID {
+				return fmt.Errorf(
+					"%w: orderID=%v userID=%v",
+					database.ErrOrderAlreadyAddedByThisUser,
+					orderID,
+					userID,
+				)
+			}
+			return fmt.Errorf(
+				"%w: orderID=%v userID=%v",
+				database.ErrOrderAlreadyAddedByOtherUser,
+				orderID,
+				userID,
+			)
+		}
+		s.orders[orderID] = &models.Order{
+			ID:         orderID,
+			UserID:     userID,
+			StatusID:   database.STATUSES[string(models.StatusNew)],
+			UploadedAt: s.now(),
+		}
+		t.onRollback(func() { delete(s.orders, orderID) })
+		return nil
+	})
+}
+
+func (db *Service) UpdateOrderStatus(ctx context.Context, orderID, newStatus string) error {
+	statusID, ok := database.STATUSES[newStatus]
+	if !ok {
+		return fmt.Errorf("%w: %q", models.ErrUnknownStatus, newStatus)
+	}
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		order, ok := t.store.orders[orderID]
+		if !ok {
+			return nil
+		}
+		prev := order.StatusID
+		order.StatusID = statusID
+		t.onRollback(func() { order.StatusID = prev })
+		return nil
+	})
+}
+
+// LockOrderStatus возвращает статус заказа; хранилище и так заблокировано
+// на время транзакции
+func (db *Service) LockOrderStatus(
+	ctx context.Context,
+	orderID string,
+) (models.OrderStatus, error) {
+	var status models.OrderStatus
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		order, ok := t.store.orders[orderID]
+		if !ok {
+			return fmt.Errorf("%w: %v", database.ErrMissingOrderID, orderID)
+		}
+		var err error
+		status, err = database.StatusByID(order.StatusID)
+		return err
+	})
+	return status, err
+}
+
+// AddAccrualRecord начисляет баллы за заказ владельцу заказа. Нулевое
+// начисление ничего не меняет в журнале и не записывается
+func (db *Service) AddAccrualRecord(
+	ctx context.Context,
+	orderID string,
+	sum money.Amount,
+) error {
+	log.Printf("Adding accrual record orderID=%v sum=%v...", orderID, sum)
+	if sum == 0 {
+		return nil
+	}
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		order, ok := t.store.orders[orderID]
+		if !ok {
+			return fmt.Errorf("%w: %v", database.ErrMissingOrderID, orderID)
+		}
+		return t.post(ledger.Accrual(order.UserID, orderID, sum))
+	})
+}
+
+func (db *Service) FindOrdersByUserID(
+	ctx context.Context,
+	userID int,
+	query models.ListQuery,
+) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		s := t.store
+		accruals := make(map[string]money.Amount)
+		account := ledger.UserAccount(userID)
+		for _, e := range s.entries {
+			if e.Kind == ledger.KindAccrual {
+				accruals[e.OrderID] += e.AmountFor(account)
+			}
+		}
+		for _, o := range s.orders {
+			if o.UserID != userID || !query.Match(o.UploadedAt, o.ID, 0) {
+				continue
+			}
+			status, err := database.StatusByID(o.StatusID)
+			if err != nil {
+				return err
+			}
+			if !query.HasStatus(status) {
+				continue
+			}
+			order := models.Order{ID: o.ID, Status: string(status), UploadedAt: o.UploadedAt}
+			if sum, ok := accruals[o.ID]; ok {
+				order.Accrual = money.NullAmount{Amount: sum, Valid: true}
+			}
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, database.ErrEmptyResult
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return models.Cursor{At: orders[i].UploadedAt, Order: orders[i].ID}.
+			Before(orders[j].UploadedAt, orders[j].ID, 0)
+	})
+	return limit(orders, query.Limit), nil
+}
+
+func (db *Service) GetBalance(ctx context.Context, userID int) (*models.Balance, error) {
+	var balance models.Balance
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		balance = t.store.balances[userID]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// AddWithdrawalRecord списывает sum с баланса пользователя; проверка и
+// списание выполняются в одной транзакции
+func (db *Service) AddWithdrawalRecord(
+	ctx context.Context,
+	orderID string,
+	sum money.Amount,
+	userID int,
+) error {
+	log.Printf("Adding withdrawal record orderID=%v sum=%v...", orderID, sum)
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		balance := t.store.balances[userID]
+		if balance.Current < sum {
+			return database.NewErrInsufficientFunds(userID, balance.Current, sum)
+		}
+		return t.post(ledger.Withdrawal(userID, orderID, sum))
+	})
+}
+
+func (db *Service) GetWithdrawals(
+	ctx context.Context,
+	userID int,
+	query models.ListQuery,
+) ([]models.Withdrawal, error) {
+	withdrawals := make([]models.Withdrawal, 0)
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		account := ledger.UserAccount(userID)
+		for _, e := range t.store.entries {
+			if e.Kind != ledger.KindWithdrawal || !query.Match(e.CreatedAt, e.OrderID, e.ID) {
+				continue
+			}
+			if sum := e.AmountFor(account); sum != 0 {
+				withdrawals = append(withdrawals, models.Withdrawal{
+					Order:       e.OrderID,
+					Sum:         -sum,
+					ProcessedAt: e.CreatedAt,
+					EntryID:     e.ID,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(withdrawals) == 0 {
+		return nil, database.ErrEmptyResult
+	}
+	sort.SliceStable(withdrawals, func(i, j int) bool {
+		return withdrawals[i].Cursor().
+			Before(withdrawals[j].ProcessedAt, withdrawals[j].Order, withdrawals[j].EntryID)
+	})
+	return limit(withdrawals, query.Limit), nil
+}
+
+// limit оставляет первые n элементов; n <= 0 - все
+func limit[T any](items []T, n int) []T {
+	if n > 0 && len(items) > n {
+		return items[:n]
+	}
+	return items
+}
+
+// PostEntry записывает проводку в журнал и обновляет балансы пользователей,
+// чьих счетов она касается
+func (db *Service) PostEntry(ctx context.Context, entry ledger.Entry) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		return t.post(entry)
+	})
+}
+
+// post проверяет проводку, добавляет ее в журнал и пересчитывает балансы
+func (t *tx) post(entry ledger.Entry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	s := t.store
+	if entry.Kind == ledger.KindAccrual {
+		// начисление по заказу может быть только одно
+		if s.accrued[entry.OrderID] {
+			return fmt.Errorf("%w: %v", database.ErrAccrualAlreadyAdded, entry.OrderID)
+		}
+		s.accrued[entry.OrderID] = true
+		t.onRollback(func() { delete(s.accrued, entry.OrderID) })
+	}
+	entry.ID = int64(len(s.entries) + 1)
+	entry.CreatedAt = s.now()
+	entry.Postings = append([]ledger.Posting(nil), entry.Postings...)
+	s.entries = append(s.entries, entry)
+	t.onRollback(func() { s.entries = s.entries[:len(s.entries)-1] })
+	for _, p := range entry.Postings {
+		userID, err := p.Account.UserID()
+		if err != nil {
+			// системный счет - проекции баланса у него нет
+			continue
+		}
+		prev := s.balances[userID]
+		balance := prev
+		balance.Current += p.Amount
+		// списания уменьшают баланс и увеличивают "списано", возвраты - наоборот
+		if entry.Kind == ledger.KindWithdrawal || entry.Kind == ledger.KindRefund {
+			balance.Withdrawn -= p.Amount
+		}
+		s.balances[userID] = balance
+		t.onRollback(func() { s.balances[userID] = prev })
+	}
+	return nil
+}
+
+func (db *Service) Close() {
+	log.Println("Closing in-memory storage...")
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/conformance"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(
+		t *testing.T,
+		policy ordertracker.RetryPolicy,
+		lease time.Duration,
+	) database.Service {
+		return NewService(policy, lease)
+	})
+}
+
+func TestPanicRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := NewService(ordertracker.RetryPolicy{}, time.Minute)
+	user, err := db.AddUser(ctx, "nikita", "123")
+	require.NoError(t, err)
+	require.NoError(t, db.AddOrder(ctx, "18", user.ID))
+
+	assert.Panics(t, func() {
+		db.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := db.AddAccrualRecord(ctx, "18", money.FromUnits(100)); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+	// хранилище разблокировано, начисление отменено
+	balance, err := db.GetBalance(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, money.Amount(0), balance.Current)
+}
+
+func TestNestedRollback(t *testing.T) {
+	ctx := context.Background()
+	db := NewService(ordertracker.RetryPolicy{}, time.Minute)
+	user, err := db.AddUser(ctx, "nikita", "123")
+	require.NoError(t, err)
+	errAbort := errors.New("abort")
+
+	err = db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := db.AddOrder(ctx, "18", user.ID); err != nil {
+			return err
+		}
+		// вложенная транзакция откатывается отдельно, как SAVEPOINT
+		err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := db.AddOrder(ctx, "26", user.ID); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		return nil
+	})
+	require.NoError(t, err)
+
+	orders, err := db.FindOrdersByUserID(ctx, user.ID, models.ListQuery{})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "18", orders[0].ID)
+}
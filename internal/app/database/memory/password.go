@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+type resetToken struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+func (t *tx) userByID(userID int) (*models.User, error) {
+	for _, user := range t.store.users {
+		if user.ID == userID {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: id=%v", database.ErrUserNotFound, userID)
+}
+
+func (db *Service) FindUserByID(ctx context.Context, userID int) (*models.User, error) {
+	var user models.User
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		found, err := t.userByID(userID)
+		if err != nil {
+			return err
+		}
+		user = *found
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *Service) SetPasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		user, err := t.userByID(userID)
+		if err != nil {
+			return err
+		}
+		oldHash := user.HashedPassword
+		user.HashedPassword = passwordHash
+		t.onRollback(func() { user.HashedPassword = oldHash })
+		return nil
+	})
+}
+
+func (db *Service) RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		for id, s := range t.store.sessions {
+			if s.UserID == userID && id != exceptSessionID {
+				t.revokeSession(s)
+			}
+		}
+		return nil
+	})
+}
+
+func (db *Service) CreateResetToken(
+	ctx context.Context,
+	userID int,
+	tokenHash string,
+	ttl time.Duration,
+) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		st := t.store
+		for hash, token := range st.resetTokens {
+			if token.userID == userID || !st.now().Before(token.expiresAt) {
+				delete(st.resetTokens, hash)
+				hash, token := hash, token
+				t.onRollback(func() { st.resetTokens[hash] = token })
+			}
+		}
+		st.resetTokens[tokenHash] = &resetToken{userID: userID, expiresAt: st.now().Add(ttl)}
+		t.onRollback(func() { delete(st.resetTokens, tokenHash) })
+		return nil
+	})
+}
+
+func (db *Service) ConsumeResetToken(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		token, ok := t.store.resetTokens[tokenHash]
+		if !ok || token.used || !t.store.now().Before(token.expiresAt) {
+			return database.ErrTokenNotFound
+		}
+		token.used = true
+		t.onRollback(func() { token.used = false })
+		userID = token.userID
+		return nil
+	})
+	return userID, err
+}
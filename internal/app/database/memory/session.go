@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+type session struct {
+	models.Session
+	revoked bool
+}
+
+type refreshToken struct {
+	sessionID string
+	expiresAt time.Time
+	used      bool
+}
+
+func (db *Service) CreateSession(
+	ctx context.Context,
+	s models.Session,
+	refreshHash string,
+	ttl time.Duration,
+) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		st := t.store
+		if _, ok := st.sessions[s.ID]; ok {
+			return fmt.Errorf("session %v already exists", s.ID)
+		}
+		st.sessions[s.ID] = &session{Session: s}
+		st.refreshTokens[refreshHash] = &refreshToken{sessionID: s.ID, expiresAt: st.now().Add(ttl)}
+		t.onRollback(func() {
+			delete(st.sessions, s.ID)
+			delete(st.refreshTokens, refreshHash)
+		})
+		return nil
+	})
+}
+
+// RotateRefreshToken, как и реализация на Postgres, при повторном
+// использовании токена отзывает сессию и возвращает ErrTokenReused
+func (db *Service) RotateRefreshToken(
+	ctx context.Context,
+	oldHash, newHash string,
+	ttl time.Duration,
+) (*models.Session, error) {
+	var result models.Session
+	var reused bool
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		st := t.store
+		token, ok := st.refreshTokens[oldHash]
+		if !ok {
+			return database.ErrTokenNotFound
+		}
+		s := st.sessions[token.sessionID]
+		result = s.Session
+		switch {
+		case s.revoked:
+			return fmt.Errorf("%w: session %v", database.ErrTokenRevoked, s.ID)
+		case token.used:
+			reused = true
+			t.revokeSession(s)
+			return nil
+		case !st.now().Before(token.expiresAt):
+			return database.ErrTokenNotFound
+		}
+		token.used = true
+		st.refreshTokens[newHash] = &refreshToken{sessionID: s.ID, expiresAt: st.now().Add(ttl)}
+		t.onRollback(func() {
+			token.used = false
+			delete(st.refreshTokens, newHash)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		log.Printf("Refresh token reuse detected: revoked session %v of user %v", result.ID, result.UserID)
+		return nil, fmt.Errorf("%w: session %v", database.ErrTokenReused, result.ID)
+	}
+	return &result, nil
+}
+
+func (db *Service) RevokeSession(ctx context.Context, sessionID string) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		if s, ok := t.store.sessions[sessionID]; ok {
+			t.revokeSession(s)
+		}
+		return nil
+	})
+}
+
+func (t *tx) revokeSession(s *session) {
+	if s.revoked {
+		return
+	}
+	s.revoked = true
+	t.onRollback(func() { s.revoked = false })
+}
+
+func (db *Service) RevokeAccessToken(ctx context.Context, jti string, ttl time.Duration) error {
+	return db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		st := t.store
+		// истекшие токены проверять незачем
+		for old, expiresAt := range st.revokedTokens {
+			if !st.now().Before(expiresAt) {
+				delete(st.revokedTokens, old)
+			}
+		}
+		if _, ok := st.revokedTokens[jti]; ok {
+			return nil
+		}
+		st.revokedTokens[jti] = st.now().Add(ttl)
+		t.onRollback(func() { delete(st.revokedTokens, jti) })
+		return nil
+	})
+}
+
+func (db *Service) IsAccessTokenRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	var revoked bool
+	err := db.store.run(ctx, func(ctx context.Context, t *tx) error {
+		st := t.store
+		if expiresAt, ok := st.revokedTokens[jti]; ok && st.now().Before(expiresAt) {
+			revoked = true
+			return nil
+		}
+		s, ok := st.sessions[sessionID]
+		revoked = !ok || s.revoked
+		return nil
+	})
+	return revoked, err
+}
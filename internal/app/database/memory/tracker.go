@@ -0,0 +1,279 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/jackc/pgx/v5"
+)
+
+// queueItem - задача очереди вместе с арендой и расписанием
+type queueItem struct {
+	task          ordertracker.Task
+	lockedBy      string
+	lockedUntil   time.Time
+	nextAttemptAt time.Time
+	seq           int64
+}
+
+// ready сообщает, можно ли взять задачу в работу в момент now
+func (it *queueItem) ready(now time.Time) bool {
+	switch it.task.StatusID {
+	case 0, 1, 2:
+	default:
+		return false
+	}
+	return it.task.DeadAt.IsZero() &&
+		!it.nextAttemptAt.After(now) &&
+		(it.lockedUntil.IsZero() || it.lockedUntil.Before(now))
+}
+
+// Tracker - ordertracker.Tracker в памяти; создается вместе с Service и
+// участвует в его транзакциях
+type Tracker struct {
+	store         *store
+	policy        ordertracker.RetryPolicy
+	leaseDuration time.Duration
+}
+
+// Acquire, как и реализация на Postgres, возвращает pgx.ErrNoRows, если
+// брать нечего
+func (q *Tracker) Acquire(ctx context.Context, owner string) (*ordertracker.Task, error) {
+	tasks, err := q.AcquireBatch(ctx, owner, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return tasks[0], nil
+}
+
+func (q *Tracker) AcquireBatch(
+	ctx context.Context,
+	owner string,
+	limit int,
+) ([]*ordertracker.Task, error) {
+	tasks := make([]*ordertracker.Task, 0, limit)
+	err := q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		now := t.store.now()
+		for _, it := range q.readyItems(now) {
+			if len(tasks) == limit {
+				break
+			}
+			prev := *it
+			it.lockedUntil = now.Add(q.leaseDuration)
+			it.lockedBy = owner
+			it.task.Owner = owner
+			it.task.LeaseUntil = it.lockedUntil
+			// владелец задачи без действующей аренды - упавший воркер
+			it.task.Reclaimed = prev.lockedBy != ""
+			t.onRollback(func() { *it = prev })
+			task := it.task
+			tasks = append(tasks, &task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// readyItems возвращает задачи, которые можно взять в работу, начиная с
+// самых "старых"
+func (q *Tracker) readyItems(now time.Time) []*queueItem {
+	items := make([]*queueItem, 0)
+	for _, it := range q.store.queue {
+		if it.ready(now) {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].nextAttemptAt.Equal(items[j].nextAttemptAt) {
+			return items[i].seq < items[j].seq
+		}
+		return items[i].nextAttemptAt.Before(items[j].nextAttemptAt)
+	})
+	return items
+}
+
+func (q *Tracker) Depth(ctx context.Context) (int, error) {
+	var depth int
+	err := q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		depth = len(q.readyItems(t.store.now()))
+		return nil
+	})
+	return depth, err
+}
+
+// leased возвращает задачу, если ее аренда все еще у task.Owner
+func (q *Tracker) leased(task *ordertracker.Task) (*queueItem, error) {
+	it, ok := q.store.queue[task.OrderID]
+	if !ok || it.lockedBy != task.Owner {
+		return nil, fmt.Errorf(
+			"%w: orderID=%v owner=%v",
+			ordertracker.ErrLeaseLost,
+			task.OrderID,
+			task.Owner,
+		)
+	}
+	return it, nil
+}
+
+func (q *Tracker) UpdateStatusAndRelease(
+	ctx context.Context,
+	task *ordertracker.Task,
+	newStatusID int,
+) error {
+	return q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		it, err := q.leased(task)
+		if err != nil {
+			return err
+		}
+		prev := *it
+		t.onRollback(func() { *it = prev })
+		now := t.store.now()
+		it.task.Attempts++
+		it.task.StatusID = newStatusID
+		it.lockedBy, it.lockedUntil = "", time.Time{}
+		it.task.Owner, it.task.LeaseUntil, it.task.Reclaimed = "", time.Time{}, false
+		if q.policy.Exhausted(it.task.Attempts, now.Sub(it.task.CreatedAt)) {
+			it.task.DeadAt = now
+		} else {
+			it.nextAttemptAt = now.Add(q.policy.Delay(it.task.Attempts))
+		}
+		return nil
+	})
+}
+
+func (q *Tracker) Release(ctx context.Context, task *ordertracker.Task, delay time.Duration) error {
+	return q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		it, err := q.leased(task)
+		if err != nil {
+			return err
+		}
+		prev := *it
+		t.onRollback(func() { *it = prev })
+		it.lockedBy, it.lockedUntil = "", time.Time{}
+		it.task.Owner, it.task.LeaseUntil, it.task.Reclaimed = "", time.Time{}, false
+		it.nextAttemptAt = t.store.now().Add(delay)
+		return nil
+	})
+}
+
+func (q *Tracker) Add(ctx context.Context, orderID string) error {
+	return q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		s := t.store
+		if _, ok := s.queue[orderID]; ok {
+			return fmt.Errorf("%w: orderID=%v", ordertracker.ErrTaskExists, orderID)
+		}
+		now := s.now()
+		s.queueSeq++
+		s.queue[orderID] = &queueItem{
+			task:          ordertracker.Task{OrderID: orderID, CreatedAt: now},
+			nextAttemptAt: now,
+			seq:           s.queueSeq,
+		}
+		t.onRollback(func() { delete(s.queue, orderID) })
+		t.onCommit(s.notify)
+		return nil
+	})
+}
+
+func (q *Tracker) Delete(ctx context.Context, orderID string) error {
+	return q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		s := t.store
+		it, ok := s.queue[orderID]
+		if !ok {
+			return nil
+		}
+		delete(s.queue, orderID)
+		t.onRollback(func() { s.queue[orderID] = it })
+		return nil
+	})
+}
+
+func (q *Tracker) ListDead(ctx context.Context) ([]ordertracker.Task, error) {
+	tasks := make([]ordertracker.Task, 0)
+	err := q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		for _, it := range t.store.queue {
+			if !it.task.DeadAt.IsZero() {
+				tasks = append(tasks, it.task)
+			}
+		}
+		return nil
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].DeadAt.Before(tasks[j].DeadAt)
+	})
+	return tasks, err
+}
+
+func (q *Tracker) Requeue(ctx context.Context, orderID string) error {
+	return q.store.run(ctx, func(ctx context.Context, t *tx) error {
+		it, ok := t.store.queue[orderID]
+		if !ok || it.task.DeadAt.IsZero() {
+			return fmt.Errorf("%w: no dead task with orderID=%v", ordertracker.ErrTaskNotFound, orderID)
+		}
+		prev := *it
+		t.onRollback(func() { *it = prev })
+		now := t.store.now()
+		it.task.Attempts = 0
+		it.task.DeadAt = time.Time{}
+		it.task.CreatedAt = now
+		it.nextAttemptAt = now
+		t.onCommit(t.store.notify)
+		return nil
+	})
+}
+
+// Notifications возвращает канал, в который приходит сигнал после фиксации
+// добавления задачи. Первый сигнал приходит сразу, как и у реализации на
+// Postgres; канал закрывается после отмены ctx
+func (q *Tracker) Notifications(ctx context.Context) <-chan struct{} {
+	s := q.store
+	in := make(chan struct{}, 1)
+	in <- struct{}{}
+	s.mu.Lock()
+	s.subscribers[in] = struct{}{}
+	s.mu.Unlock()
+
+	out := make(chan struct{})
+	go func() {
+		defer close(out)
+		defer func() {
+			s.mu.Lock()
+			delete(s.subscribers, in)
+			s.mu.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-in:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- struct{}{}:
+			}
+		}
+	}()
+	return out
+}
+
+// notify будит подписчиков; непрочитанные сигналы склеиваются
+func (s *store) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
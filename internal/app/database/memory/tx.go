@@ -0,0 +1,72 @@
+package memory
+
+import "context"
+
+type txKey struct{}
+
+// tx - транзакция хранилища в памяти. Пока она открыта, хранилище
+// заблокировано целиком; изменения сразу видны внутри транзакции, а при
+// откате отменяются в обратном порядке
+type tx struct {
+	store *store
+	undo  []func()
+	// выполняется после фиксации внешней транзакции
+	afterCommit []func()
+}
+
+// onRollback запоминает, как отменить только что сделанное изменение
+func (t *tx) onRollback(fn func()) {
+	t.undo = append(t.undo, fn)
+}
+
+// onCommit откладывает fn до фиксации: так уведомления не уходят раньше данных
+func (t *tx) onCommit(fn func()) {
+	t.afterCommit = append(t.afterCommit, fn)
+}
+
+// rollbackTo отменяет изменения, сделанные после точки сохранения mark
+func (t *tx) rollbackTo(mark int) {
+	for i := len(t.undo) - 1; i >= mark; i-- {
+		t.undo[i]()
+	}
+	t.undo = t.undo[:mark]
+}
+
+// run выполняет fn в транзакции хранилища. Если транзакция уже открыта в
+// ctx, fn выполняется во вложенной: при ошибке откатываются только ее
+// изменения, как при SAVEPOINT в Postgres
+func (s *store) run(ctx context.Context, fn func(ctx context.Context, t *tx) error) error {
+	if t, ok := ctx.Value(txKey{}).(*tx); ok && t.store == s {
+		mark, commitMark := len(t.undo), len(t.afterCommit)
+		if err := fn(ctx, t); err != nil {
+			t.rollbackTo(mark)
+			t.afterCommit = t.afterCommit[:commitMark]
+			return err
+		}
+		return nil
+	}
+	t := &tx{store: s}
+	err := func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		committed := false
+		// паника в fn тоже откатывает транзакцию
+		defer func() {
+			if !committed {
+				t.rollbackTo(0)
+			}
+		}()
+		if err := fn(context.WithValue(ctx, txKey{}, t), t); err != nil {
+			return err
+		}
+		committed = true
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	for _, fn := range t.afterCommit {
+		fn()
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS queue_next_attempt_at_idx;
+
+ALTER TABLE Queue
+	DROP COLUMN IF EXISTS attempts,
+	DROP COLUMN IF EXISTS next_attempt_at,
+	DROP COLUMN IF EXISTS created_at,
+	DROP COLUMN IF EXISTS dead_at;
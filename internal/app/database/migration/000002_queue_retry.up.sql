@@ -0,0 +1,9 @@
+ALTER TABLE Queue
+	ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	ADD COLUMN dead_at TIMESTAMP;
+
+UPDATE Queue SET created_at = updated_at WHERE updated_at IS NOT NULL;
+
+CREATE INDEX queue_next_attempt_at_idx ON Queue(next_attempt_at) WHERE dead_at IS NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE Queue ADD COLUMN lock BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE Queue SET lock = TRUE WHERE locked_until > NOW();
+
+ALTER TABLE Queue
+	DROP COLUMN IF EXISTS locked_by,
+	DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,8 @@
+ALTER TABLE Queue
+	ADD COLUMN locked_by VARCHAR,
+	ADD COLUMN locked_until TIMESTAMP;
+
+-- владельцы старых блокировок неизвестны: считаем их аренду истекшей
+UPDATE Queue SET locked_by = 'unknown', locked_until = NOW() WHERE lock;
+
+ALTER TABLE Queue DROP COLUMN lock;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS transaction_one_accrual_per_order_idx;
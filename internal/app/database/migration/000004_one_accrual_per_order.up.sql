@@ -0,0 +1,12 @@
+-- задвоенные начисления - следствие гонки при обработке заказа;
+-- оставляем первое, чтобы можно было построить индекс
+DELETE FROM Transaction t
+USING Transaction d
+WHERE t.transaction_type_id = 1
+	AND d.transaction_type_id = 1
+	AND t.order_id = d.order_id
+	AND t.id > d.id;
+
+CREATE UNIQUE INDEX transaction_one_accrual_per_order_idx
+	ON Transaction(order_id)
+	WHERE transaction_type_id = 1;
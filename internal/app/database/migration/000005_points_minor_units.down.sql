@@ -0,0 +1 @@
+ALTER TABLE Transaction ALTER COLUMN sum TYPE DOUBLE PRECISION USING sum / 100.0;
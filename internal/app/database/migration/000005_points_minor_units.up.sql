@@ -0,0 +1,2 @@
+-- баллы храним целым числом сотых, чтобы суммы складывались без погрешности
+ALTER TABLE Transaction ALTER COLUMN sum TYPE BIGINT USING ROUND(sum * 100)::BIGINT;
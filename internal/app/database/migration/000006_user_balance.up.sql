@@ -0,0 +1,22 @@
+-- текущий баланс пользователя - проекция истории операций: обновляется в той
+-- же транзакции, что и запись операции, и сверяется с историей командой
+-- reconcile. Здесь история - Transaction, с 000007 - журнал проводок
+CREATE TABLE UserBalance(
+	user_id INTEGER PRIMARY KEY,
+	current BIGINT NOT NULL DEFAULT 0,
+	withdrawn BIGINT NOT NULL DEFAULT 0,
+	version BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES UserAccount(id),
+	CONSTRAINT current_non_negative CHECK (current >= 0)
+);
+
+INSERT INTO UserBalance(user_id, current, withdrawn)
+SELECT u.id,
+	COALESCE(SUM(CASE WHEN t.transaction_type_id=1 THEN t.sum END), 0) -
+	COALESCE(SUM(CASE WHEN t.transaction_type_id=2 THEN t.sum END), 0),
+	COALESCE(SUM(CASE WHEN t.transaction_type_id=2 THEN t.sum END), 0)
+FROM UserAccount u
+LEFT JOIN UserOrder o ON o.user_id = u.id
+LEFT JOIN Transaction t ON t.order_id = o.id
+GROUP BY u.id;
@@ -0,0 +1,45 @@
+-- возвраты, корректировки и сгорания в старой схеме не выражаются и теряются
+CREATE TABLE TransactionType(
+	id SERIAL PRIMARY KEY,
+	type VARCHAR NOT NULL
+);
+INSERT INTO TransactionType(type) VALUES
+('ACCRUAL'), ('WITHDRAWAL');
+
+CREATE TABLE Transaction(
+	id SERIAL PRIMARY KEY,
+	order_id VARCHAR NOT NULL,
+	sum BIGINT NOT NULL,
+	transaction_type_id INTEGER NOT NULL,
+	processed_at TIMESTAMP DEFAULT NOW(),
+	CONSTRAINT fk_transaction_type_id
+		FOREIGN KEY (transaction_type_id) REFERENCES TransactionType(id),
+	CONSTRAINT fk_order_id FOREIGN KEY (order_id) REFERENCES UserOrder(id)
+);
+CREATE UNIQUE INDEX transaction_one_accrual_per_order_idx
+	ON Transaction(order_id)
+	WHERE transaction_type_id = 1;
+
+-- старая схема требует заказ для каждого списания
+INSERT INTO UserOrder(id, user_id, uploaded_at)
+SELECT DISTINCT ON (e.order_id) e.order_id, a.user_id, e.created_at
+FROM JournalEntry e
+JOIN Posting p ON p.entry_id = e.id
+JOIN LedgerAccount a ON a.id = p.account_id AND a.user_id IS NOT NULL
+WHERE e.kind = 'WITHDRAWAL'
+	AND NOT EXISTS (SELECT 1 FROM UserOrder o WHERE o.id = e.order_id)
+ORDER BY e.order_id, e.created_at;
+
+INSERT INTO Transaction(order_id, sum, transaction_type_id, processed_at)
+SELECT e.order_id, ABS(p.amount), tt.id, e.created_at
+FROM JournalEntry e
+JOIN Posting p ON p.entry_id = e.id
+JOIN LedgerAccount a ON a.id = p.account_id AND a.user_id IS NOT NULL
+JOIN TransactionType tt ON tt.type = e.kind
+ORDER BY e.id;
+
+DROP TABLE Posting;
+DROP TABLE JournalEntry;
+DROP TABLE LedgerAccount;
+DROP FUNCTION IF EXISTS ledger_check_entry_balanced();
+DROP FUNCTION IF EXISTS ledger_forbid_changes();
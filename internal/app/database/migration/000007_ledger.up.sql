@@ -0,0 +1,116 @@
+-- двойная запись: каждая проводка (JournalEntry) состоит из движений по счетам
+-- (Posting), сумма которых равна нулю. Заменяет одностороннюю таблицу Transaction
+CREATE TABLE LedgerAccount(
+	id VARCHAR PRIMARY KEY,
+	user_id INTEGER UNIQUE,
+	CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES UserAccount(id)
+);
+INSERT INTO LedgerAccount(id) VALUES
+('system:accrual'), ('system:withdrawal'), ('system:adjustment'), ('system:expiration');
+INSERT INTO LedgerAccount(id, user_id) SELECT 'user:' || id, id FROM UserAccount;
+
+
+CREATE TABLE JournalEntry(
+	id BIGSERIAL PRIMARY KEY,
+	kind VARCHAR NOT NULL,
+	order_id VARCHAR,
+	memo VARCHAR,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	CONSTRAINT kind_known
+		CHECK (kind IN ('ACCRUAL', 'WITHDRAWAL', 'REFUND', 'CORRECTION', 'EXPIRATION'))
+);
+CREATE UNIQUE INDEX journal_one_accrual_per_order_idx
+	ON JournalEntry(order_id)
+	WHERE kind = 'ACCRUAL';
+
+
+CREATE TABLE Posting(
+	id BIGSERIAL PRIMARY KEY,
+	entry_id BIGINT NOT NULL,
+	account_id VARCHAR NOT NULL,
+	amount BIGINT NOT NULL,
+	CONSTRAINT fk_entry_id FOREIGN KEY (entry_id) REFERENCES JournalEntry(id),
+	CONSTRAINT fk_account_id FOREIGN KEY (account_id) REFERENCES LedgerAccount(id),
+	CONSTRAINT amount_non_zero CHECK (amount <> 0)
+);
+CREATE INDEX posting_entry_id_idx ON Posting(entry_id);
+CREATE INDEX posting_account_id_idx ON Posting(account_id);
+
+
+-- проводка проверяется в конце транзакции, когда добавлены все ее движения
+CREATE FUNCTION ledger_check_entry_balanced() RETURNS TRIGGER AS $$
+DECLARE
+	n INTEGER;
+	total BIGINT;
+BEGIN
+	SELECT COUNT(*), COALESCE(SUM(amount), 0) INTO n, total
+	FROM Posting WHERE entry_id = NEW.entry_id;
+	IF n < 2 OR total <> 0 THEN
+		RAISE EXCEPTION 'journal entry % is unbalanced: % postings, sum %', NEW.entry_id, n, total
+			USING ERRCODE = 'check_violation';
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER posting_balanced
+	AFTER INSERT ON Posting
+	DEFERRABLE INITIALLY DEFERRED
+	FOR EACH ROW EXECUTE FUNCTION ledger_check_entry_balanced();
+
+-- журнал только дополняется: ошибки исправляются новыми проводками
+CREATE FUNCTION ledger_forbid_changes() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger is append-only' USING ERRCODE = 'restrict_violation';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entry_append_only
+	BEFORE UPDATE OR DELETE ON JournalEntry
+	FOR EACH ROW EXECUTE FUNCTION ledger_forbid_changes();
+
+CREATE TRIGGER posting_append_only
+	BEFORE UPDATE OR DELETE ON Posting
+	FOR EACH ROW EXECUTE FUNCTION ledger_forbid_changes();
+
+
+-- переносим историю из Transaction: каждая запись - проводка из двух движений
+ALTER TABLE JournalEntry ADD COLUMN legacy_transaction_id INTEGER;
+
+INSERT INTO JournalEntry(kind, order_id, created_at, legacy_transaction_id)
+SELECT tt.type, t.order_id, COALESCE(t.processed_at, NOW()), t.id
+FROM Transaction t
+JOIN TransactionType tt ON tt.id = t.transaction_type_id
+WHERE t.sum <> 0
+ORDER BY t.id;
+
+INSERT INTO Posting(entry_id, account_id, amount)
+SELECT e.id, 'user:' || o.user_id, CASE WHEN e.kind = 'ACCRUAL' THEN t.sum ELSE -t.sum END
+FROM JournalEntry e
+JOIN Transaction t ON t.id = e.legacy_transaction_id
+JOIN UserOrder o ON o.id = t.order_id
+UNION ALL
+SELECT e.id,
+	CASE WHEN e.kind = 'ACCRUAL' THEN 'system:accrual' ELSE 'system:withdrawal' END,
+	CASE WHEN e.kind = 'ACCRUAL' THEN -t.sum ELSE t.sum END
+FROM JournalEntry e
+JOIN Transaction t ON t.id = e.legacy_transaction_id;
+
+ALTER TABLE JournalEntry DROP COLUMN legacy_transaction_id;
+
+DROP TABLE Transaction;
+DROP TABLE TransactionType;
+
+-- старое списание добавляло заказ, если его не было, и такие заказы
+-- показывались в списке загруженных. Журналу заказ не нужен. Заказ создан
+-- списанием, если по нему есть списание, но он не попадал в очередь и не
+-- получал начислений
+DELETE FROM UserOrder o
+WHERE o.status_id = 0
+	AND EXISTS (
+		SELECT 1 FROM JournalEntry e WHERE e.order_id = o.id AND e.kind = 'WITHDRAWAL'
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM JournalEntry e WHERE e.order_id = o.id AND e.kind = 'ACCRUAL'
+	)
+	AND NOT EXISTS (SELECT 1 FROM Queue q WHERE q.order_id = o.id);
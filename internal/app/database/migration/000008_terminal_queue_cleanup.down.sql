@@ -0,0 +1,3 @@
+-- удаленные задачи не восстанавливаются: для заказов в терминальных статусах
+-- они не нужны
+SELECT 1;
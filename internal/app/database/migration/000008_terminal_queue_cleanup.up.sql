@@ -0,0 +1,5 @@
+-- заказы в терминальных статусах (INVALID, PROCESSED) больше не опрашиваются;
+-- раньше INVALID оставался в очереди навсегда
+DELETE FROM Queue q
+USING UserOrder o
+WHERE o.id = q.order_id AND o.status_id IN (3, 4);
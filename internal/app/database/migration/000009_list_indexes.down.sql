@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS journal_withdrawal_created_idx;
+DROP INDEX IF EXISTS posting_account_entry_idx;
+CREATE INDEX posting_account_id_idx ON Posting(account_id);
+DROP INDEX IF EXISTS userorder_user_uploaded_idx;
@@ -0,0 +1,10 @@
+-- списки заказов и списаний читаются страницами по (время, номер заказа)
+CREATE INDEX userorder_user_uploaded_idx ON UserOrder(user_id, uploaded_at, id);
+
+-- списания пользователя: сначала его движения по счету, затем проводки
+-- в порядке страницы
+DROP INDEX IF EXISTS posting_account_id_idx;
+CREATE INDEX posting_account_entry_idx ON Posting(account_id, entry_id);
+CREATE INDEX journal_withdrawal_created_idx
+	ON JournalEntry(created_at, order_id)
+	WHERE kind = 'WITHDRAWAL';
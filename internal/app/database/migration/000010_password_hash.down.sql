@@ -0,0 +1,8 @@
+ALTER TABLE UserAccount ADD COLUMN salt VARCHAR NOT NULL DEFAULT '';
+UPDATE UserAccount
+SET salt = split_part(hashed_password, '$', 3),
+	hashed_password = split_part(hashed_password, '$', 4)
+WHERE hashed_password LIKE '$md5$%';
+ALTER TABLE UserAccount ALTER COLUMN salt DROP DEFAULT;
+-- пароли, уже перехэшированные argon2id или bcrypt, старая версия сервиса
+-- проверить не сможет: таким пользователям придется сбросить пароль
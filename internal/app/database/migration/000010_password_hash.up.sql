@@ -0,0 +1,5 @@
+-- хэши паролей хранятся в формате PHC: схема, параметры и соль - внутри
+-- хэша. Старые хэши (двойной md5 с солью) получают префикс $md5$ и
+-- заменяются на argon2id при следующем входе пользователя
+UPDATE UserAccount SET hashed_password = '$md5$' || salt || '$' || hashed_password;
+ALTER TABLE UserAccount DROP COLUMN salt;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS RevokedToken;
+DROP TABLE IF EXISTS RefreshToken;
+DROP TABLE IF EXISTS Session;
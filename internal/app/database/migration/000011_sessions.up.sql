@@ -0,0 +1,28 @@
+-- сессия - семейство refresh-токенов одного входа: каждый токен выдается
+-- взамен предыдущего. Повторное использование токена отзывает всю сессию
+CREATE TABLE Session(
+	id VARCHAR PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	revoked_at TIMESTAMP,
+	CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES UserAccount(id)
+);
+CREATE INDEX session_user_id_idx ON Session(user_id);
+
+-- хранится только sha256 токена
+CREATE TABLE RefreshToken(
+	hash VARCHAR PRIMARY KEY,
+	session_id VARCHAR NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	CONSTRAINT fk_session_id FOREIGN KEY (session_id) REFERENCES Session(id)
+);
+CREATE INDEX refreshtoken_session_id_idx ON RefreshToken(session_id);
+
+-- отозванные access-токены (jti); запись нужна, только пока токен не истек
+CREATE TABLE RevokedToken(
+	jti VARCHAR PRIMARY KEY,
+	expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX revokedtoken_expires_at_idx ON RevokedToken(expires_at);
@@ -0,0 +1,10 @@
+-- токены сброса пароля одноразовые и хранятся только в виде sha256
+CREATE TABLE PasswordResetToken(
+	hash VARCHAR PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES UserAccount(id)
+);
+CREATE INDEX passwordresettoken_user_id_idx ON PasswordResetToken(user_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS queue_order_id_idx;
@@ -0,0 +1,15 @@
+-- повторное добавление заказа в очередь вставляло вторую строку, и один заказ
+-- могли арендовать два воркера. Из дублей оставляем живую задачу, а среди
+-- них - самую раннюю
+DELETE FROM Queue
+WHERE id IN (
+	SELECT id FROM (
+		SELECT id, ROW_NUMBER() OVER (
+			PARTITION BY order_id ORDER BY dead_at IS NOT NULL, id
+		) AS n
+		FROM Queue
+	) d
+	WHERE d.n > 1
+);
+
+CREATE UNIQUE INDEX queue_order_id_idx ON Queue(order_id);
@@ -0,0 +1,99 @@
+// Package migration хранит схему БД в виде пронумерованных миграций и
+// накатывает их. Файлы называются NNNNNN_имя.up.sql и NNNNNN_имя.down.sql и
+// вшиваются в бинарник; версия схемы хранится в таблице schema_migrations в
+// том же формате, что у golang-migrate, поэтому базы, размеченные им,
+// подхватываются без изменений.
+package migration
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+var (
+	// ErrBadMigration - набор файлов миграций некорректен
+	ErrBadMigration = errors.New("bad migration files")
+	// ErrSchemaDirty - предыдущая миграция упала на середине, схему нужно
+	// починить вручную и отметить версию командой migrate force
+	ErrSchemaDirty = errors.New("database schema is dirty")
+	// ErrSchemaOutdated - в БД накатаны не все миграции
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+	// ErrSchemaTooNew - схему БД обновила более новая версия сервиса
+	ErrSchemaTooNew = errors.New("database schema is newer than supported")
+	// ErrUnknownVersion - в наборе миграций нет такой версии
+	ErrUnknownVersion = errors.New("unknown schema version")
+)
+
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration - одна миграция схемы
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Embedded возвращает миграции, вшитые в бинарник
+func Embedded() ([]Migration, error) {
+	return Load(files)
+}
+
+// Load читает миграции из корня fsys и сортирует их по версии. У каждой
+// миграции должны быть оба файла - up и down
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("%w: unexpected file %v", ErrBadMigration, e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: bad version in %v", ErrBadMigration, e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mg
+		}
+		if mg.Name != m[2] {
+			return nil, fmt.Errorf("%w: version %v has names %v and %v", ErrBadMigration, version, mg.Name, m[2])
+		}
+		if m[3] == "up" {
+			mg.Up = string(body)
+		} else {
+			mg.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" || mg.Down == "" {
+			return nil, fmt.Errorf("%w: version %v needs both up and down files", ErrBadMigration, mg.Version)
+		}
+		migrations = append(migrations, *mg)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
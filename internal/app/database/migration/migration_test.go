@@ -0,0 +1,174 @@
+package migration_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtest"
+	"github.com/blokhinnv/gophermart/internal/app/database/migration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := migration.Load(fstest.MapFS{
+		"000010_second.down.sql": file("DROP TABLE b;"),
+		"000002_first.up.sql":    file("CREATE TABLE a();"),
+		"000010_second.up.sql":   file("CREATE TABLE b();"),
+		"000002_first.down.sql":  file("DROP TABLE a;"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []migration.Migration{
+		{Version: 2, Name: "first", Up: "CREATE TABLE a();", Down: "DROP TABLE a;"},
+		{Version: 10, Name: "second", Up: "CREATE TABLE b();", Down: "DROP TABLE b;"},
+	}, migrations)
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"000001_init.up.sql": file("CREATE TABLE a();"),
+			},
+		},
+		{
+			name: "different names",
+			files: fstest.MapFS{
+				"000001_init.up.sql":    file("CREATE TABLE a();"),
+				"000001_other.down.sql": file("DROP TABLE a;"),
+			},
+		},
+		{
+			name: "unexpected file",
+			files: fstest.MapFS{
+				"README.md": file("docs"),
+			},
+		},
+		{
+			name: "zero version",
+			files: fstest.MapFS{
+				"000000_init.up.sql":   file("CREATE TABLE a();"),
+				"000000_init.down.sql": file("DROP TABLE a;"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migration.Load(tt.files)
+			assert.ErrorIs(t, err, migration.ErrBadMigration)
+		})
+	}
+}
+
+// вшитые миграции идут подряд: пропуск версии обычно означает забытый файл
+func TestEmbedded(t *testing.T) {
+	migrations, err := migration.Embedded()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, m.Name)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	conn := dbtest.Connect(t)
+	ctx := context.Background()
+	migrator, err := migration.NewMigrator(conn)
+	require.NoError(t, err)
+	latest := migrator.Latest()
+
+	// dbtest.Connect уже накатил все миграции
+	version, dirty, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+	assert.False(t, dirty)
+	assert.NoError(t, migrator.Check(ctx))
+	assert.NoError(t, migrator.Up(ctx))
+
+	require.NoError(t, migrator.Down(ctx, 2))
+	version, _, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest-2, version)
+	assert.ErrorIs(t, migrator.Check(ctx), migration.ErrSchemaOutdated)
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Len(t, status.Pending, 2)
+
+	// откат до пустой схемы и обратно: down-миграции не должны ничего забывать
+	require.NoError(t, migrator.Down(ctx, int(latest)))
+	version, _, err = migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+	require.NoError(t, migrator.Up(ctx))
+	assert.NoError(t, migrator.Check(ctx))
+}
+
+func TestMigratorEmptyDatabase(t *testing.T) {
+	conn := dbtest.Connect(t)
+	ctx := context.Background()
+	_, err := conn.Exec(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+	require.NoError(t, err)
+	migrator, err := migration.NewMigrator(conn)
+	require.NoError(t, err)
+
+	// проверка не создает таблицу версий
+	assert.ErrorIs(t, migrator.Check(ctx), migration.ErrSchemaOutdated)
+	require.NoError(t, migrator.Up(ctx))
+	assert.NoError(t, migrator.Check(ctx))
+}
+
+func TestMigratorRefusesIncompatibleSchema(t *testing.T) {
+	conn := dbtest.Connect(t)
+	ctx := context.Background()
+	migrator, err := migration.NewMigrator(conn)
+	require.NoError(t, err)
+
+	_, err = conn.Exec(ctx, "UPDATE schema_migrations SET version = version + 1")
+	require.NoError(t, err)
+	assert.ErrorIs(t, migrator.Check(ctx), migration.ErrSchemaTooNew)
+	assert.ErrorIs(t, migrator.Up(ctx), migration.ErrSchemaTooNew)
+
+	require.NoError(t, migrator.Force(ctx, migrator.Latest()))
+	_, err = conn.Exec(ctx, "UPDATE schema_migrations SET dirty = true")
+	require.NoError(t, err)
+	assert.ErrorIs(t, migrator.Check(ctx), migration.ErrSchemaDirty)
+	assert.ErrorIs(t, migrator.Up(ctx), migration.ErrSchemaDirty)
+	assert.ErrorIs(t, migrator.Down(ctx, 1), migration.ErrSchemaDirty)
+
+	require.NoError(t, migrator.Force(ctx, migrator.Latest()))
+	assert.NoError(t, migrator.Check(ctx))
+}
+
+// упавшая миграция откатывается целиком и не меняет версию
+func TestMigratorFailedMigration(t *testing.T) {
+	conn := dbtest.Connect(t)
+	ctx := context.Background()
+	migrations, err := migration.Embedded()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+	migrations = append(migrations, migration.Migration{
+		Version: latest + 1,
+		Name:    "broken",
+		Up:      "CREATE TABLE Broken(id INTEGER); SELECT no_such_function();",
+		Down:    "DROP TABLE Broken;",
+	})
+	migrator := migration.NewMigratorFrom(conn, migrations)
+
+	assert.Error(t, migrator.Up(ctx))
+	version, dirty, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+	assert.False(t, dirty)
+	var exists bool
+	require.NoError(t, conn.QueryRow(ctx, "SELECT to_regclass('broken') IS NOT NULL").Scan(&exists))
+	assert.False(t, exists)
+}
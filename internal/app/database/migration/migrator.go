@@ -0,0 +1,272 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const createVersionTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT NOT NULL PRIMARY KEY,
+	dirty BOOLEAN NOT NULL
+);
+`
+
+const selectVersionSQL = `
+SELECT version, dirty FROM schema_migrations LIMIT 1;
+`
+
+const clearVersionSQL = `
+DELETE FROM schema_migrations;
+`
+
+const insertVersionSQL = `
+INSERT INTO schema_migrations(version, dirty) VALUES ($1, $2);
+`
+
+// ключ advisory lock: пока одна копия сервиса мигрирует схему, остальные ждут
+const lockKey = 7460213549
+
+const lockSQL = `SELECT pg_advisory_lock($1);`
+const unlockSQL = `SELECT pg_advisory_unlock($1);`
+
+// Status - состояние схемы БД относительно известных миграций
+type Status struct {
+	// текущая версия схемы; 0 - миграции еще не накатывались
+	Version int64
+	Dirty   bool
+	// последняя версия, которую знает сервис
+	Latest  int64
+	Applied []Migration
+	Pending []Migration
+}
+
+// Migrator накатывает и откатывает миграции. Каждая миграция выполняется
+// в одной транзакции вместе с записью новой версии, поэтому упавшая
+// миграция не оставляет схему в промежуточном состоянии
+type Migrator struct {
+	conn       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator создает Migrator для миграций, вшитых в бинарник
+func NewMigrator(conn *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := Embedded()
+	if err != nil {
+		return nil, err
+	}
+	return NewMigratorFrom(conn, migrations), nil
+}
+
+// NewMigratorFrom создает Migrator для произвольного набора миграций,
+// отсортированного по версии
+func NewMigratorFrom(conn *pgxpool.Pool, migrations []Migration) *Migrator {
+	return &Migrator{conn: conn, migrations: migrations}
+}
+
+// Latest возвращает последнюю известную версию схемы
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает текущую версию схемы; 0 - миграции еще не накатывались
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return readVersion(ctx, m.conn)
+}
+
+// Status сравнивает версию схемы с известными миграциями
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{Version: version, Dirty: dirty, Latest: m.Latest()}
+	for _, mg := range m.migrations {
+		if mg.Version <= version {
+			status.Applied = append(status.Applied, mg)
+		} else {
+			status.Pending = append(status.Pending, mg)
+		}
+	}
+	return status, nil
+}
+
+// Check проверяет, что сервис может работать с этой схемой: она не грязная,
+// все миграции накатаны и среди них нет незнакомых
+func (m *Migrator) Check(ctx context.Context) error {
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	return m.check(version, dirty)
+}
+
+func (m *Migrator) check(version int64, dirty bool) error {
+	latest := m.Latest()
+	switch {
+	case dirty:
+		return fmt.Errorf("%w: version %v", ErrSchemaDirty, version)
+	case version > latest:
+		return fmt.Errorf("%w: version %v, supported up to %v", ErrSchemaTooNew, version, latest)
+	case version < latest:
+		return fmt.Errorf("%w: version %v, required %v", ErrSchemaOutdated, version, latest)
+	}
+	return nil
+}
+
+// Up накатывает все миграции, которых еще нет в БД
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(c *pgxpool.Conn) error {
+		version, dirty, err := readVersion(ctx, c)
+		if err != nil {
+			return err
+		}
+		// более новую схему не трогаем: откатывать ее должен тот, кто накатил
+		if err := m.check(version, dirty); !errors.Is(err, ErrSchemaOutdated) {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if mg.Version <= version {
+				continue
+			}
+			log.Printf("Applying migration %v_%v...", mg.Version, mg.Name)
+			if err := apply(ctx, c, mg.Up, mg.Version); err != nil {
+				return fmt.Errorf("migration %v_%v: %w", mg.Version, mg.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Down откатывает steps последних миграций
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(c *pgxpool.Conn) error {
+		version, dirty, err := readVersion(ctx, c)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w: version %v", ErrSchemaDirty, version)
+		}
+		for ; steps > 0 && version > 0; steps-- {
+			i := m.index(version)
+			if i < 0 {
+				return fmt.Errorf("%w: %v", ErrUnknownVersion, version)
+			}
+			mg := m.migrations[i]
+			var prev int64
+			if i > 0 {
+				prev = m.migrations[i-1].Version
+			}
+			log.Printf("Reverting migration %v_%v...", mg.Version, mg.Name)
+			if err := apply(ctx, c, mg.Down, prev); err != nil {
+				return fmt.Errorf("migration %v_%v: %w", mg.Version, mg.Name, err)
+			}
+			version = prev
+		}
+		return nil
+	})
+}
+
+// Force записывает версию схемы без выполнения миграций и снимает признак
+// грязной схемы - после того, как ее починили вручную
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %v", ErrUnknownVersion, version)
+	}
+	return m.withLock(ctx, func(c *pgxpool.Conn) error {
+		tx, err := c.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+		if err := writeVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+func (m *Migrator) index(version int64) int {
+	for i, mg := range m.migrations {
+		if mg.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// withLock выполняет fn на отдельном соединении под advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(c *pgxpool.Conn) error) error {
+	c, err := m.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+	if _, err := c.Exec(ctx, lockSQL, lockKey); err != nil {
+		return err
+	}
+	defer c.Exec(context.Background(), unlockSQL, lockKey)
+	if _, err := c.Exec(ctx, createVersionTableSQL); err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// readVersion читает версию схемы; если таблицы версий еще нет, миграции
+// не накатывались
+func readVersion(ctx context.Context, q querier) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := q.QueryRow(ctx, selectVersionSQL).Scan(&version, &dirty)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) ||
+		errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UndefinedTable {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func writeVersion(ctx context.Context, tx pgx.Tx, version int64) error {
+	if _, err := tx.Exec(ctx, clearVersionSQL); err != nil {
+		return err
+	}
+	// как и golang-migrate, для пустой схемы строку не храним
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, insertVersionSQL, version, false)
+	return err
+}
+
+// apply выполняет текст миграции и записывает новую версию в одной транзакции
+func apply(ctx context.Context, c *pgxpool.Conn, query string, version int64) error {
+	tx, err := c.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	// без аргументов pgx использует простой протокол, и файл может
+	// содержать несколько запросов
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+	if err := writeVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
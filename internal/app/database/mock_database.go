@@ -7,9 +7,12 @@ package database
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	ordertracker "github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	ledger "github.com/blokhinnv/gophermart/internal/app/ledger"
 	models "github.com/blokhinnv/gophermart/internal/app/models"
+	money "github.com/blokhinnv/gophermart/internal/app/money"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -37,7 +40,7 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 }
 
 // AddAccrualRecord mocks base method.
-func (m *MockService) AddAccrualRecord(arg0 context.Context, arg1 string, arg2 float64) error {
+func (m *MockService) AddAccrualRecord(arg0 context.Context, arg1 string, arg2 money.Amount) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "AddAccrualRecord", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
@@ -80,7 +83,7 @@ func (mr *MockServiceMockRecorder) AddUser(arg0, arg1, arg2 interface{}) *gomock
 }
 
 // AddWithdrawalRecord mocks base method.
-func (m *MockService) AddWithdrawalRecord(arg0 context.Context, arg1 string, arg2 float64, arg3 int) error {
+func (m *MockService) AddWithdrawalRecord(arg0 context.Context, arg1 string, arg2 money.Amount, arg3 int) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "AddWithdrawalRecord", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(error)
@@ -105,6 +108,49 @@ func (mr *MockServiceMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockService)(nil).Close))
 }
 
+// ConsumeResetToken mocks base method.
+func (m *MockService) ConsumeResetToken(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeResetToken", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeResetToken indicates an expected call of ConsumeResetToken.
+func (mr *MockServiceMockRecorder) ConsumeResetToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeResetToken", reflect.TypeOf((*MockService)(nil).ConsumeResetToken), arg0, arg1)
+}
+
+// CreateResetToken mocks base method.
+func (m *MockService) CreateResetToken(arg0 context.Context, arg1 int, arg2 string, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateResetToken", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateResetToken indicates an expected call of CreateResetToken.
+func (mr *MockServiceMockRecorder) CreateResetToken(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateResetToken", reflect.TypeOf((*MockService)(nil).CreateResetToken), arg0, arg1, arg2, arg3)
+}
+
+// CreateSession mocks base method.
+func (m *MockService) CreateSession(arg0 context.Context, arg1 models.Session, arg2 string, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockServiceMockRecorder) CreateSession(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockService)(nil).CreateSession), arg0, arg1, arg2, arg3)
+}
+
 // FindOrderByID mocks base method.
 func (m *MockService) FindOrderByID(arg0 context.Context, arg1 string) (*models.Order, error) {
 	m.ctrl.T.Helper()
@@ -121,33 +167,48 @@ func (mr *MockServiceMockRecorder) FindOrderByID(arg0, arg1 interface{}) *gomock
 }
 
 // FindOrdersByUserID mocks base method.
-func (m *MockService) FindOrdersByUserID(arg0 context.Context, arg1 int) ([]models.Order, error) {
+func (m *MockService) FindOrdersByUserID(arg0 context.Context, arg1 int, arg2 models.ListQuery) ([]models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindOrdersByUserID", arg0, arg1)
+	ret := m.ctrl.Call(m, "FindOrdersByUserID", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindOrdersByUserID indicates an expected call of FindOrdersByUserID.
-func (mr *MockServiceMockRecorder) FindOrdersByUserID(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) FindOrdersByUserID(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrdersByUserID", reflect.TypeOf((*MockService)(nil).FindOrdersByUserID), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrdersByUserID", reflect.TypeOf((*MockService)(nil).FindOrdersByUserID), arg0, arg1, arg2)
 }
 
 // FindUser mocks base method.
-func (m *MockService) FindUser(arg0 context.Context, arg1, arg2 string) (*models.User, error) {
+func (m *MockService) FindUser(arg0 context.Context, arg1 string) (*models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindUser", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "FindUser", arg0, arg1)
 	ret0, _ := ret[0].(*models.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindUser indicates an expected call of FindUser.
-func (mr *MockServiceMockRecorder) FindUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) FindUser(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockService)(nil).FindUser), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUser", reflect.TypeOf((*MockService)(nil).FindUser), arg0, arg1)
+}
+
+// FindUserByID mocks base method.
+func (m *MockService) FindUserByID(arg0 context.Context, arg1 int) (*models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserByID", arg0, arg1)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserByID indicates an expected call of FindUserByID.
+func (mr *MockServiceMockRecorder) FindUserByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByID", reflect.TypeOf((*MockService)(nil).FindUserByID), arg0, arg1)
 }
 
 // GetBalance mocks base method.
@@ -166,18 +227,133 @@ func (mr *MockServiceMockRecorder) GetBalance(arg0, arg1 interface{}) *gomock.Ca
 }
 
 // GetWithdrawals mocks base method.
-func (m *MockService) GetWithdrawals(arg0 context.Context, arg1 int) ([]models.Withdrawal, error) {
+func (m *MockService) GetWithdrawals(arg0 context.Context, arg1 int, arg2 models.ListQuery) ([]models.Withdrawal, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWithdrawals", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetWithdrawals", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]models.Withdrawal)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetWithdrawals indicates an expected call of GetWithdrawals.
-func (mr *MockServiceMockRecorder) GetWithdrawals(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockServiceMockRecorder) GetWithdrawals(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockService)(nil).GetWithdrawals), arg0, arg1, arg2)
+}
+
+// IsAccessTokenRevoked mocks base method.
+func (m *MockService) IsAccessTokenRevoked(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsAccessTokenRevoked", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsAccessTokenRevoked indicates an expected call of IsAccessTokenRevoked.
+func (mr *MockServiceMockRecorder) IsAccessTokenRevoked(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAccessTokenRevoked", reflect.TypeOf((*MockService)(nil).IsAccessTokenRevoked), arg0, arg1, arg2)
+}
+
+// LockOrderStatus mocks base method.
+func (m *MockService) LockOrderStatus(arg0 context.Context, arg1 string) (models.OrderStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockOrderStatus", arg0, arg1)
+	ret0, _ := ret[0].(models.OrderStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockOrderStatus indicates an expected call of LockOrderStatus.
+func (mr *MockServiceMockRecorder) LockOrderStatus(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockOrderStatus", reflect.TypeOf((*MockService)(nil).LockOrderStatus), arg0, arg1)
+}
+
+// PostEntry mocks base method.
+func (m *MockService) PostEntry(arg0 context.Context, arg1 ledger.Entry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostEntry", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PostEntry indicates an expected call of PostEntry.
+func (mr *MockServiceMockRecorder) PostEntry(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockService)(nil).GetWithdrawals), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostEntry", reflect.TypeOf((*MockService)(nil).PostEntry), arg0, arg1)
+}
+
+// RevokeAccessToken mocks base method.
+func (m *MockService) RevokeAccessToken(arg0 context.Context, arg1 string, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAccessToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAccessToken indicates an expected call of RevokeAccessToken.
+func (mr *MockServiceMockRecorder) RevokeAccessToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAccessToken", reflect.TypeOf((*MockService)(nil).RevokeAccessToken), arg0, arg1, arg2)
+}
+
+// RevokeSession mocks base method.
+func (m *MockService) RevokeSession(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockServiceMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockService)(nil).RevokeSession), arg0, arg1)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockService) RevokeUserSessions(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockServiceMockRecorder) RevokeUserSessions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockService)(nil).RevokeUserSessions), arg0, arg1, arg2)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockService) RotateRefreshToken(arg0 context.Context, arg1, arg2 string, arg3 time.Duration) (*models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockServiceMockRecorder) RotateRefreshToken(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockService)(nil).RotateRefreshToken), arg0, arg1, arg2, arg3)
+}
+
+// SetPasswordHash mocks base method.
+func (m *MockService) SetPasswordHash(arg0 context.Context, arg1 int, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPasswordHash", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPasswordHash indicates an expected call of SetPasswordHash.
+func (mr *MockServiceMockRecorder) SetPasswordHash(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPasswordHash", reflect.TypeOf((*MockService)(nil).SetPasswordHash), arg0, arg1, arg2)
 }
 
 // Tracker mocks base method.
@@ -207,3 +383,31 @@ func (mr *MockServiceMockRecorder) UpdateOrderStatus(arg0, arg1, arg2 interface{
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderStatus", reflect.TypeOf((*MockService)(nil).UpdateOrderStatus), arg0, arg1, arg2)
 }
+
+// UpdatePasswordHash mocks base method.
+func (m *MockService) UpdatePasswordHash(arg0 context.Context, arg1 int, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasswordHash", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasswordHash indicates an expected call of UpdatePasswordHash.
+func (mr *MockServiceMockRecorder) UpdatePasswordHash(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasswordHash", reflect.TypeOf((*MockService)(nil).UpdatePasswordHash), arg0, arg1, arg2, arg3)
+}
+
+// WithinTransaction mocks base method.
+func (m *MockService) WithinTransaction(arg0 context.Context, arg1 func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithinTransaction", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithinTransaction indicates an expected call of WithinTransaction.
+func (mr *MockServiceMockRecorder) WithinTransaction(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithinTransaction", reflect.TypeOf((*MockService)(nil).WithinTransaction), arg0, arg1)
+}
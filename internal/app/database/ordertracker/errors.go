@@ -0,0 +1,7 @@
+package ordertracker
+
+import "errors"
+
+var ErrTaskExists = errors.New("task is already in queue")
+var ErrTaskNotFound = errors.New("task not found in queue")
+var ErrLeaseLost = errors.New("task lease expired and was taken by another worker")
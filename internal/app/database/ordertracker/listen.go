@@ -0,0 +1,65 @@
+package ordertracker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// NotifyChannel - канал Postgres, в который Add сообщает о новых задачах
+const NotifyChannel = "order_queue"
+
+// reconnectDelay - пауза перед повторным LISTEN после обрыва соединения
+const reconnectDelay = time.Second
+
+func (q *DBTracker) Notifications(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer close(ch)
+		for {
+			err := q.listen(ctx, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Queue listener failed: %v; reconnecting in %v...", err, reconnectDelay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+	return ch
+}
+
+// listen держит отдельное соединение с LISTEN и пересылает уведомления в ch
+func (q *DBTracker) listen(ctx context.Context, ch chan<- struct{}) error {
+	poolConn, err := q.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение с LISTEN нельзя возвращать в пул - забираем его насовсем
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+	// пока слушателя не было, уведомления могли потеряться
+	signal(ch)
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		signal(ch)
+	}
+}
+
+// signal не блокируется: если прошлый сигнал еще не прочитан, новый с ним
+// склеивается
+func signal(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
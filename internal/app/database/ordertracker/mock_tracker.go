@@ -7,6 +7,7 @@ package ordertracker
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -35,18 +36,33 @@ func (m *MockTracker) EXPECT() *MockTrackerMockRecorder {
 }
 
 // Acquire mocks base method.
-func (m *MockTracker) Acquire(arg0 context.Context) (*Task, error) {
+func (m *MockTracker) Acquire(arg0 context.Context, arg1 string) (*Task, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Acquire", arg0)
+	ret := m.ctrl.Call(m, "Acquire", arg0, arg1)
 	ret0, _ := ret[0].(*Task)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Acquire indicates an expected call of Acquire.
-func (mr *MockTrackerMockRecorder) Acquire(arg0 interface{}) *gomock.Call {
+func (mr *MockTrackerMockRecorder) Acquire(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Acquire", reflect.TypeOf((*MockTracker)(nil).Acquire), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Acquire", reflect.TypeOf((*MockTracker)(nil).Acquire), arg0, arg1)
+}
+
+// AcquireBatch mocks base method.
+func (m *MockTracker) AcquireBatch(arg0 context.Context, arg1 string, arg2 int) ([]*Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireBatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireBatch indicates an expected call of AcquireBatch.
+func (mr *MockTrackerMockRecorder) AcquireBatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireBatch", reflect.TypeOf((*MockTracker)(nil).AcquireBatch), arg0, arg1, arg2)
 }
 
 // Add mocks base method.
@@ -77,8 +93,80 @@ func (mr *MockTrackerMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockTracker)(nil).Delete), arg0, arg1)
 }
 
+// Depth mocks base method.
+func (m *MockTracker) Depth(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Depth", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Depth indicates an expected call of Depth.
+func (mr *MockTrackerMockRecorder) Depth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Depth", reflect.TypeOf((*MockTracker)(nil).Depth), arg0)
+}
+
+// ListDead mocks base method.
+func (m *MockTracker) ListDead(arg0 context.Context) ([]Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDead", arg0)
+	ret0, _ := ret[0].([]Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDead indicates an expected call of ListDead.
+func (mr *MockTrackerMockRecorder) ListDead(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDead", reflect.TypeOf((*MockTracker)(nil).ListDead), arg0)
+}
+
+// Notifications mocks base method.
+func (m *MockTracker) Notifications(arg0 context.Context) <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Notifications", arg0)
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Notifications indicates an expected call of Notifications.
+func (mr *MockTrackerMockRecorder) Notifications(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Notifications", reflect.TypeOf((*MockTracker)(nil).Notifications), arg0)
+}
+
+// Release mocks base method.
+func (m *MockTracker) Release(arg0 context.Context, arg1 *Task, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockTrackerMockRecorder) Release(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockTracker)(nil).Release), arg0, arg1, arg2)
+}
+
+// Requeue mocks base method.
+func (m *MockTracker) Requeue(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Requeue", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Requeue indicates an expected call of Requeue.
+func (mr *MockTrackerMockRecorder) Requeue(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Requeue", reflect.TypeOf((*MockTracker)(nil).Requeue), arg0, arg1)
+}
+
 // UpdateStatusAndRelease mocks base method.
-func (m *MockTracker) UpdateStatusAndRelease(arg0 context.Context, arg1 int, arg2 string) error {
+func (m *MockTracker) UpdateStatusAndRelease(arg0 context.Context, arg1 *Task, arg2 int) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UpdateStatusAndRelease", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
@@ -2,43 +2,169 @@ package ordertracker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/blokhinnv/gophermart/internal/app/database/dbtx"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DBTracker struct {
-	conn *pgxpool.Pool
+	conn          *pgxpool.Pool
+	policy        RetryPolicy
+	leaseDuration time.Duration
 }
 
-func NewDBTracker(conn *pgxpool.Pool) *DBTracker {
-	return &DBTracker{conn: conn}
+func NewDBTracker(
+	conn *pgxpool.Pool,
+	policy RetryPolicy,
+	leaseDuration time.Duration,
+) *DBTracker {
+	return &DBTracker{conn: conn, policy: policy, leaseDuration: leaseDuration}
 }
 
-func (q *DBTracker) Acquire(ctx context.Context) (*Task, error) {
-	var orderID string
-	var statusID int
-	err := q.conn.QueryRow(ctx, acquireSQL).Scan(&orderID, &statusID)
+// q возвращает транзакцию из контекста, если она есть, иначе пул
+func (q *DBTracker) q(ctx context.Context) dbtx.Querier {
+	return dbtx.From(ctx, q.conn)
+}
+
+func (q *DBTracker) Acquire(ctx context.Context, owner string) (*Task, error) {
+	tasks, err := q.AcquireBatch(ctx, owner, 1)
 	if err != nil {
 		return nil, err
 	}
-	return &Task{OrderID: orderID, StatusID: statusID}, nil
+	if len(tasks) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return tasks[0], nil
+}
+
+func (q *DBTracker) AcquireBatch(ctx context.Context, owner string, limit int) ([]*Task, error) {
+	tasks := make([]*Task, 0, limit)
+	rows, err := q.q(ctx).Query(ctx, acquireSQL, owner, q.leaseDuration.Milliseconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		task := Task{Owner: owner}
+		err := rows.Scan(
+			&task.OrderID,
+			&task.StatusID,
+			&task.Attempts,
+			&task.CreatedAt,
+			&task.LeaseUntil,
+			&task.Reclaimed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (q *DBTracker) Depth(ctx context.Context) (int, error) {
+	var depth int
+	err := q.q(ctx).QueryRow(ctx, depthSQL).Scan(&depth)
+	return depth, err
 }
 
 func (q *DBTracker) UpdateStatusAndRelease(
 	ctx context.Context,
+	task *Task,
 	newStatusID int,
-	orderID string,
 ) error {
-	_, err := q.conn.Exec(ctx, updateAndReleaseSQL, newStatusID, orderID)
-	return err
+	tx, err := q.q(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var attempts int
+	var ageMs int64
+	err = tx.QueryRow(ctx, selectForRetrySQL, task.OrderID, task.Owner).Scan(&attempts, &ageMs)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: orderID=%v owner=%v", ErrLeaseLost, task.OrderID, task.Owner)
+		}
+		return err
+	}
+	attempts++
+	age := time.Duration(ageMs) * time.Millisecond
+	if q.policy.Exhausted(attempts, age) {
+		_, err = tx.Exec(ctx, deadLetterSQL, newStatusID, attempts, task.OrderID)
+	} else {
+		delay := q.policy.Delay(attempts)
+		_, err = tx.Exec(ctx, retrySQL, newStatusID, attempts, delay.Milliseconds(), task.OrderID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (q *DBTracker) Release(ctx context.Context, task *Task, delay time.Duration) error {
+	tag, err := q.q(ctx).Exec(ctx, releaseSQL, delay.Milliseconds(), task.OrderID, task.Owner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: orderID=%v owner=%v", ErrLeaseLost, task.OrderID, task.Owner)
+	}
+	return nil
 }
 
 func (q *DBTracker) Add(ctx context.Context, orderID string) error {
-	_, err := q.conn.Exec(ctx, addSQL, orderID)
+	_, err := q.q(ctx).Exec(ctx, addSQL, orderID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return fmt.Errorf("%w: orderID=%v", ErrTaskExists, orderID)
+	}
 	return err
 }
 
 func (q *DBTracker) Delete(ctx context.Context, orderID string) error {
-	_, err := q.conn.Exec(ctx, deleteSQL, orderID)
+	_, err := q.q(ctx).Exec(ctx, deleteSQL, orderID)
+	return err
+}
+
+func (q *DBTracker) ListDead(ctx context.Context) ([]Task, error) {
+	tasks := make([]Task, 0)
+	rows, err := q.q(ctx).Query(ctx, listDeadSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		task := Task{}
+		err := rows.Scan(&task.OrderID, &task.StatusID, &task.Attempts, &task.CreatedAt, &task.DeadAt)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (q *DBTracker) Requeue(ctx context.Context, orderID string) error {
+	tag, err := q.q(ctx).Exec(ctx, requeueSQL, orderID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: no dead task with orderID=%v", ErrTaskNotFound, orderID)
+	}
+	_, err = q.q(ctx).Exec(ctx, notifySQL, orderID)
 	return err
 }
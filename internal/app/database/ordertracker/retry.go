@@ -0,0 +1,49 @@
+package ordertracker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy описывает, как часто повторно опрашивать систему расчета баллов
+// по одному заказу и когда перестать это делать
+type RetryPolicy struct {
+	// задержка перед второй попыткой; дальше она удваивается
+	BaseDelay time.Duration
+	// верхняя граница задержки
+	MaxDelay time.Duration
+	// доля задержки (от 0 до 1), на которую она может быть случайно уменьшена,
+	// чтобы заказы, добавленные одновременно, не опрашивались пачкой
+	Jitter float64
+	// после стольких попыток заказ уходит в dead letter; 0 - без ограничения
+	MaxAttempts int
+	// заказ, пролежавший в очереди дольше, уходит в dead letter; 0 - без ограничения
+	MaxAge time.Duration
+}
+
+// Delay возвращает задержку после attempts неудачных попыток
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Exhausted сообщает, пора ли перестать опрашивать заказ
+func (p RetryPolicy) Exhausted(attempts int, age time.Duration) bool {
+	if p.MaxAttempts > 0 && attempts >= p.MaxAttempts {
+		return true
+	}
+	if p.MaxAge > 0 && age >= p.MaxAge {
+		return true
+	}
+	return false
+}
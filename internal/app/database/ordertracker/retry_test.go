@@ -0,0 +1,44 @@
+package ordertracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.Delay(tt.attempts), "attempts=%v", tt.attempts)
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := p.Delay(3)
+		assert.LessOrEqual(t, d, 4*time.Second)
+		assert.GreaterOrEqual(t, d, 2*time.Second)
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, MaxAge: time.Hour}
+	assert.False(t, p.Exhausted(2, time.Minute))
+	assert.True(t, p.Exhausted(3, time.Minute))
+	assert.True(t, p.Exhausted(1, time.Hour))
+	assert.False(t, RetryPolicy{}.Exhausted(1000, 1000*time.Hour))
+}
@@ -1,28 +1,104 @@
 package ordertracker
 
+// берем до $3 самых "старых" задач, у которых нет действующей аренды;
+// истекшая аренда означает, что прежний владелец упал, и задачу можно забрать.
+// Строки, которые прямо сейчас забирает другой воркер, пропускаются
 const acquireSQL = `
-UPDATE Queue SET lock = TRUE
-WHERE order_id = (
-	SELECT order_id
+UPDATE Queue q
+SET locked_by = $1, locked_until = NOW() + $2 * INTERVAL '1 millisecond'
+FROM (
+	SELECT order_id, locked_by AS prev_owner
 	FROM Queue
-	WHERE status_id IN (0, 1, 2) AND lock = FALSE
-	ORDER BY updated_at
-	LIMIT 1
+	WHERE status_id IN (0, 1, 2)
+		AND dead_at IS NULL
+		AND next_attempt_at <= NOW()
+		AND (locked_until IS NULL OR locked_until < NOW())
+	ORDER BY next_attempt_at
+	LIMIT $3
 	FOR UPDATE SKIP LOCKED
-)
-RETURNING order_id, status_id;
+) c
+WHERE q.order_id = c.order_id
+RETURNING q.order_id, q.status_id, q.attempts, q.created_at, q.locked_until, c.prev_owner IS NOT NULL;
+`
+
+// задачи, которые можно взять в работу прямо сейчас
+const depthSQL = `
+SELECT COUNT(*)
+FROM Queue
+WHERE status_id IN (0, 1, 2)
+	AND dead_at IS NULL
+	AND next_attempt_at <= NOW()
+	AND (locked_until IS NULL OR locked_until < NOW());
+`
+
+const selectForRetrySQL = `
+SELECT attempts, (EXTRACT(EPOCH FROM NOW() - created_at) * 1000)::BIGINT
+FROM Queue
+WHERE order_id = $1 AND locked_by = $2
+FOR UPDATE;
 `
 
-const updateAndReleaseSQL = `
+const retrySQL = `
 UPDATE Queue
-SET lock = FALSE, status_id = $1, updated_at = CURRENT_TIMESTAMP
-WHERE order_id=$2;
+SET locked_by = NULL,
+	locked_until = NULL,
+	status_id = $1,
+	attempts = $2,
+	next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond',
+	updated_at = CURRENT_TIMESTAMP
+WHERE order_id = $4;
 `
 
+const deadLetterSQL = `
+UPDATE Queue
+SET locked_by = NULL,
+	locked_until = NULL,
+	status_id = $1,
+	attempts = $2,
+	dead_at = NOW(),
+	updated_at = CURRENT_TIMESTAMP
+WHERE order_id = $3;
+`
+
+const releaseSQL = `
+UPDATE Queue
+SET locked_by = NULL,
+	locked_until = NULL,
+	next_attempt_at = NOW() + $1 * INTERVAL '1 millisecond'
+WHERE order_id = $2 AND locked_by = $3;
+`
+
+// уведомление доставляется слушателям только после фиксации транзакции
 const addSQL = `
-INSERT INTO Queue(order_id) VALUES ($1);
+WITH added AS (
+	INSERT INTO Queue(order_id) VALUES ($1) RETURNING order_id
+)
+SELECT pg_notify('` + NotifyChannel + `', order_id) FROM added;
+`
+
+const notifySQL = `
+SELECT pg_notify('` + NotifyChannel + `', $1);
 `
 
 const deleteSQL = `
 DELETE FROM Queue WHERE order_id = $1;
 `
+
+const listDeadSQL = `
+SELECT order_id, status_id, attempts, created_at, dead_at
+FROM Queue
+WHERE dead_at IS NOT NULL
+ORDER BY dead_at;
+`
+
+const requeueSQL = `
+UPDATE Queue
+SET locked_by = NULL,
+	locked_until = NULL,
+	attempts = 0,
+	dead_at = NULL,
+	next_attempt_at = NOW(),
+	created_at = NOW(),
+	updated_at = CURRENT_TIMESTAMP
+WHERE order_id = $1 AND dead_at IS NOT NULL;
+`
@@ -1,19 +1,50 @@
 package ordertracker
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Task struct {
-	OrderID  string
-	StatusID int
+	OrderID   string
+	StatusID  int
+	Attempts  int
+	CreatedAt time.Time
+	// время попадания в dead letter; нулевое для живых задач
+	DeadAt time.Time
+	// кто арендовал задачу и до какого момента
+	Owner      string
+	LeaseUntil time.Time
+	// задача забрана у владельца, чья аренда истекла
+	Reclaimed bool
 }
 
 type Tracker interface {
-	Acquire(ctx context.Context) (*Task, error)
-	UpdateStatusAndRelease(
-		ctx context.Context,
-		newStatusID int,
-		orderID string,
-	) error
+	// Acquire арендует задачу для owner; пока аренда не истекла,
+	// задачу не получит никто другой
+	Acquire(ctx context.Context, owner string) (*Task, error)
+	// AcquireBatch арендует для owner до limit задач за один запрос; задачи,
+	// которые одновременно забирает другой воркер, пропускаются. Пустая
+	// очередь - пустой срез без ошибки
+	AcquireBatch(ctx context.Context, owner string, limit int) ([]*Task, error)
+	// Depth возвращает количество задач, которые можно взять в работу сейчас
+	Depth(ctx context.Context) (int, error)
+	// UpdateStatusAndRelease засчитывает попытку, обновляет статус и
+	// откладывает задачу по RetryPolicy; если попытки исчерпаны,
+	// задача уходит в dead letter. Если аренда уже потеряна, вернет ErrLeaseLost
+	UpdateStatusAndRelease(ctx context.Context, task *Task, newStatusID int) error
+	// Release возвращает задачу в очередь через delay, не засчитывая попытку
+	Release(ctx context.Context, task *Task, delay time.Duration) error
+	// Add ставит заказ в очередь и уведомляет слушателей Notifications;
+	// повторное добавление возвращает ErrTaskExists
 	Add(ctx context.Context, orderID string) error
 	Delete(ctx context.Context, orderID string) error
+	ListDead(ctx context.Context) ([]Task, error)
+	// Requeue возвращает задачу из dead letter в работу со сброшенным счетчиком попыток
+	Requeue(ctx context.Context, orderID string) error
+	// Notifications возвращает канал, в который приходит сигнал, когда в
+	// очереди появляется задача. Сигналы могут склеиваться и теряться при
+	// переподключении, поэтому опрос по таймеру все равно нужен. Канал
+	// закрывается после отмены ctx
+	Notifications(ctx context.Context) <-chan struct{}
 }
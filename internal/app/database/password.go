@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *DatabaseService) FindUserByID(ctx context.Context, userID int) (*models.User, error) {
+	user := models.User{ID: userID}
+	err := db.q(ctx).QueryRow(ctx, selectUserByIDSQL, userID).Scan(&user.Username, &user.HashedPassword)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: id=%v", ErrUserNotFound, userID)
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetPasswordHash заменяет хэш пароля безусловно, в отличие от
+// UpdatePasswordHash: пароль меняет сам пользователь
+func (db *DatabaseService) SetPasswordHash(ctx context.Context, userID int, passwordHash string) error {
+	tag, err := db.q(ctx).Exec(ctx, setPasswordHashSQL, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: id=%v", ErrUserNotFound, userID)
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя, кроме exceptSessionID
+func (db *DatabaseService) RevokeUserSessions(
+	ctx context.Context,
+	userID int,
+	exceptSessionID string,
+) error {
+	_, err := db.q(ctx).Exec(ctx, revokeUserSessionsSQL, userID, exceptSessionID)
+	return err
+}
+
+// CreateResetToken сохраняет хэш токена сброса пароля; прежние токены
+// пользователя перестают действовать
+func (db *DatabaseService) CreateResetToken(
+	ctx context.Context,
+	userID int,
+	tokenHash string,
+	ttl time.Duration,
+) error {
+	_, err := db.q(ctx).Exec(ctx, addResetTokenSQL, tokenHash, userID, ttl.Milliseconds())
+	return err
+}
+
+// ConsumeResetToken гасит токен сброса и возвращает пользователя, для
+// которого он выпущен. Неизвестный, истекший и уже использованный токены -
+// ErrTokenNotFound
+func (db *DatabaseService) ConsumeResetToken(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := db.q(ctx).QueryRow(ctx, useResetTokenSQL, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrTokenNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateSession открывает сессию и сохраняет ее первый refresh-токен
+func (db *DatabaseService) CreateSession(
+	ctx context.Context,
+	session models.Session,
+	refreshHash string,
+	ttl time.Duration,
+) error {
+	return db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := db.q(ctx).Exec(ctx, addSessionSQL, session.ID, session.UserID); err != nil {
+			return err
+		}
+		_, err := db.q(ctx).Exec(ctx, addRefreshTokenSQL, refreshHash, session.ID, ttl.Milliseconds())
+		return err
+	})
+}
+
+// RotateRefreshToken обменивает refresh-токен oldHash на newHash в той же
+// сессии. Каждый токен обменивается один раз: повторное использование
+// отзывает сессию целиком и возвращает ErrTokenReused
+func (db *DatabaseService) RotateRefreshToken(
+	ctx context.Context,
+	oldHash, newHash string,
+	ttl time.Duration,
+) (*models.Session, error) {
+	var session models.Session
+	var reused bool
+	err := db.WithinTransaction(ctx, func(ctx context.Context) error {
+		var revoked, used, expired bool
+		err := db.q(ctx).QueryRow(ctx, lockRefreshTokenSQL, oldHash).
+			Scan(&session.ID, &session.UserID, &session.Username, &revoked, &used, &expired)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrTokenNotFound
+			}
+			return err
+		}
+		switch {
+		case revoked:
+			return fmt.Errorf("%w: session %v", ErrTokenRevoked, session.ID)
+		case used:
+			// отзыв должен сохраниться, поэтому транзакция фиксируется,
+			// а ошибка возвращается после нее
+			reused = true
+			_, err := db.q(ctx).Exec(ctx, revokeSessionSQL, session.ID)
+			return err
+		case expired:
+			return ErrTokenNotFound
+		}
+		if _, err := db.q(ctx).Exec(ctx, useRefreshTokenSQL, oldHash); err != nil {
+			return err
+		}
+		_, err = db.q(ctx).Exec(ctx, addRefreshTokenSQL, newHash, session.ID, ttl.Milliseconds())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		log.Printf("Refresh token reuse detected: revoked session %v of user %v", session.ID, session.UserID)
+		return nil, fmt.Errorf("%w: session %v", ErrTokenReused, session.ID)
+	}
+	return &session, nil
+}
+
+// RevokeSession отзывает сессию со всеми ее токенами
+func (db *DatabaseService) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := db.q(ctx).Exec(ctx, revokeSessionSQL, sessionID)
+	return err
+}
+
+// RevokeAccessToken вносит jti в список отозванных; ttl - сколько токену
+// осталось жить, после этого запись не нужна
+func (db *DatabaseService) RevokeAccessToken(ctx context.Context, jti string, ttl time.Duration) error {
+	_, err := db.q(ctx).Exec(ctx, revokeAccessTokenSQL, jti, ttl.Milliseconds())
+	return err
+}
+
+// IsAccessTokenRevoked проверяет, отозван ли access-токен jti сессии
+// sessionID - сам по себе или вместе с сессией
+func (db *DatabaseService) IsAccessTokenRevoked(
+	ctx context.Context,
+	jti, sessionID string,
+) (bool, error) {
+	var revoked bool
+	err := db.q(ctx).QueryRow(ctx, accessTokenRevokedSQL, jti, sessionID).Scan(&revoked)
+	return revoked, err
+}
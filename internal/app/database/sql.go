@@ -1,10 +1,15 @@
 package database
 
 const addUserSQL = `
-INSERT INTO UserAccount(username, hashed_password, salt) VALUES ($1, $2, $3) RETURNING id;
+INSERT INTO UserAccount(username, hashed_password) VALUES ($1, $2) RETURNING id;
 `
 const selectUserByLoginSQL = `
-SELECT id, hashed_password, salt FROM UserAccount WHERE username=$1;
+SELECT id, hashed_password FROM UserAccount WHERE username=$1;
+`
+
+// хэш меняется, только если его не успели поменять с момента чтения
+const updatePasswordHashSQL = `
+UPDATE UserAccount SET hashed_password=$3 WHERE id=$1 AND hashed_password=$2;
 `
 const addOrderSQL = `
 INSERT INTO UserOrder(id, user_id) VALUES ($1, $2);
@@ -15,42 +20,193 @@ SELECT id, user_id, status_id, uploaded_at FROM UserOrder WHERE id=$1;
 const updateOrderStatusSQL = `
 UPDATE UserOrder SET status_id=(SELECT id FROM OrderStatus WHERE status=$1) WHERE id=$2;
 `
-const addTransactionSQL = `
-INSERT INTO Transaction(order_id, sum, transaction_type_id)
-	SELECT $1, $2, id
-	FROM TransactionType
-	WHERE type=$3;
+
+// блокирует строку заказа до конца транзакции: обновления статуса из опроса
+// и от системы расчета применяются по очереди
+const lockOrderStatusSQL = `
+SELECT s.status
+FROM UserOrder o
+JOIN OrderStatus s ON s.id = o.status_id
+WHERE o.id = $1
+FOR UPDATE OF o;
+`
+const selectOrderOwnerSQL = `
+SELECT user_id FROM UserOrder WHERE id=$1;
 `
+
+// фильтры и курсор не заданы, если параметр NULL; LIMIT NULL - без ограничения
 const getOrdersByUserID = `
 WITH a AS (
-    SELECT order_id, SUM(sum) as sum
-    FROM Transaction
-    WHERE transaction_type_id=1
-    GROUP BY order_id
+    SELECT e.order_id, SUM(p.amount)::BIGINT as sum
+    FROM JournalEntry e
+    JOIN Posting p ON p.entry_id = e.id
+    JOIN LedgerAccount la ON la.id = p.account_id AND la.user_id = $1
+    WHERE e.kind = 'ACCRUAL'
+    GROUP BY e.order_id
 )
 SELECT o.id AS "number", s.status, a.sum AS "accrual", o.uploaded_at
 FROM UserOrder o
 LEFT JOIN a ON o.id = a.order_id
 JOIN OrderStatus s ON s.id = o.status_id
 WHERE o.user_id = $1
-ORDER BY o.uploaded_at;
+    AND ($2::VARCHAR[] IS NULL OR s.status = ANY($2))
+    AND ($3::TIMESTAMP IS NULL OR o.uploaded_at >= $3)
+    AND ($4::TIMESTAMP IS NULL OR o.uploaded_at < $4)
+    AND ($5::TIMESTAMP IS NULL OR (o.uploaded_at, o.id) > ($5, $6::VARCHAR))
+ORDER BY o.uploaded_at, o.id
+LIMIT $7;
+`
+const addUserBalanceSQL = `
+INSERT INTO UserBalance(user_id) VALUES ($1);
+`
+
+const addUserLedgerAccountSQL = `
+INSERT INTO LedgerAccount(id, user_id) VALUES ($1, $2);
+`
+
+// начисление по заказу может быть только одно (см. частичный уникальный индекс)
+const addJournalEntrySQL = `
+INSERT INTO JournalEntry(kind, order_id, memo) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+ON CONFLICT (order_id) WHERE kind = 'ACCRUAL' DO NOTHING
+RETURNING id, created_at;
+`
+
+const addPostingSQL = `
+INSERT INTO Posting(entry_id, account_id, amount) VALUES ($1, $2, $3);
+`
+
+const ledgerTotalSQL = `
+SELECT COALESCE(SUM(amount), 0)::BIGINT FROM Posting;
 `
+
 const getBalanceSQL = `
-SELECT (
-	COALESCE(SUM(CASE WHEN transaction_type_id=1 THEN t.sum END), 0) -
-	COALESCE(SUM(CASE WHEN transaction_type_id=2 THEN t.sum END), 0)
-) AS balance, (
-	COALESCE(SUM(CASE WHEN transaction_type_id=2 THEN t.sum END), 0)
-) AS withdrawn
-FROM Transaction t
-JOIN UserOrder o ON o.id = t.order_id
-WHERE o.user_id = $1;
+SELECT current, withdrawn FROM UserBalance WHERE user_id = $1;
+`
+
+const lockBalanceSQL = `
+SELECT current, withdrawn FROM UserBalance WHERE user_id = $1 FOR UPDATE;
+`
+
+const updateBalanceSQL = `
+UPDATE UserBalance
+SET current = current + $2, withdrawn = withdrawn + $3, version = version + 1, updated_at = NOW()
+WHERE user_id = $1;
+`
+
+// балансы, посчитанные по журналу, которые не совпадают с UserBalance;
+// списано - это списания за вычетом возвратов
+const balanceDriftSQL = `
+WITH ledger AS (
+	SELECT la.user_id,
+		COALESCE(SUM(p.amount), 0)::BIGINT AS current,
+		(-COALESCE(SUM(CASE WHEN e.kind IN ('WITHDRAWAL', 'REFUND') THEN p.amount END), 0))::BIGINT
+			AS withdrawn
+	FROM LedgerAccount la
+	LEFT JOIN Posting p ON p.account_id = la.id
+	LEFT JOIN JournalEntry e ON e.id = p.entry_id
+	WHERE la.user_id IS NOT NULL
+	GROUP BY la.user_id
+)
+SELECT l.user_id,
+	COALESCE(b.current, 0), COALESCE(b.withdrawn, 0),
+	l.current, l.withdrawn
+FROM ledger l
+LEFT JOIN UserBalance b ON b.user_id = l.user_id
+WHERE b.user_id IS NULL OR b.current <> l.current OR b.withdrawn <> l.withdrawn
+ORDER BY l.user_id;
+`
+
+const fixBalanceSQL = `
+INSERT INTO UserBalance(user_id, current, withdrawn) VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET current = EXCLUDED.current,
+	withdrawn = EXCLUDED.withdrawn,
+	version = UserBalance.version + 1,
+	updated_at = NOW();
 `
 
 const getWithdrawalsSQL = `
-SELECT order_id AS order, sum, processed_at
-FROM Transaction t
-JOIN UserOrder o ON o.id = t.order_id
-WHERE o.user_id = $1 AND t.transaction_type_id=2
-ORDER BY t.processed_at;
+SELECT e.order_id AS order, -p.amount AS sum, e.created_at AS processed_at, e.id
+FROM JournalEntry e
+JOIN Posting p ON p.entry_id = e.id
+WHERE p.account_id = $1 AND e.kind = 'WITHDRAWAL'
+    AND ($2::TIMESTAMP IS NULL OR e.created_at >= $2)
+    AND ($3::TIMESTAMP IS NULL OR e.created_at < $3)
+    AND ($4::TIMESTAMP IS NULL OR (e.created_at, e.order_id, e.id) > ($4, $5::VARCHAR, $6::BIGINT))
+ORDER BY e.created_at, e.order_id, e.id
+LIMIT $7;
+`
+
+const addSessionSQL = `
+INSERT INTO Session(id, user_id) VALUES ($1, $2);
+`
+
+// токены хранятся только в виде sha256; срок считается на стороне БД, как и
+// остальные сроки в схеме
+const addRefreshTokenSQL = `
+INSERT INTO RefreshToken(hash, session_id, expires_at)
+VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond');
+`
+
+const lockRefreshTokenSQL = `
+SELECT s.id, s.user_id, u.username, s.revoked_at IS NOT NULL, t.used_at IS NOT NULL, t.expires_at <= NOW()
+FROM RefreshToken t
+JOIN Session s ON s.id = t.session_id
+JOIN UserAccount u ON u.id = s.user_id
+WHERE t.hash = $1
+FOR UPDATE OF t, s;
+`
+
+const useRefreshTokenSQL = `
+UPDATE RefreshToken SET used_at = NOW() WHERE hash = $1;
+`
+
+const revokeSessionSQL = `
+UPDATE Session SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;
+`
+
+// заодно удаляем записи о токенах, которые уже истекли сами
+const revokeAccessTokenSQL = `
+WITH purged AS (
+	DELETE FROM RevokedToken WHERE expires_at < NOW()
+)
+INSERT INTO RevokedToken(jti, expires_at)
+VALUES ($1, NOW() + $2 * INTERVAL '1 millisecond')
+ON CONFLICT (jti) DO NOTHING;
+`
+
+// токен неизвестной сессии тоже считается отозванным
+const accessTokenRevokedSQL = `
+SELECT EXISTS (SELECT 1 FROM RevokedToken WHERE jti = $1)
+	OR NOT EXISTS (SELECT 1 FROM Session WHERE id = $2 AND revoked_at IS NULL);
+`
+
+const selectUserByIDSQL = `
+SELECT username, hashed_password FROM UserAccount WHERE id=$1;
+`
+const setPasswordHashSQL = `
+UPDATE UserAccount SET hashed_password=$2 WHERE id=$1;
+`
+
+// $2 - сессия, которую не нужно отзывать; пустая строка - отозвать все
+const revokeUserSessionsSQL = `
+UPDATE Session SET revoked_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL;
+`
+
+// действует только последний запрошенный токен; заодно удаляются истекшие
+const addResetTokenSQL = `
+WITH dropped AS (
+	DELETE FROM PasswordResetToken WHERE user_id = $2 OR expires_at < NOW()
+)
+INSERT INTO PasswordResetToken(hash, user_id, expires_at)
+VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond');
+`
+
+// токен гасится тем же запросом, который его проверяет, поэтому
+// воспользоваться им дважды нельзя даже одновременно
+const useResetTokenSQL = `
+UPDATE PasswordResetToken SET used_at = NOW()
+WHERE hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
 `
@@ -2,22 +2,46 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/ledger"
 	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 )
 
 type Service interface {
-	AddUser(ctx context.Context, username, pwd string) (*models.User, error)
-	FindUser(ctx context.Context, username, pwd string) (*models.User, error)
+	AddUser(ctx context.Context, username, passwordHash string) (*models.User, error)
+	FindUser(ctx context.Context, username string) (*models.User, error)
+	UpdatePasswordHash(ctx context.Context, userID int, oldHash, newHash string) error
+	FindUserByID(ctx context.Context, userID int) (*models.User, error)
+	SetPasswordHash(ctx context.Context, userID int, passwordHash string) error
 	FindOrderByID(ctx context.Context, orderID string) (*models.Order, error)
 	AddOrder(ctx context.Context, orderID string, userID int) error
 	UpdateOrderStatus(ctx context.Context, orderID, newStatus string) error
-	AddAccrualRecord(ctx context.Context, orderID string, sum float64) error
-	FindOrdersByUserID(ctx context.Context, userID int) ([]models.Order, error)
+	LockOrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error)
+	AddAccrualRecord(ctx context.Context, orderID string, sum money.Amount) error
+	FindOrdersByUserID(ctx context.Context, userID int, query models.ListQuery) ([]models.Order, error)
 	GetBalance(ctx context.Context, userID int) (*models.Balance, error)
-	AddWithdrawalRecord(ctx context.Context, orderID string, sum float64, userID int) error
-	GetWithdrawals(ctx context.Context, userID int) ([]models.Withdrawal, error)
+	AddWithdrawalRecord(ctx context.Context, orderID string, sum money.Amount, userID int) error
+	GetWithdrawals(ctx context.Context, userID int, query models.ListQuery) ([]models.Withdrawal, error)
+	PostEntry(ctx context.Context, entry ledger.Entry) error
+	CreateSession(ctx context.Context, session models.Session, refreshHash string, ttl time.Duration) error
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, ttl time.Duration) (*models.Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeAccessToken(ctx context.Context, jti string, ttl time.Duration) error
+	IsAccessTokenRevoked(ctx context.Context, jti, sessionID string) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) error
+	CreateResetToken(ctx context.Context, userID int, tokenHash string, ttl time.Duration) error
+	ConsumeResetToken(ctx context.Context, tokenHash string) (int, error)
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 	Tracker() ordertracker.Tracker
 	Close()
 }
+
+// BalanceDrift - расхождение сохраненного баланса с журналом операций
+type BalanceDrift struct {
+	UserID int
+	Stored models.Balance
+	Actual models.Balance
+}
@@ -0,0 +1,64 @@
+package ledger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
+)
+
+// Book - журнал проводок в памяти. Принимает только сбалансированные проводки,
+// поэтому сумма балансов всех счетов всегда равна нулю
+type Book struct {
+	mu       sync.RWMutex
+	entries  []Entry
+	balances map[AccountID]money.Amount
+}
+
+func NewBook() *Book {
+	return &Book{balances: make(map[AccountID]money.Amount)}
+}
+
+// Post проверяет проводку и добавляет ее в журнал
+func (b *Book) Post(e Entry) (Entry, error) {
+	if err := e.Validate(); err != nil {
+		return Entry{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.ID = int64(len(b.entries) + 1)
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.Postings = append([]Posting(nil), e.Postings...)
+	for _, p := range e.Postings {
+		b.balances[p.Account] += p.Amount
+	}
+	b.entries = append(b.entries, e)
+	return e, nil
+}
+
+// Balance возвращает баланс счета
+func (b *Book) Balance(account AccountID) money.Amount {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.balances[account]
+}
+
+// Entries возвращает копию журнала в порядке добавления
+func (b *Book) Entries() []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]Entry(nil), b.entries...)
+}
+
+// Total возвращает сумму балансов всех счетов; для корректного журнала это ноль
+func (b *Book) Total() money.Amount {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var total money.Amount
+	for _, v := range b.balances {
+		total += v
+	}
+	return total
+}
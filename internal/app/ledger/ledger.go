@@ -0,0 +1,175 @@
+// Package ledger - двойная запись для баллов лояльности.
+//
+// Каждая операция - это проводка (Entry) из нескольких движений (Posting) по
+// счетам. Сумма движений одной проводки всегда равна нулю: баллы не возникают
+// и не исчезают, а только переходят между счетами. Баланс счета - сумма его движений.
+// Баллы пользователя лежат на его счете; системные счета - источник начислений
+// и получатели списаний, их балансы обычно отрицательные или положительные
+// соответственно.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
+)
+
+var ErrEmptyEntry = errors.New("entry must have at least two postings")
+var ErrZeroPosting = errors.New("posting amount must not be zero")
+var ErrUnbalanced = errors.New("entry postings do not sum to zero")
+var ErrUnknownKind = errors.New("unknown entry kind")
+var ErrNotUserAccount = errors.New("not a user account")
+
+// AccountID - идентификатор счета
+type AccountID string
+
+const userAccountPrefix = "user:"
+
+// системные счета
+const (
+	// откуда приходят баллы, начисленные системой расчета
+	AccrualSource AccountID = "system:accrual"
+	// куда уходят баллы, потраченные пользователями
+	WithdrawalSink AccountID = "system:withdrawal"
+	// корректировки, сделанные вручную
+	Adjustments AccountID = "system:adjustment"
+	// куда уходят сгоревшие баллы
+	Expirations AccountID = "system:expiration"
+)
+
+// SystemAccounts - все системные счета
+var SystemAccounts = []AccountID{AccrualSource, WithdrawalSink, Adjustments, Expirations}
+
+// UserAccount - счет пользователя
+func UserAccount(userID int) AccountID {
+	return AccountID(fmt.Sprintf("%v%v", userAccountPrefix, userID))
+}
+
+// UserID возвращает пользователя, которому принадлежит счет
+func (a AccountID) UserID() (int, error) {
+	if !strings.HasPrefix(string(a), userAccountPrefix) {
+		return 0, fmt.Errorf("%w: %v", ErrNotUserAccount, a)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(a), userAccountPrefix))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrNotUserAccount, a)
+	}
+	return id, nil
+}
+
+// IsUser сообщает, что счет принадлежит пользователю
+func (a AccountID) IsUser() bool {
+	_, err := a.UserID()
+	return err == nil
+}
+
+type EntryKind string
+
+const (
+	KindAccrual    EntryKind = "ACCRUAL"
+	KindWithdrawal EntryKind = "WITHDRAWAL"
+	KindRefund     EntryKind = "REFUND"
+	KindCorrection EntryKind = "CORRECTION"
+	KindExpiration EntryKind = "EXPIRATION"
+)
+
+func (k EntryKind) Valid() bool {
+	switch k {
+	case KindAccrual, KindWithdrawal, KindRefund, KindCorrection, KindExpiration:
+		return true
+	}
+	return false
+}
+
+// Posting - изменение баланса счета: положительное увеличивает, отрицательное уменьшает
+type Posting struct {
+	Account AccountID
+	Amount  money.Amount
+}
+
+// Entry - проводка
+type Entry struct {
+	ID   int64
+	Kind EntryKind
+	// номер заказа, к которому относится проводка; может быть пустым
+	OrderID   string
+	Memo      string
+	Postings  []Posting
+	CreatedAt time.Time
+}
+
+// Validate проверяет инварианты двойной записи
+func (e Entry) Validate() error {
+	if !e.Kind.Valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownKind, e.Kind)
+	}
+	if len(e.Postings) < 2 {
+		return ErrEmptyEntry
+	}
+	var sum money.Amount
+	for _, p := range e.Postings {
+		if p.Amount == 0 {
+			return fmt.Errorf("%w: account=%v", ErrZeroPosting, p.Account)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: kind=%v orderID=%v sum=%v", ErrUnbalanced, e.Kind, e.OrderID, sum)
+	}
+	return nil
+}
+
+// AmountFor возвращает суммарное изменение баланса счета в проводке
+func (e Entry) AmountFor(account AccountID) money.Amount {
+	var sum money.Amount
+	for _, p := range e.Postings {
+		if p.Account == account {
+			sum += p.Amount
+		}
+	}
+	return sum
+}
+
+func transfer(kind EntryKind, orderID string, from, to AccountID, sum money.Amount) Entry {
+	return Entry{
+		Kind:    kind,
+		OrderID: orderID,
+		Postings: []Posting{
+			{Account: from, Amount: -sum},
+			{Account: to, Amount: sum},
+		},
+	}
+}
+
+// Accrual - начисление баллов за заказ
+func Accrual(userID int, orderID string, sum money.Amount) Entry {
+	return transfer(KindAccrual, orderID, AccrualSource, UserAccount(userID), sum)
+}
+
+// Withdrawal - списание баллов в счет оплаты заказа
+func Withdrawal(userID int, orderID string, sum money.Amount) Entry {
+	return transfer(KindWithdrawal, orderID, UserAccount(userID), WithdrawalSink, sum)
+}
+
+// Refund - возврат ранее списанных баллов
+func Refund(userID int, orderID string, sum money.Amount) Entry {
+	return transfer(KindRefund, orderID, WithdrawalSink, UserAccount(userID), sum)
+}
+
+// Correction - ручная корректировка баланса пользователя на delta (может быть отрицательной)
+func Correction(userID int, delta money.Amount, memo string) Entry {
+	e := transfer(KindCorrection, "", Adjustments, UserAccount(userID), delta)
+	e.Memo = memo
+	return e
+}
+
+// Expiration - сгорание баллов пользователя
+func Expiration(userID int, sum money.Amount, memo string) Entry {
+	e := transfer(KindExpiration, "", UserAccount(userID), Expirations, sum)
+	e.Memo = memo
+	return e
+}
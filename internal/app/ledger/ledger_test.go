@@ -0,0 +1,135 @@
+package ledger
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryConstructorsAreBalanced(t *testing.T) {
+	sum := money.FromUnits(10)
+	entries := []Entry{
+		Accrual(1, "18", sum),
+		Withdrawal(1, "26", sum),
+		Refund(1, "26", sum),
+		Correction(1, sum, "support ticket"),
+		Correction(1, -sum, "support ticket"),
+		Expiration(1, sum, "yearly expiration"),
+	}
+	for _, e := range entries {
+		assert.NoError(t, e.Validate(), e.Kind)
+	}
+	assert.Equal(t, sum, Accrual(1, "18", sum).AmountFor(UserAccount(1)))
+	assert.Equal(t, -sum, Withdrawal(1, "26", sum).AmountFor(UserAccount(1)))
+}
+
+func TestValidate(t *testing.T) {
+	user := UserAccount(1)
+	tests := []struct {
+		name  string
+		entry Entry
+		err   error
+	}{
+		{
+			name:  "unknown kind",
+			entry: Entry{Kind: "GIFT", Postings: []Posting{{user, 1}, {AccrualSource, -1}}},
+			err:   ErrUnknownKind,
+		},
+		{
+			name:  "single posting",
+			entry: Entry{Kind: KindAccrual, Postings: []Posting{{user, 1}}},
+			err:   ErrEmptyEntry,
+		},
+		{
+			name:  "zero posting",
+			entry: Entry{Kind: KindAccrual, Postings: []Posting{{user, 0}, {AccrualSource, 0}}},
+			err:   ErrZeroPosting,
+		},
+		{
+			name:  "unbalanced",
+			entry: Entry{Kind: KindAccrual, Postings: []Posting{{user, 2}, {AccrualSource, -1}}},
+			err:   ErrUnbalanced,
+		},
+	}
+	for _, tt := range tests {
+		assert.ErrorIs(t, tt.entry.Validate(), tt.err, tt.name)
+	}
+}
+
+func TestUserAccount(t *testing.T) {
+	id, err := UserAccount(42).UserID()
+	require.NoError(t, err)
+	assert.Equal(t, 42, id)
+	assert.True(t, UserAccount(42).IsUser())
+	assert.False(t, AccrualSource.IsUser())
+	_, err = AccountID("user:abc").UserID()
+	assert.ErrorIs(t, err, ErrNotUserAccount)
+}
+
+func TestBookRejectsUnbalanced(t *testing.T) {
+	b := NewBook()
+	_, err := b.Post(Entry{Kind: KindCorrection, Postings: []Posting{{UserAccount(1), 5}, {Adjustments, -4}}})
+	assert.ErrorIs(t, err, ErrUnbalanced)
+	assert.Empty(t, b.Entries())
+	assert.Equal(t, money.Amount(0), b.Balance(UserAccount(1)))
+}
+
+// случайные операции нескольких пользователей: после каждой
+// сумма всех балансов - ноль, а баланс пользователя совпадает с ожидаемым
+func TestBooksAlwaysBalance(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	b := NewBook()
+	expected := map[int]money.Amount{}
+	for i := 0; i < 1000; i++ {
+		userID := r.Intn(5)
+		sum := money.Amount(r.Intn(10000) + 1)
+		var e Entry
+		switch r.Intn(5) {
+		case 0:
+			e = Accrual(userID, "", sum)
+			expected[userID] += sum
+		case 1:
+			e = Withdrawal(userID, "", sum)
+			expected[userID] -= sum
+		case 2:
+			e = Refund(userID, "", sum)
+			expected[userID] += sum
+		case 3:
+			if r.Intn(2) == 0 {
+				sum = -sum
+			}
+			e = Correction(userID, sum, "")
+			expected[userID] += sum
+		case 4:
+			e = Expiration(userID, sum, "")
+			expected[userID] -= sum
+		}
+		_, err := b.Post(e)
+		require.NoError(t, err)
+		require.Equal(t, money.Amount(0), b.Total())
+	}
+	for userID, want := range expected {
+		assert.Equal(t, want, b.Balance(UserAccount(userID)))
+	}
+}
+
+func TestBookConcurrentPosts(t *testing.T) {
+	b := NewBook()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := b.Post(Accrual(i%3, "", money.FromUnits(1)))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, b.Entries(), 100)
+	assert.Equal(t, money.Amount(0), b.Total())
+	assert.Equal(t, money.FromUnits(-100), b.Balance(AccrualSource))
+}
@@ -1,21 +1,8 @@
 package models
 
-import (
-	"database/sql"
-	"encoding/json"
-)
+import "github.com/blokhinnv/gophermart/internal/app/money"
 
 type Balance struct {
-	Current   sql.NullFloat64 `json:"current"`
-	Withdrawn sql.NullFloat64 `json:"withdrawn"`
-}
-
-func (b *Balance) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&struct {
-		Current   float64 `json:"current"`
-		Withdrawn float64 `json:"withdrawn"`
-	}{
-		Current:   b.Current.Float64,
-		Withdrawn: b.Withdrawn.Float64,
-	})
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
 }
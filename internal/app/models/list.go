@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Cursor - позиция в списке заказов или списаний: выборка продолжается с
+// записи, следующей за этой. Списки отсортированы по времени, записи с
+// одинаковым временем - по номеру заказа, а затем по ID
+type Cursor struct {
+	At    time.Time
+	Order string
+	// номер заказа уникален только в списке заказов: по одному заказу может
+	// быть несколько списаний, их различает ID проводки. В списке заказов 0
+	ID int64
+}
+
+// Before сообщает, идет ли запись (at, order, id) в списке после курсора
+func (c Cursor) Before(at time.Time, order string, id int64) bool {
+	switch {
+	case !at.Equal(c.At):
+		return c.At.Before(at)
+	case order != c.Order:
+		return c.Order < order
+	}
+	return c.ID < id
+}
+
+// ListQuery - фильтры и размер страницы списка заказов или списаний
+type ListQuery struct {
+	// сколько записей вернуть; 0 - все
+	Limit int
+	// вернуть записи после этой; nil - с начала списка
+	After *Cursor
+	// только заказы в этих статусах; пусто - в любых. Списки списаний
+	// статус не учитывают
+	Statuses []OrderStatus
+	// записи не раньше From и строго раньше To; нулевое время - без границы
+	From time.Time
+	To   time.Time
+}
+
+// Match проверяет запись (at, order, id) по всем фильтрам, кроме статуса и
+// Limit
+func (q ListQuery) Match(at time.Time, order string, id int64) bool {
+	if !q.From.IsZero() && at.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !at.Before(q.To) {
+		return false
+	}
+	return q.After == nil || q.After.Before(at, order, id)
+}
+
+// HasStatus проверяет фильтр по статусу
+func (q ListQuery) HasStatus(status OrderStatus) bool {
+	if len(q.Statuses) == 0 {
+		return true
+	}
+	for _, s := range q.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -1,29 +1,34 @@
 package models
 
 import (
-	"database/sql"
 	"encoding/json"
 	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
 )
 
 type Order struct {
-	ID         string          `json:"number"`
-	UserID     int             `json:"user_id,omitempty"`
-	StatusID   int             `json:"status_id,omitempty"`
-	UploadedAt time.Time       `json:"uploaded_at,omitempty"`
-	Status     string          `json:"status,omitempty"`
-	Accrual    sql.NullFloat64 `json:"accrual,omitempty"`
+	ID         string           `json:"number"`
+	UserID     int              `json:"user_id,omitempty"`
+	StatusID   int              `json:"status_id,omitempty"`
+	UploadedAt time.Time        `json:"uploaded_at,omitempty"`
+	Status     string           `json:"status,omitempty"`
+	Accrual    money.NullAmount `json:"accrual,omitempty"`
 }
 
 func (o *Order) MarshalJSON() ([]byte, error) {
 	type Alias Order
+	var accrual *money.Amount
+	if o.Accrual.Valid && o.Accrual.Amount != 0 {
+		accrual = &o.Accrual.Amount
+	}
 	return json.Marshal(&struct {
 		*Alias
-		UploadedAt string  `json:"uploaded_at,omitempty"`
-		Accrual    float64 `json:"accrual,omitempty"`
+		UploadedAt string        `json:"uploaded_at,omitempty"`
+		Accrual    *money.Amount `json:"accrual,omitempty"`
 	}{
 		Alias:      (*Alias)(o),
 		UploadedAt: o.UploadedAt.Format(time.RFC3339),
-		Accrual:    o.Accrual.Float64,
+		Accrual:    accrual,
 	})
 }
@@ -0,0 +1,10 @@
+package models
+
+// Session - вход пользователя: семейство refresh-токенов, каждый из которых
+// выдан взамен предыдущего. Отзыв сессии отзывает все ее токены, включая
+// выданные по ним access-токены
+type Session struct {
+	ID       string
+	UserID   int
+	Username string
+}
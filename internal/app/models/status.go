@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownStatus = errors.New("unknown order status")
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// OrderStatus - статус заказа в системе расчета баллов
+type OrderStatus string
+
+const (
+	// заказ загружен, но система расчета о нем еще не сообщала
+	StatusNew OrderStatus = "NEW"
+	// заказ зарегистрирован, но начисление не рассчитано
+	StatusRegistered OrderStatus = "REGISTERED"
+	// расчет начисления в процессе
+	StatusProcessing OrderStatus = "PROCESSING"
+	// заказ не принят к расчету, баллы не начисляются
+	StatusInvalid OrderStatus = "INVALID"
+	// расчет начисления окончен
+	StatusProcessed OrderStatus = "PROCESSED"
+)
+
+// transitions - допустимые переходы между статусами. Повтор текущего
+// статуса допустим для нетерминальных статусов: система расчета может
+// несколько раз подряд ответить, что заказ еще в работе
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusNew:        {StatusRegistered, StatusProcessing, StatusInvalid, StatusProcessed},
+	StatusRegistered: {StatusRegistered, StatusProcessing, StatusInvalid, StatusProcessed},
+	StatusProcessing: {StatusProcessing, StatusInvalid, StatusProcessed},
+	StatusInvalid:    {},
+	StatusProcessed:  {},
+}
+
+// ParseOrderStatus проверяет, что s - известный статус
+func ParseOrderStatus(s string) (OrderStatus, error) {
+	status := OrderStatus(s)
+	if _, ok := transitions[status]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+	return status, nil
+}
+
+// Terminal возвращает true, если из статуса нет переходов: заказ больше не
+// нужно опрашивать
+func (s OrderStatus) Terminal() bool {
+	return len(transitions[s]) == 0
+}
+
+// CanTransitionTo возвращает true, если заказ можно перевести из s в next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransition возвращает ErrIllegalTransition, если заказ нельзя
+// перевести из from в to
+func CheckTransition(from, to OrderStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOrderStatus(t *testing.T) {
+	status, err := ParseOrderStatus("PROCESSED")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusProcessed, status)
+
+	_, err = ParseOrderStatus("processed")
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+	_, err = ParseOrderStatus("")
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+func TestTerminal(t *testing.T) {
+	assert.True(t, StatusInvalid.Terminal())
+	assert.True(t, StatusProcessed.Terminal())
+	assert.False(t, StatusNew.Terminal())
+	assert.False(t, StatusRegistered.Terminal())
+	assert.False(t, StatusProcessing.Terminal())
+}
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		ok       bool
+	}{
+		{StatusNew, StatusRegistered, true},
+		{StatusNew, StatusProcessed, true},
+		{StatusNew, StatusNew, false},
+		{StatusRegistered, StatusProcessing, true},
+		{StatusProcessing, StatusProcessing, true},
+		{StatusProcessing, StatusInvalid, true},
+		{StatusProcessing, StatusRegistered, false},
+		{StatusProcessed, StatusProcessing, false},
+		{StatusInvalid, StatusProcessed, false},
+		{StatusProcessed, StatusProcessed, false},
+	}
+	for _, tt := range tests {
+		err := CheckTransition(tt.from, tt.to)
+		if tt.ok {
+			assert.NoError(t, err, "%v -> %v", tt.from, tt.to)
+		} else {
+			assert.ErrorIs(t, err, ErrIllegalTransition, "%v -> %v", tt.from, tt.to)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package models
 
+// User - учетная запись. HashedPassword хранится в формате PHC: схема,
+// параметры и соль записаны вместе с хэшем (см. auth.Hasher)
 type User struct {
 	ID             int
 	Username       string
 	HashedPassword string
-	Salt           string
 }
@@ -3,12 +3,21 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/money"
 )
 
 type Withdrawal struct {
-	Order       string    `json:"order"`
-	Sum         float64   `json:"sum"`
-	ProcessedAt time.Time `json:"processed_at"`
+	Order       string       `json:"order"`
+	Sum         money.Amount `json:"sum"`
+	ProcessedAt time.Time    `json:"processed_at"`
+	// ID проводки: нужен курсору, чтобы различать списания по одному заказу
+	EntryID int64 `json:"-"`
+}
+
+// Cursor - позиция списания в списке списаний
+func (wd *Withdrawal) Cursor() Cursor {
+	return Cursor{At: wd.ProcessedAt, Order: wd.Order, ID: wd.EntryID}
 }
 
 func (wd *Withdrawal) MarshalJSON() ([]byte, error) {
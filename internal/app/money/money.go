@@ -0,0 +1,213 @@
+// Package money - баллы лояльности в целых сотых долях.
+//
+// Правила округления:
+//   - суммы из системы расчета баллов приводятся к сотым через Parse
+//     (половина округляется от нуля: 0.005 -> 0.01, -0.005 -> -0.01);
+//   - суммы от пользователя (JSON в запросах) принимаются только точными:
+//     больше двух знаков после точки - ошибка ErrTooPrecise, сумма не округляется,
+//     чтобы не списать больше или меньше запрошенного.
+//
+// В JSON сумма пишется обычным десятичным числом (250.32), как требует спецификация;
+// в БД хранится целым числом сотых (BIGINT).
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount - количество баллов в сотых долях
+type Amount int64
+
+// Scale - количество сотых в одном балле
+const Scale = 100
+
+const fractionDigits = 2
+
+// в int64 помещается не больше 19 десятичных цифр
+const maxDigits = 19
+
+var ErrBadAmount = errors.New("bad amount")
+var ErrTooPrecise = errors.New("amount has more than 2 fraction digits")
+
+// FromUnits возвращает сумму в целых баллах
+func FromUnits(units int64) Amount {
+	return Amount(units * Scale)
+}
+
+// Parse разбирает десятичную запись и округляет ее до сотых
+func Parse(s string) (Amount, error) {
+	return parse(s, true)
+}
+
+// ParseExact разбирает десятичную запись, в которой не больше двух знаков после точки
+func ParseExact(s string) (Amount, error) {
+	return parse(s, false)
+}
+
+func parse(s string, round bool) (Amount, error) {
+	src := s
+	if s == "" {
+		return 0, fmt.Errorf("%w: empty string", ErrBadAmount)
+	}
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	// экспоненту (1e2) спецификация не использует, но JSON ее допускает
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrBadAmount, src)
+		}
+		mantissa, exp = s[:i], e
+		// дальше число дополняется нулями по экспоненте: огромная экспонента
+		// от клиента не должна превращаться в огромную строку. Если она
+		// длиннее самой записи больше, чем на maxDigits, сумма либо не
+		// помещается в int64, либо короче сотой
+		if limit := len(mantissa) + maxDigits; exp > limit || exp < -limit {
+			return 0, fmt.Errorf("%w: %q: exponent out of range", ErrBadAmount, src)
+		}
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	if intPart == "" && fracPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrBadAmount, src)
+	}
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	// позиция десятичной точки относительно начала digits
+	point := len(intPart) - (len(intPart+fracPart) - len(digits)) + exp
+	if digits == "" {
+		return 0, nil
+	}
+	// значимые цифры, которые попадают в сотые, и остаток
+	keep := point + fractionDigits
+	var whole, rest string
+	switch {
+	case keep <= 0:
+		whole, rest = "", strings.Repeat("0", -keep)+digits
+	case keep >= len(digits):
+		whole, rest = digits+strings.Repeat("0", keep-len(digits)), ""
+	default:
+		whole, rest = digits[:keep], digits[keep:]
+	}
+	if strings.TrimRight(rest, "0") != "" && !round {
+		return 0, fmt.Errorf("%w: %q", ErrTooPrecise, src)
+	}
+	var v int64
+	if whole != "" {
+		var err error
+		v, err = strconv.ParseInt(whole, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q: %v", ErrBadAmount, src, err)
+		}
+	}
+	if rest != "" && rest[0] >= '5' {
+		if v == math.MaxInt64 {
+			return 0, fmt.Errorf("%w: %q: out of range", ErrBadAmount, src)
+		}
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String возвращает десятичную запись без лишних нулей: 250.32, 500.5, 100
+func (a Amount) String() string {
+	v := int64(a)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	u := uint64(v)
+	if v < 0 {
+		u = uint64(-v)
+	}
+	units, cents := u/Scale, u%Scale
+	if cents == 0 {
+		return fmt.Sprintf("%v%v", sign, units)
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%02d", cents), "0")
+	return fmt.Sprintf("%v%v.%v", sign, units, frac)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON принимает только JSON-числа с точной суммой (см. ParseExact)
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		return fmt.Errorf("%w: %s: must be a number", ErrBadAmount, s)
+	}
+	v, err := ParseExact(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		*a = Amount(v)
+	case int32:
+		*a = Amount(v)
+	case nil:
+		*a = 0
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrBadAmount, src)
+	}
+	return nil
+}
+
+// NullAmount - сумма, которой может не быть (например, начисление по
+// необработанному заказу)
+type NullAmount struct {
+	Amount Amount
+	Valid  bool
+}
+
+func (n NullAmount) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Amount.Value()
+}
+
+func (n *NullAmount) Scan(src any) error {
+	if src == nil {
+		n.Amount, n.Valid = 0, false
+		return nil
+	}
+	n.Valid = true
+	return n.Amount.Scan(src)
+}
@@ -0,0 +1,135 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"0", 0},
+		{"100", 10000},
+		{"250.32", 25032},
+		{"500.5", 50050},
+		{"0.1", 10},
+		{".5", 50},
+		{"7.", 700},
+		{"0.005", 1},
+		{"0.0049", 0},
+		{"1.995", 200},
+		{"-1.995", -200},
+		{"-0.004", 0},
+		{"1e2", 10000},
+		{"1.5E-1", 15},
+		{"729.98000", 72998},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestParseBad(t *testing.T) {
+	for _, in := range []string{"", "-", ".", "abc", "1.2.3", "1e", "1,5", "99999999999999999999"} {
+		_, err := Parse(in)
+		assert.ErrorIs(t, err, ErrBadAmount, in)
+	}
+}
+
+func TestParseHugeExponent(t *testing.T) {
+	for _, in := range []string{
+		"1e9999999999999999",
+		"1e100000000",
+		"1e-9999999999999999",
+		"1e-100000000",
+		"1e9223372036854775807",
+		"1e-9223372036854775808",
+	} {
+		_, err := Parse(in)
+		assert.ErrorIs(t, err, ErrBadAmount, in)
+		_, err = ParseExact(in)
+		assert.ErrorIs(t, err, ErrBadAmount, in)
+	}
+	// длинная мантисса компенсирует экспоненту
+	v, err := Parse("0.000000000000000000000000015e27")
+	require.NoError(t, err)
+	assert.Equal(t, Amount(1500), v)
+}
+
+func TestParseExact(t *testing.T) {
+	v, err := ParseExact("250.32")
+	require.NoError(t, err)
+	assert.Equal(t, Amount(25032), v)
+
+	v, err = ParseExact("250.3200")
+	require.NoError(t, err)
+	assert.Equal(t, Amount(25032), v)
+
+	_, err = ParseExact("250.321")
+	assert.ErrorIs(t, err, ErrTooPrecise)
+}
+
+func TestString(t *testing.T) {
+	tests := map[Amount]string{
+		0:      "0",
+		10000:  "100",
+		25032:  "250.32",
+		50050:  "500.5",
+		1:      "0.01",
+		-25032: "-250.32",
+		-5:     "-0.05",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, in.String())
+	}
+}
+
+// 0.1 + 0.2 в float64 дает 0.30000000000000004, в сотых - ровно 0.3
+func TestNoDrift(t *testing.T) {
+	a, _ := Parse("0.1")
+	b, _ := Parse("0.2")
+	c, _ := Parse("0.3")
+	assert.Equal(t, c, a+b)
+}
+
+func TestJSON(t *testing.T) {
+	type body struct {
+		Sum Amount `json:"sum"`
+	}
+	var b body
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": 751.5}`), &b))
+	assert.Equal(t, Amount(75150), b.Sum)
+
+	encoded, err := json.Marshal(b)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sum": 751.5}`, string(encoded))
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"sum": 0.001}`), &b), ErrTooPrecise)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"sum": "10"}`), &b), ErrBadAmount)
+
+	// json.Unmarshal отсекает такой ввод раньше, проверяем сам метод
+	var a Amount
+	assert.ErrorIs(t, a.UnmarshalJSON([]byte(`"10`)), ErrBadAmount)
+	assert.ErrorIs(t, a.UnmarshalJSON([]byte(`10"`)), ErrBadAmount)
+	assert.Equal(t, Amount(0), a)
+}
+
+func TestScan(t *testing.T) {
+	var a Amount
+	require.NoError(t, a.Scan(int64(25032)))
+	assert.Equal(t, Amount(25032), a)
+
+	var n NullAmount
+	require.NoError(t, n.Scan(nil))
+	assert.False(t, n.Valid)
+	require.NoError(t, n.Scan(int64(5)))
+	assert.True(t, n.Valid)
+	assert.Equal(t, Amount(5), n.Amount)
+}
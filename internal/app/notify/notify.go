@@ -0,0 +1,95 @@
+// Package notify доставляет пользователям служебные сообщения, например
+// токены сброса пароля. Способ доставки выбирается в настройках
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// способы доставки, из которых можно выбрать NOTIFIER
+const (
+	KindLog  = "log"
+	KindFile = "file"
+)
+
+// KindPasswordReset - сообщение с токеном сброса пароля
+const KindPasswordReset = "password_reset"
+
+// Notification - сообщение пользователю
+type Notification struct {
+	Kind      string    `json:"kind"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Notifier доставляет сообщения пользователям
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// New создает Notifier выбранного вида; path нужен только для KindFile
+func New(kind, path string) (Notifier, error) {
+	switch kind {
+	case KindLog:
+		return LogNotifier{}, nil
+	case KindFile:
+		if path == "" {
+			return nil, fmt.Errorf("notifier %q needs a file path", kind)
+		}
+		return NewFileNotifier(path), nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", kind)
+}
+
+// LogNotifier пишет сообщения в журнал сервиса. Токены попадают в журнал
+// открытым текстом, поэтому он годится только для локального запуска
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf(
+		"Notification %v for user %v (%v): token %v, expires at %v",
+		n.Kind,
+		n.UserID,
+		n.Username,
+		n.Token,
+		n.ExpiresAt.Format(time.RFC3339),
+	)
+	return nil
+}
+
+// FileNotifier дописывает сообщения в файл по одному JSON на строку
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (f *FileNotifier) Notify(ctx context.Context, n Notification) error {
+	line, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// в файле секреты - читать его может только владелец
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	notifier, err := New(KindFile, path)
+	require.NoError(t, err)
+
+	expiresAt := time.Date(2022, time.December, 1, 12, 0, 0, 0, time.UTC)
+	sent := []Notification{
+		{Kind: KindPasswordReset, UserID: 1, Username: "nikita", Token: "t1", ExpiresAt: expiresAt},
+		{Kind: KindPasswordReset, UserID: 2, Username: "other", Token: "t2", ExpiresAt: expiresAt},
+	}
+	for _, n := range sent {
+		require.NoError(t, notifier.Notify(context.Background(), n))
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var received []Notification
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var n Notification
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &n))
+		received = append(received, n)
+	}
+	assert.Equal(t, sent, received)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(KindFile, "")
+	assert.Error(t, err)
+	_, err = New("carrier-pigeon", "")
+	assert.Error(t, err)
+	notifier, err := New(KindLog, "")
+	require.NoError(t, err)
+	assert.NoError(t, notifier.Notify(context.Background(), Notification{Kind: KindPasswordReset}))
+}
@@ -2,18 +2,108 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"net/url"
+	"os"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 )
 
+// хранилища, из которых можно выбрать DATABASE_BACKEND
+const (
+	BackendPostgres = "postgres"
+	// данные в памяти процесса теряются при остановке; DATABASE_URI не нужен
+	BackendMemory = "memory"
+)
+
+// что делать со схемой БД при запуске (DATABASE_MIGRATE)
+const (
+	// накатить недостающие миграции
+	MigrateUp = "up"
+	// только проверить версию схемы и отказаться работать с несовместимой
+	MigrateVerify = "verify"
+	// не проверять схему
+	MigrateOff = "off"
+)
+
+// DevJWTSigningKey - секрет HS256 по умолчанию. Он есть в репозитории,
+// поэтому без DEV_MODE сервис с ним не запускается
+const DevJWTSigningKey = "practicum"
+
 type Config struct {
+	DevMode                   bool          `env:"DEV_MODE"`
 	RunAddress                string        `env:"RUN_ADDRESS"`
+	DatabaseBackend           string        `env:"DATABASE_BACKEND"             envDefault:"postgres"`
 	DatabaseURI               string        `env:"DATABASE_URI"`
+	DatabaseMigrate           string        `env:"DATABASE_MIGRATE"             envDefault:"verify"`
 	AccrualSystemAddress      string        `env:"ACCRUAL_SYSTEM_ADDRESS"`
 	JWTSigningKey             string        `env:"JWT_SIGNING_KEY"              envDefault:"practicum"`
-	JWTExpireDuration         time.Duration `env:"JWT_EXPIRE_DURATION"          envDefault:"1h"`
+	JWTExpireDuration         time.Duration `env:"JWT_EXPIRE_DURATION"          envDefault:"15m"`
+	JWTRefreshExpireDuration  time.Duration `env:"JWT_REFRESH_EXPIRE_DURATION"  envDefault:"720h"`
+	JWTKeysDir                string        `env:"JWT_KEYS_DIR"`
+	JWTKeyAlgorithm           string        `env:"JWT_KEY_ALGORITHM"            envDefault:"EdDSA"`
+	JWTKeyRotationInterval    time.Duration `env:"JWT_KEY_ROTATION_INTERVAL"`
+	JWTKeyGracePeriod         time.Duration `env:"JWT_KEY_GRACE_PERIOD"         envDefault:"1h"`
+	JWTKeysReloadInterval     time.Duration `env:"JWT_KEYS_RELOAD_INTERVAL"     envDefault:"1m"`
+	PasswordHash              string        `env:"PASSWORD_HASH"                envDefault:"argon2id"`
+	PasswordMinLength         int           `env:"PASSWORD_MIN_LENGTH"          envDefault:"8"`
+	PasswordMaxLength         int           `env:"PASSWORD_MAX_LENGTH"          envDefault:"128"`
+	PasswordMinCharClasses    int           `env:"PASSWORD_MIN_CHAR_CLASSES"    envDefault:"1"`
+	PasswordResetTokenTTL     time.Duration `env:"PASSWORD_RESET_TOKEN_TTL"     envDefault:"30m"`
+	Notifier                  string        `env:"NOTIFIER"`
+	NotifierFile              string        `env:"NOTIFIER_FILE"`
+	LoginFreeAttempts         int           `env:"LOGIN_FREE_ATTEMPTS"          envDefault:"3"`
+	LoginLockoutThreshold     int           `env:"LOGIN_LOCKOUT_THRESHOLD"      envDefault:"10"`
+	LoginIPFreeAttempts       int           `env:"LOGIN_IP_FREE_ATTEMPTS"       envDefault:"20"`
+	LoginIPLockoutThreshold   int           `env:"LOGIN_IP_LOCKOUT_THRESHOLD"   envDefault:"100"`
+	LoginBaseDelay            time.Duration `env:"LOGIN_BASE_DELAY"             envDefault:"1s"`
+	LoginMaxDelay             time.Duration `env:"LOGIN_MAX_DELAY"              envDefault:"1m"`
+	LoginLockoutDuration      time.Duration `env:"LOGIN_LOCKOUT_DURATION"       envDefault:"15m"`
 	AccrualSystemPoolInterval time.Duration `env:"ACCRUAL_SYSTEM_POOL_INTERVAL" envDefault:"1s"`
+	AccrualWorkers            int           `env:"ACCRUAL_WORKERS"              envDefault:"2"`
+	AccrualWorkersMin         int           `env:"ACCRUAL_WORKERS_MIN"`
+	AccrualWorkersMax         int           `env:"ACCRUAL_WORKERS_MAX"`
+	AccrualScaleInterval      time.Duration `env:"ACCRUAL_SCALE_INTERVAL"       envDefault:"10s"`
+	AccrualTaskTimeout        time.Duration `env:"ACCRUAL_TASK_TIMEOUT"         envDefault:"10s"`
+	AccrualBatchSize          int           `env:"ACCRUAL_BATCH_SIZE"           envDefault:"10"`
+	AccrualParallelism        int           `env:"ACCRUAL_PARALLELISM"          envDefault:"4"`
+	AccrualRetryBaseDelay     time.Duration `env:"ACCRUAL_RETRY_BASE_DELAY"     envDefault:"1s"`
+	AccrualRetryMaxDelay      time.Duration `env:"ACCRUAL_RETRY_MAX_DELAY"      envDefault:"10m"`
+	AccrualRetryJitter        float64       `env:"ACCRUAL_RETRY_JITTER"         envDefault:"0.2"`
+	AccrualMaxAttempts        int           `env:"ACCRUAL_MAX_ATTEMPTS"         envDefault:"100"`
+	AccrualMaxAge             time.Duration `env:"ACCRUAL_MAX_AGE"              envDefault:"72h"`
+	AccrualLeaseDuration      time.Duration `env:"ACCRUAL_LEASE_DURATION"       envDefault:"1m"`
+	AccrualRequestTimeout     time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT"      envDefault:"5s"`
+	AccrualRateLimit          float64       `env:"ACCRUAL_RATE_LIMIT"           envDefault:"0"`
+	AccrualFailureThreshold   int           `env:"ACCRUAL_FAILURE_THRESHOLD"    envDefault:"5"`
+	AccrualOpenTimeout        time.Duration `env:"ACCRUAL_OPEN_TIMEOUT"         envDefault:"30s"`
+	AccrualCallbackSecret     string        `env:"ACCRUAL_CALLBACK_SECRET"`
+	AccrualCallbackPollDelay  time.Duration `env:"ACCRUAL_CALLBACK_POLL_DELAY"  envDefault:"5m"`
+}
+
+// String скрывает секреты: конфигурация пишется в лог при запуске
+func (cfg Config) String() string {
+	// у копии нет метода String, иначе Sprintf вызвал бы его рекурсивно
+	type plain Config
+	c := plain(cfg)
+	c.JWTSigningKey = redact(c.JWTSigningKey)
+	c.AccrualCallbackSecret = redact(c.AccrualCallbackSecret)
+	// строка вида "host=... password=..." тоже разбирается как URL, но
+	// пароль в ней Redacted не найдет
+	if u, err := url.Parse(c.DatabaseURI); err == nil && u.Scheme != "" {
+		c.DatabaseURI = u.Redacted()
+	} else {
+		c.DatabaseURI = redact(c.DatabaseURI)
+	}
+	return fmt.Sprintf("%+v", c)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "xxxxx"
 }
 
 func NewConfig() (*Config, error) {
@@ -21,15 +111,29 @@ func NewConfig() (*Config, error) {
 	if err := env.Parse(&cfg); err != nil {
 		return nil, err
 	}
+	if _, ok := os.LookupEnv("DEV_MODE"); !ok {
+		flag.BoolVar(&cfg.DevMode, "dev", false, "режим разработки: разрешает небезопасные настройки по умолчанию")
+	}
 	if cfg.RunAddress == "" {
 		flag.StringVar(&cfg.RunAddress, "a", "", "адрес и порт запуска сервиса")
 	}
 	if cfg.DatabaseURI == "" {
 		flag.StringVar(&cfg.DatabaseURI, "d", "", "адрес подключения к базе данных")
 	}
+	if _, ok := os.LookupEnv("DATABASE_BACKEND"); !ok {
+		flag.StringVar(&cfg.DatabaseBackend, "s", cfg.DatabaseBackend, "хранилище: postgres или memory")
+	}
+	if _, ok := os.LookupEnv("DATABASE_MIGRATE"); !ok {
+		flag.StringVar(&cfg.DatabaseMigrate, "m", cfg.DatabaseMigrate, "схема БД при запуске: up, verify или off")
+	}
 	if cfg.AccrualSystemAddress == "" {
 		flag.StringVar(&cfg.AccrualSystemAddress, "r", "", "адрес системы расчёта начислений")
 	}
+	// у количества воркеров есть значение по умолчанию, поэтому флаг
+	// проверяем по наличию переменной окружения
+	if _, ok := os.LookupEnv("ACCRUAL_WORKERS"); !ok {
+		flag.IntVar(&cfg.AccrualWorkers, "w", cfg.AccrualWorkers, "количество воркеров системы расчёта")
+	}
 	flag.Parse()
 	return &cfg, nil
 }
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+// максимальный размер уведомления: в нем только номер, статус и начисление
+const maxCallbackBodySize = 1 << 16
+
+// OrderUpdater применяет сведения о заказе тем же путем, что и опрос
+// системы расчета
+type OrderUpdater interface {
+	Apply(ctx context.Context, info *accrual.OrderInfo) (bool, error)
+}
+
+// AccrualCallback принимает уведомления системы расчета об изменении
+// статуса заказа. Уведомление подписано общим секретом (см. accrual.Sign)
+type AccrualCallback struct {
+	updater OrderUpdater
+	secret  []byte
+	now     func() time.Time
+}
+
+func NewAccrualCallback(updater OrderUpdater, secret string) *AccrualCallback {
+	return &AccrualCallback{updater: updater, secret: []byte(secret), now: time.Now}
+}
+
+// Handler отвечает 200 и на уже примененное уведомление, поэтому система
+// расчета может повторять его, пока не получит ответ
+func (h *AccrualCallback) Handler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBodySize))
+	if err != nil {
+		http.Error(w, ErrIncorrectRequest.Error(), http.StatusBadRequest)
+		return
+	}
+	// подпись проверяется до разбора тела: неподписанным данным не доверяем
+	err = accrual.VerifySignature(
+		h.secret,
+		r.Header.Get(accrual.SignatureHeader),
+		body,
+		h.now(),
+		accrual.SignatureTolerance,
+	)
+	if err != nil {
+		log.Printf("Rejected accrual callback: %v", err)
+		http.Error(w, accrual.ErrBadSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+	info, err := accrual.ParseOrderInfo(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changed, err := h.updater.Apply(r.Context(), info)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrMissingOrderID):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, models.ErrIllegalTransition):
+			// устаревшее уведомление: заказ уже продвинулся дальше
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Error while applying accrual callback for orderID=%v: %v", info.Order, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !changed {
+		log.Printf("Accrual callback for orderID=%v is already applied", info.Order)
+	}
+	w.WriteHeader(http.StatusOK)
+}
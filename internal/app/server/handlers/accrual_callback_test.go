@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOrderUpdater struct {
+	applied []accrual.OrderInfo
+	changed bool
+	err     error
+}
+
+func (f *fakeOrderUpdater) Apply(ctx context.Context, info *accrual.OrderInfo) (bool, error) {
+	f.applied = append(f.applied, *info)
+	return f.changed, f.err
+}
+
+func TestAccrualCallback(t *testing.T) {
+	const secret = "secret"
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"order":"18","status":"PROCESSED","accrual":500.5}`)
+	signed := accrual.Sign([]byte(secret), now, body)
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		changed   bool
+		err       error
+		code      int
+		applied   bool
+	}{
+		{name: "applied", body: body, signature: signed, changed: true, code: http.StatusOK, applied: true},
+		{name: "duplicate", body: body, signature: signed, code: http.StatusOK, applied: true},
+		{name: "no signature", body: body, code: http.StatusUnauthorized},
+		{
+			name:      "other secret",
+			body:      body,
+			signature: accrual.Sign([]byte("other"), now, body),
+			code:      http.StatusUnauthorized,
+		},
+		{
+			name:      "bad body",
+			body:      []byte(`{"order":"18","status":"LOST"}`),
+			signature: accrual.Sign([]byte(secret), now, []byte(`{"order":"18","status":"LOST"}`)),
+			code:      http.StatusBadRequest,
+		},
+		{
+			name:      "unknown order",
+			body:      body,
+			signature: signed,
+			err:       database.ErrMissingOrderID,
+			code:      http.StatusNotFound,
+			applied:   true,
+		},
+		{
+			name:      "stale",
+			body:      body,
+			signature: signed,
+			err:       models.ErrIllegalTransition,
+			code:      http.StatusConflict,
+			applied:   true,
+		},
+	}
+	for _, tt := range tests {
+		updater := &fakeOrderUpdater{changed: tt.changed, err: tt.err}
+		h := NewAccrualCallback(updater, secret)
+		h.now = func() time.Time { return now }
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/accrual/callback", bytes.NewReader(tt.body))
+		if tt.signature != "" {
+			req.Header.Set(accrual.SignatureHeader, tt.signature)
+		}
+		h.Handler(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.name)
+		if tt.applied {
+			assert.Equal(t, []accrual.OrderInfo{
+				{Order: "18", Status: models.StatusProcessed, Accrual: money.Amount(50050)},
+			}, updater.applied, tt.name)
+		} else {
+			assert.Empty(t, updater.applied, tt.name)
+		}
+	}
+}
@@ -3,10 +3,38 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/blokhinnv/gophermart/internal/app/auth"
 	"github.com/go-chi/jwtauth/v5"
 )
 
+// Verifier проверяет токен из заголовка Authorization или cookie jwt
+// ключами из keys и кладет результат в контекст, как jwtauth.Verifier.
+// Решение о доступе принимает следующий за ним jwtauth.Authenticator
+func Verifier(keys *auth.KeyRing) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := jwtauth.TokenFromHeader(r)
+			if tokenString == "" {
+				tokenString = jwtauth.TokenFromCookie(r)
+			}
+			var ctx context.Context
+			if tokenString == "" {
+				ctx = jwtauth.NewContext(r.Context(), nil, jwtauth.ErrNoTokenFound)
+			} else {
+				token, err := keys.Verify(tokenString)
+				if err != nil {
+					err = jwtauth.ErrorReason(err)
+				}
+				ctx = jwtauth.NewContext(r.Context(), token, err)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func GetUserIDFromContext(ctx context.Context) (int, error) {
 	_, claims, _ := jwtauth.FromContext(ctx)
 	userID, ok := claims["user_id"].(float64)
@@ -15,3 +43,28 @@ func GetUserIDFromContext(ctx context.Context) (int, error) {
 	}
 	return int(userID), nil
 }
+
+// accessToken - поля access-токена, нужные для его отзыва
+type accessToken struct {
+	ID        string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// GetTokenFromContext достает из проверенного токена jti и сессию. Токены,
+// выданные до появления сессий, этих полей не имеют и не принимаются
+func GetTokenFromContext(ctx context.Context) (*accessToken, error) {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return nil, fmt.Errorf("%w: no token", ErrBadClaims)
+	}
+	sessionID, _ := claims["sid"].(string)
+	if token.JwtID() == "" || sessionID == "" {
+		return nil, fmt.Errorf("%w: %+v", ErrBadClaims, claims)
+	}
+	return &accessToken{
+		ID:        token.JwtID(),
+		SessionID: sessionID,
+		ExpiresAt: token.Expiration(),
+	}, nil
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
 	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -52,10 +52,7 @@ func (suite *BalanceTestSuite) TestNoTransactions() {
 	suite.db.EXPECT().
 		GetBalance(gomock.Any(), gomock.Eq(1)).
 		Times(1).
-		Return(&models.Balance{
-			Current:   sql.NullFloat64{Float64: 0, Valid: false},
-			Withdrawn: sql.NullFloat64{Float64: 0, Valid: false},
-		}, nil)
+		Return(&models.Balance{}, nil)
 
 	rr := suite.makeRequest("TestNoTransactions", true)
 	suite.Equal(http.StatusOK, rr.Code)
@@ -71,8 +68,8 @@ func (suite *BalanceTestSuite) TestSomeTransactions() {
 		GetBalance(gomock.Any(), gomock.Eq(1)).
 		Times(1).
 		Return(&models.Balance{
-			Current:   sql.NullFloat64{Float64: 250.32, Valid: true},
-			Withdrawn: sql.NullFloat64{Float64: 50.54, Valid: true},
+			Current:   money.Amount(25032),
+			Withdrawn: money.Amount(5054),
 		}, nil)
 
 	rr := suite.makeRequest("TestSomeTransactions", true)
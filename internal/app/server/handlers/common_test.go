@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -24,16 +25,81 @@ type AuthHandlerTestSuite struct {
 func (suite *AuthHandlerTestSuite) setupAuth(
 	handler http.HandlerFunc,
 ) {
-	signingKey := []byte("qwerty")
-	token := auth.GenerateJWTToken(
+	claims, _ := auth.NewClaims(
 		&models.User{ID: 1, Username: "nikita"},
-		signingKey,
+		"session",
 		time.Hour,
 	)
-	tokenSign, _ := token.SignedString(signingKey)
+	tokenSign, _ := testKeys.Sign(claims)
 	suite.tokenSign = tokenSign
-	tokenAuth := jwtauth.New("HS256", signingKey, nil)
-	verifier := jwtauth.Verifier(tokenAuth)
+	verifier := Verifier(testKeys)
 	authentifier := jwtauth.Authenticator
 	suite.handler = verifier(authentifier(handler))
 }
+
+// testKeys - ключ HS256 для тестов, которым не важен алгоритм подписи
+var testKeys = func() *auth.KeyRing {
+	key, err := auth.NewKey("test", []byte("qwerty"), time.Time{})
+	if err != nil {
+		panic(err)
+	}
+	keys, err := auth.NewKeyRing(time.Hour, key)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}()
+
+// testThrottleConfig не мешает тестам, которые не проверяют ограничение входа
+var testThrottleConfig = auth.ThrottleConfig{
+	Login:           auth.AttemptLimits{Free: 1000},
+	IP:              auth.AttemptLimits{Free: 1000},
+	LockoutDuration: time.Hour,
+}
+
+// testHasher - дешевые параметры argon2id, чтобы тесты не тормозили
+var testHasher = auth.NewHasher(auth.Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 16})
+
+func mustHash(password string) string {
+	hash, err := testHasher.Hash(password)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// passwordHashOf совпадает с хэшем, который подходит к password
+type passwordHashOf string
+
+func (m passwordHashOf) Matches(x any) bool {
+	hash, ok := x.(string)
+	if !ok {
+		return false
+	}
+	verified, rehash, err := testHasher.Verify(string(m), hash)
+	return err == nil && verified && !rehash
+}
+
+func (m passwordHashOf) String() string {
+	return fmt.Sprintf("is a password hash of %q", string(m))
+}
+
+// expectSession ожидает открытие сессии пользователя userID
+func expectSession(db *database.MockService, userID int) {
+	db.EXPECT().
+		CreateSession(gomock.Any(), sessionOf(userID), gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(nil)
+}
+
+// sessionOf совпадает с новой сессией пользователя userID
+type sessionOf int
+
+func (m sessionOf) Matches(x any) bool {
+	session, ok := x.(models.Session)
+	return ok && session.ID != "" && session.UserID == int(m)
+}
+
+func (m sessionOf) String() string {
+	return fmt.Sprintf("is a session of user %v", int(m))
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
 )
 
 type GetOrder struct {
@@ -19,7 +19,12 @@ func (h *GetOrder) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	orders, err := h.db.FindOrdersByUserID(ctx, userID)
+	query, err := parseListQuery(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orders, err := h.db.FindOrdersByUserID(ctx, userID, fetchQuery(query))
 	if err != nil {
 		if errors.Is(err, database.ErrEmptyResult) {
 			http.Error(w, err.Error(), http.StatusNoContent)
@@ -28,12 +33,7 @@ func (h *GetOrder) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	ordersEncoded, err := json.Marshal(orders)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(ordersEncoded)
+	writeList(w, r, orders, query, func(o *models.Order) models.Cursor {
+		return models.Cursor{At: o.UploadedAt, Order: o.ID}
+	})
 }
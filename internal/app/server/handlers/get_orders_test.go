@@ -1,16 +1,19 @@
 package handlers
 
 import (
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
 	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -47,6 +50,22 @@ func (suite *GetOrdersTestSuite) makeRequest(
 	return rr
 }
 
+func (suite *GetOrdersTestSuite) makeListRequest(
+	testName string,
+	target string,
+	accept string,
+) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer: %v", suite.tokenSign))
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	suite.handler.ServeHTTP(rr, req)
+	log.Printf("[%v]: %v", testName, rr.Body.String())
+	return rr
+}
+
 func (suite *GetOrdersTestSuite) TestNoAuth() {
 	rr := suite.makeRequest("TestNoAuth", false)
 	suite.Equal(http.StatusUnauthorized, rr.Code)
@@ -54,7 +73,7 @@ func (suite *GetOrdersTestSuite) TestNoAuth() {
 
 func (suite *GetOrdersTestSuite) TestNoContent() {
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(nil, database.ErrEmptyResult)
 
@@ -69,12 +88,12 @@ func (suite *GetOrdersTestSuite) TestNew() {
 			ID:         "18",
 			Status:     "NEW",
 			UploadedAt: start,
-			Accrual:    sql.NullFloat64{Float64: 0, Valid: false},
+			Accrual:    money.NullAmount{},
 		},
 	}
 
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(orders, nil)
 
@@ -95,12 +114,12 @@ func (suite *GetOrdersTestSuite) TestProcessing() {
 			ID:         "18",
 			Status:     "PROCESSING",
 			UploadedAt: start,
-			Accrual:    sql.NullFloat64{Float64: 0, Valid: false},
+			Accrual:    money.NullAmount{},
 		},
 	}
 
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(orders, nil)
 
@@ -121,12 +140,12 @@ func (suite *GetOrdersTestSuite) TestInvalid() {
 			ID:         "18",
 			Status:     "INVALID",
 			UploadedAt: start,
-			Accrual:    sql.NullFloat64{Float64: 0, Valid: false},
+			Accrual:    money.NullAmount{},
 		},
 	}
 
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(orders, nil)
 
@@ -147,12 +166,12 @@ func (suite *GetOrdersTestSuite) TestProcessed() {
 			ID:         "18",
 			Status:     "PROCESSED",
 			UploadedAt: start,
-			Accrual:    sql.NullFloat64{Float64: 500.5, Valid: true},
+			Accrual:    money.NullAmount{Amount: 50050, Valid: true},
 		},
 	}
 
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(orders, nil)
 
@@ -173,18 +192,18 @@ func (suite *GetOrdersTestSuite) TestMany() {
 			ID:         "18",
 			Status:     "PROCESSED",
 			UploadedAt: start,
-			Accrual:    sql.NullFloat64{Float64: 81.4, Valid: true},
+			Accrual:    money.NullAmount{Amount: 8140, Valid: true},
 		},
 		{
 			ID:         "24",
 			Status:     "NEW",
 			UploadedAt: start.Add(5 * time.Second),
-			Accrual:    sql.NullFloat64{Float64: 0, Valid: false},
+			Accrual:    money.NullAmount{},
 		},
 	}
 
 	suite.db.EXPECT().
-		FindOrdersByUserID(gomock.Any(), gomock.Eq(1)).
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(orders, nil)
 
@@ -200,6 +219,105 @@ func (suite *GetOrdersTestSuite) TestMany() {
 	assert.JSONEq(suite.T(), expected, rr.Body.String())
 }
 
+func (suite *GetOrdersTestSuite) TestPage() {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	orders := []models.Order{
+		{ID: "18", Status: "NEW", UploadedAt: start},
+		{ID: "24", Status: "NEW", UploadedAt: start.Add(time.Second)},
+		{ID: "32", Status: "NEW", UploadedAt: start.Add(2 * time.Second)},
+	}
+	// хранилище просят на одну запись больше, чтобы узнать о следующей странице
+	suite.db.EXPECT().
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{
+			Limit:    3,
+			Statuses: []models.OrderStatus{models.StatusNew},
+		})).
+		Times(1).
+		Return(orders, nil)
+
+	rr := suite.makeListRequest("TestPage", "/api/user/orders?limit=2&status=new", "")
+	suite.Require().Equal(http.StatusOK, rr.Code)
+	suite.Equal("application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+	expected := fmt.Sprintf(
+		`[{"number":"18","status":"NEW","uploaded_at":"%v"},
+		{"number":"24","status":"NEW","uploaded_at":"%v"}]`,
+		start.Format(time.RFC3339),
+		start.Add(time.Second).Format(time.RFC3339),
+	)
+	assert.JSONEq(suite.T(), expected, rr.Body.String())
+
+	// ссылка на следующую страницу сохраняет фильтры
+	link := rr.Header().Get("Link")
+	suite.Require().Regexp(`^</api/user/orders\?(.+)>; rel="next"$`, link)
+	next, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	suite.Require().NoError(err)
+	suite.Equal("2", next.Query().Get("limit"))
+	suite.Equal("new", next.Query().Get("status"))
+
+	suite.db.EXPECT().
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{
+			Limit:    3,
+			After:    &models.Cursor{At: start.Add(time.Second), Order: "24"},
+			Statuses: []models.OrderStatus{models.StatusNew},
+		})).
+		Times(1).
+		Return(orders[2:], nil)
+
+	rr = suite.makeListRequest("TestPage", next.RequestURI(), "")
+	suite.Require().Equal(http.StatusOK, rr.Code)
+	suite.Empty(rr.Header().Get("Link"))
+}
+
+func (suite *GetOrdersTestSuite) TestPageEnvelope() {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	from := start.Add(-time.Hour)
+	orders := []models.Order{
+		{ID: "18", Status: "PROCESSED", UploadedAt: start},
+		{ID: "24", Status: "INVALID", UploadedAt: start.Add(time.Second)},
+	}
+	suite.db.EXPECT().
+		FindOrdersByUserID(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{
+			Limit:    2,
+			Statuses: []models.OrderStatus{models.StatusProcessed, models.StatusInvalid},
+			From:     from,
+		})).
+		Times(1).
+		Return(orders, nil)
+
+	rr := suite.makeListRequest(
+		"TestPageEnvelope",
+		"/api/user/orders?limit=1&status=PROCESSED,INVALID&from="+url.QueryEscape(from.Format(time.RFC3339)),
+		PageContentType,
+	)
+	suite.Require().Equal(http.StatusOK, rr.Code)
+	suite.Equal(PageContentType, rr.Header().Get("Content-Type"))
+	suite.Empty(rr.Header().Get("Link"))
+	var body struct {
+		Items      []map[string]any `json:"items"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	suite.Require().NoError(json.Unmarshal(rr.Body.Bytes(), &body))
+	suite.Require().Len(body.Items, 1)
+	suite.Equal("18", body.Items[0]["number"])
+	after, err := decodeCursor(body.NextCursor)
+	suite.Require().NoError(err)
+	suite.Equal(models.Cursor{At: start, Order: "18"}, *after)
+}
+
+func (suite *GetOrdersTestSuite) TestBadQuery() {
+	for _, query := range []string{
+		"limit=0",
+		"limit=abc",
+		"cursor=not-a-cursor",
+		"status=UNKNOWN",
+		"from=yesterday",
+		"to=2023-01-02",
+	} {
+		rr := suite.makeListRequest("TestBadQuery", "/api/user/orders?"+query, "")
+		suite.Equal(http.StatusBadRequest, rr.Code, query)
+	}
+}
+
 func TestGetOrdersTestSuite(t *testing.T) {
 	suite.Run(t, new(GetOrdersTestSuite))
 }
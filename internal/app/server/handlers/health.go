@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+)
+
+// AccrualHealth - источник состояния клиента системы расчета
+type AccrualHealth interface {
+	Health() accrual.Health
+}
+
+type healthResponse struct {
+	Status  string         `json:"status"`
+	Accrual accrual.Health `json:"accrual"`
+}
+
+type Health struct {
+	accrual AccrualHealth
+}
+
+// Handler отвечает 200, пока система расчета доступна, и 503, если
+// выключатель разомкнут: заказы в это время не обрабатываются
+func (h *Health) Handler(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "ok", Accrual: h.accrual.Health()}
+	code := http.StatusOK
+	if resp.Accrual.Circuit == accrual.StateOpen.String() {
+		resp.Status = "degraded"
+		code = http.StatusServiceUnavailable
+	}
+	respEncoded, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(respEncoded)
+}
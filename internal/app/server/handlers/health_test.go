@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAccrualHealth accrual.Health
+
+func (f fakeAccrualHealth) Health() accrual.Health {
+	return accrual.Health(f)
+}
+
+func TestHealth(t *testing.T) {
+	tests := []struct {
+		circuit string
+		code    int
+		status  string
+	}{
+		{"closed", http.StatusOK, "ok"},
+		{"half-open", http.StatusOK, "ok"},
+		{"open", http.StatusServiceUnavailable, "degraded"},
+	}
+	for _, tt := range tests {
+		h := Health{accrual: fakeAccrualHealth{Circuit: tt.circuit}}
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+		h.Handler(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.circuit)
+		assert.Contains(t, rr.Body.String(), `"status":"`+tt.status+`"`)
+		assert.Contains(t, rr.Body.String(), `"circuit":"`+tt.circuit+`"`)
+	}
+}
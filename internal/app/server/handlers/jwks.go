@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+)
+
+// JWKS публикует открытые ключи, которыми другие сервисы проверяют наши
+// токены без общего секрета
+type JWKS struct {
+	keys *auth.KeyRing
+	// сколько клиенты могут кэшировать ответ
+	maxAge time.Duration
+}
+
+func (h *JWKS) Handler(w http.ResponseWriter, r *http.Request) {
+	set, err := h.keys.PublicKeys()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	encoded, err := json.Marshal(set)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.maxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	w.Write(encoded)
+}
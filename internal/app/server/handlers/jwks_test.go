@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKS(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := auth.NewKey("k1", private, time.Time{})
+	require.NoError(t, err)
+	keys, err := auth.NewKeyRing(time.Hour, key)
+	require.NoError(t, err)
+	handler := JWKS{keys: keys, maxAge: time.Minute}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	handler.Handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/jwk-set+json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", rr.Header().Get("Cache-Control"))
+
+	var jwks struct {
+		Keys []struct {
+			KeyID     string `json:"kid"`
+			Algorithm string `json:"alg"`
+			X         string `json:"x"`
+			D         string `json:"d"`
+		} `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "k1", jwks.Keys[0].KeyID)
+	assert.Equal(t, auth.AlgEdDSA, jwks.Keys[0].Algorithm)
+	assert.NotEmpty(t, jwks.Keys[0].X)
+	assert.Empty(t, jwks.Keys[0].D)
+
+	// общий секрет не публикуется
+	handler.keys = testKeys
+	rr = httptest.NewRecorder()
+	handler.Handler(rr, req)
+	assert.JSONEq(t, `{"keys": []}`, rr.Body.String())
+}
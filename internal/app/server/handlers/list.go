@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+// PageContentType - ответ-конверт со списком и курсором следующей страницы.
+// Клиент запрашивает его заголовком Accept; по умолчанию список отдается
+// массивом, как требует спецификация, а следующая страница - в заголовке Link
+const PageContentType = "application/vnd.gophermart.page+json"
+
+// больше этого за один запрос не отдаем, даже если клиент просит
+const maxListLimit = 1000
+
+// cursor - содержимое непрозрачного курсора; клиент получает его в base64
+type cursor struct {
+	At    int64  `json:"t"`
+	Order string `json:"o"`
+	ID    int64  `json:"i,omitempty"`
+}
+
+func encodeCursor(c models.Cursor) string {
+	data, _ := json.Marshal(cursor{At: c.At.UnixNano(), Order: c.Order, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*models.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Order == "" {
+		return nil, ErrBadCursor
+	}
+	return &models.Cursor{At: time.Unix(0, c.At).UTC(), Order: c.Order, ID: c.ID}, nil
+}
+
+// parseListQuery разбирает параметры списка:
+//
+//	limit   размер страницы; без него отдается весь список
+//	cursor  курсор следующей страницы из предыдущего ответа
+//	status  статусы заказов через запятую или несколькими параметрами
+//	from    RFC3339, записи не раньше этого момента
+//	to      RFC3339, записи строго раньше этого момента
+//
+// Статус разрешен, только если withStatus
+func parseListQuery(r *http.Request, withStatus bool) (models.ListQuery, error) {
+	var query models.ListQuery
+	values := r.URL.Query()
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("%w: limit=%v", ErrIncorrectRequest, s)
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+		query.Limit = limit
+	}
+	if s := values.Get("cursor"); s != "" {
+		after, err := decodeCursor(s)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+	for _, v := range values["status"] {
+		if !withStatus {
+			return query, fmt.Errorf("%w: status filter is not supported", ErrIncorrectRequest)
+		}
+		for _, s := range strings.Split(v, ",") {
+			status, err := models.ParseOrderStatus(strings.ToUpper(strings.TrimSpace(s)))
+			if err != nil {
+				return query, fmt.Errorf("%w: %v", ErrIncorrectRequest, err)
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+	var err error
+	if query.From, err = parseTime(values.Get("from")); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTime(values.Get("to")); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrIncorrectRequest, err)
+	}
+	return t, nil
+}
+
+// fetchQuery просит у хранилища на одну запись больше страницы: по ней
+// видно, есть ли следующая
+func fetchQuery(query models.ListQuery) models.ListQuery {
+	if query.Limit > 0 {
+		query.Limit++
+	}
+	return query
+}
+
+// page - ответ-конверт
+type page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// writeList отдает страницу списка, полученного с fetchQuery(query). Курсор
+// следующей страницы строится по последней отданной записи
+func writeList[T any](
+	w http.ResponseWriter,
+	r *http.Request,
+	items []T,
+	query models.ListQuery,
+	cursorOf func(item *T) models.Cursor,
+) {
+	var next string
+	if query.Limit > 0 && len(items) > query.Limit {
+		items = items[:query.Limit]
+		next = encodeCursor(cursorOf(&items[len(items)-1]))
+	}
+	var body any = items
+	contentType := "application/json; charset=utf-8"
+	if strings.Contains(r.Header.Get("Accept"), PageContentType) {
+		body = page[T]{Items: items, NextCursor: next}
+		contentType = PageContentType
+	} else if next != "" {
+		u := *r.URL
+		values := u.Query()
+		values.Set("cursor", next)
+		u.RawQuery = values.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%v>; rel="next"`, u.RequestURI()))
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	w.Write(encoded)
+}
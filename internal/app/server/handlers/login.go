@@ -1,16 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
 
 	"github.com/blokhinnv/gophermart/internal/app/auth"
 	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
 )
 
 type Login struct {
 	LogReg
+	throttle *auth.LoginThrottle
 }
 
 func (h *Login) Handler(w http.ResponseWriter, r *http.Request) {
@@ -22,34 +28,107 @@ func (h *Login) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), status)
 		return
 	}
+	ip := clientIP(r)
+	attempt := beginAttempt(w, h.throttle, "throttled", body.Login, ip)
+	if attempt == nil {
+		return
+	}
 
-	user, err := h.db.FindUser(ctx, body.Login, body.Password)
+	user, err := h.db.FindUser(ctx, body.Login)
 	if err != nil {
-		// если не нашли пользователя - не можем авторизоваться
+		// если не нашли пользователя - не можем авторизоваться. Ответ и
+		// время ответа те же, что при неверном пароле
 		if errors.Is(err, database.ErrUserNotFound) {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			h.hasher.VerifyDummy(body.Password)
+			attempt.Fail()
+			auditLogin("unknown user", body.Login, ip)
+			http.Error(w, ErrIncorrectCredentials.Error(), http.StatusUnauthorized)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		attempt.Abort()
+		internalError(w, err)
 		return
 	}
-	// если хэш предоставленного пароля не совпадает с тем, что лежит в БД -
-	// не можем авторизоваться
-	if hash := auth.GenerateHash(body.Password, user.Salt); hash != user.HashedPassword {
-		err := fmt.Errorf("%v: %v %v", ErrIncorrectCredentials, body.Login, body.Password)
-		http.Error(
-			w,
-			err.Error(),
-			http.StatusUnauthorized,
-		)
+	// если пароль не подходит к хэшу, который лежит в БД, - не можем
+	// авторизоваться
+	ok, rehash, err := h.hasher.Verify(body.Password, user.HashedPassword)
+	if err != nil {
+		attempt.Abort()
+		internalError(w, fmt.Errorf("password hash of user %v: %w", user.ID, err))
 		return
 	}
-	token := auth.GenerateJWTToken(user, h.signingKey, h.expireDuration)
-	tokenSign, err := token.SignedString(h.signingKey)
+	if !ok {
+		attempt.Fail()
+		auditLogin("wrong password", body.Login, ip)
+		http.Error(w, ErrIncorrectCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	attempt.Succeed()
+	// хэш старой схемы или с устаревшими параметрами заменяем, пока
+	// пароль известен; если не вышло - попробуем при следующем входе
+	if rehash {
+		h.upgradeHash(ctx, user, body.Password)
+	}
+	tokens, err := h.sessions.Start(ctx, user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, err)
 		return
 	}
-	w.Header().Set("Authorization", fmt.Sprintf("Bearer: %v", tokenSign))
-	w.WriteHeader(http.StatusOK)
+	writeTokens(w, tokens)
+}
+
+func (h *Login) upgradeHash(ctx context.Context, user *models.User, password string) {
+	hash, err := h.hasher.Hash(password)
+	if err == nil {
+		err = h.db.UpdatePasswordHash(ctx, user.ID, user.HashedPassword, hash)
+	}
+	if err != nil {
+		log.Printf("Error while rehashing password of user %v: %v", user.ID, err)
+		return
+	}
+	log.Printf("Rehashed password of user %v", user.ID)
+}
+
+// beginAttempt разрешает попытку по throttle. Если нельзя, отвечает 429 с
+// Retry-After (или 500) и возвращает nil
+func beginAttempt(
+	w http.ResponseWriter,
+	throttle *auth.LoginThrottle,
+	reason, login, ip string,
+) *auth.LoginAttempt {
+	attempt, err := throttle.Begin(login, ip)
+	if err != nil {
+		var tooMany *auth.TooManyAttemptsError
+		if errors.As(err, &tooMany) {
+			auditLogin(reason, login, ip)
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+			http.Error(w, auth.ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+			return nil
+		}
+		internalError(w, err)
+		return nil
+	}
+	return attempt
+}
+
+// auditLogin записывает неудачный вход. Пароль сюда не попадает, логин
+// экранируется, чтобы им нельзя было подделать строки журнала
+func auditLogin(reason, login, ip string) {
+	log.Printf("audit: login failed: reason=%q login=%q ip=%q", reason, login, ip)
+}
+
+// clientIP - адрес клиента без порта. X-Forwarded-For не учитывается: его
+// может подставить сам клиент
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// internalError пишет подробности в журнал, а клиенту отдает только статус
+func internalError(w http.ResponseWriter, err error) {
+	log.Printf("Internal error: %v", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
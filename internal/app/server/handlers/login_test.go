@@ -2,6 +2,11 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -44,10 +49,11 @@ func (suite *LoginTestSuite) SetupSuite() {
 	suite.db = database.NewMockService(suite.ctrl)
 	log := Login{
 		LogReg: LogReg{
-			db:             suite.db,
-			signingKey:     []byte("qwerty"),
-			expireDuration: 1 * time.Hour,
+			db:       suite.db,
+			hasher:   testHasher,
+			sessions: NewSessions(suite.db, testKeys, time.Minute, time.Hour),
 		},
+		throttle: auth.NewLoginThrottle(testThrottleConfig),
 	}
 	suite.handler = http.HandlerFunc(log.Handler)
 }
@@ -59,33 +65,141 @@ func (suite *LoginTestSuite) TearDownSuite() {
 func (suite *LoginTestSuite) TestOk() {
 	jsonStr := []byte(`{"login":"nikita", "password": "123"}`)
 	suite.db.EXPECT().
-		FindUser(gomock.Any(), gomock.Eq("nikita"), gomock.Eq("123")).
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
 		Times(1).
 		Return(&models.User{
 			ID:             1,
 			Username:       "nikita",
-			HashedPassword: auth.GenerateHash("123", "456"),
-			Salt:           "456",
+			HashedPassword: mustHash("123"),
 		}, nil)
+	expectSession(suite.db, 1)
 
 	rr := suite.makeRequest("TestOk", true, bytes.NewBuffer(jsonStr))
 	suite.Equal(http.StatusOK, rr.Code)
+	var tokens tokenResponse
+	suite.Require().NoError(json.Unmarshal(rr.Body.Bytes(), &tokens))
+	suite.NotEmpty(tokens.RefreshToken)
+	suite.Equal("Bearer: "+tokens.AccessToken, rr.Header().Get("Authorization"))
 }
 
 func (suite *LoginTestSuite) TestWrong() {
 	jsonStr := []byte(`{"login":"nikita", "password": "1234"}`)
 	suite.db.EXPECT().
-		FindUser(gomock.Any(), gomock.Eq("nikita"), gomock.Eq("1234")).
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
 		Times(1).
 		Return(&models.User{
 			ID:             1,
 			Username:       "nikita",
-			HashedPassword: auth.GenerateHash("123", "456"),
-			Salt:           "456",
+			HashedPassword: mustHash("123"),
 		}, nil)
 
 	resp1 := suite.makeRequest("TestWrong", true, bytes.NewBuffer(jsonStr))
 	suite.Equal(http.StatusUnauthorized, resp1.Code)
+	suite.NotContains(resp1.Body.String(), "1234")
+}
+
+// неизвестный логин неотличим от неверного пароля
+func (suite *LoginTestSuite) TestUnknownUser() {
+	jsonStr := []byte(`{"login":"nobody", "password": "1234"}`)
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nobody")).
+		Times(1).
+		Return(nil, fmt.Errorf("%w: nobody", database.ErrUserNotFound))
+
+	rr := suite.makeRequest("TestUnknownUser", true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+	suite.Equal(ErrIncorrectCredentials.Error()+"\n", rr.Body.String())
+}
+
+func (suite *LoginTestSuite) TestThrottled() {
+	login := Login{
+		LogReg: LogReg{db: suite.db, hasher: testHasher},
+		throttle: auth.NewLoginThrottle(auth.ThrottleConfig{
+			Login:           auth.AttemptLimits{Free: 2, Lockout: 10},
+			IP:              auth.AttemptLimits{Free: 100, Lockout: 100},
+			BaseDelay:       time.Minute,
+			MaxDelay:        time.Hour,
+			LockoutDuration: time.Hour,
+		}),
+	}
+	jsonStr := []byte(`{"login":"nikita", "password": "1234"}`)
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
+		Times(3).
+		Return(&models.User{ID: 1, Username: "nikita", HashedPassword: mustHash("123")}, nil)
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/user/login", bytes.NewBuffer(jsonStr))
+		req.Header.Set("Content-Type", "application/json")
+		login.Handler(rr, req)
+		suite.Equal(http.StatusUnauthorized, rr.Code)
+	}
+	// третья неудача сверх двух бесплатных - следующая попытка через минуту,
+	// даже с верным паролем и без обращения к БД
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(
+		http.MethodPost,
+		"/api/user/login",
+		bytes.NewBufferString(`{"login":"nikita", "password": "123"}`),
+	)
+	req.Header.Set("Content-Type", "application/json")
+	login.Handler(rr, req)
+	suite.Equal(http.StatusTooManyRequests, rr.Code)
+	suite.Equal("60", rr.Header().Get("Retry-After"))
+}
+
+// хэш старой схемы заменяется при входе, пока пароль известен
+func (suite *LoginTestSuite) TestLegacyHashUpgrade() {
+	pwdSum := md5.Sum([]byte("123"))
+	pwdSaltSum := md5.Sum(append(pwdSum[:], []byte("456")...))
+	legacy := "$md5$456$" + base64.StdEncoding.EncodeToString(pwdSaltSum[:])
+
+	jsonStr := []byte(`{"login":"nikita", "password": "123"}`)
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita", HashedPassword: legacy}, nil)
+	suite.db.EXPECT().
+		UpdatePasswordHash(gomock.Any(), gomock.Eq(1), gomock.Eq(legacy), passwordHashOf("123")).
+		Times(1).
+		Return(nil)
+	expectSession(suite.db, 1)
+
+	rr := suite.makeRequest("TestLegacyHashUpgrade", true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+// неудачная замена хэша не мешает войти
+func (suite *LoginTestSuite) TestRehashFailure() {
+	stale, err := auth.NewHasher(auth.Argon2id{Time: 1, Memory: 32, Threads: 1, KeyLen: 16}).Hash("123")
+	suite.Require().NoError(err)
+
+	jsonStr := []byte(`{"login":"nikita", "password": "123"}`)
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita", HashedPassword: stale}, nil)
+	suite.db.EXPECT().
+		UpdatePasswordHash(gomock.Any(), gomock.Eq(1), gomock.Eq(stale), passwordHashOf("123")).
+		Times(1).
+		Return(errors.New("connection reset"))
+	expectSession(suite.db, 1)
+
+	rr := suite.makeRequest("TestRehashFailure", true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+// пароль, который не подходит к хэшу старой схемы, хэш не меняет
+func (suite *LoginTestSuite) TestLegacyHashWrongPassword() {
+	jsonStr := []byte(`{"login":"nikita", "password": "1234"}`)
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita", HashedPassword: "$md5$456$AAAA"}, nil)
+
+	rr := suite.makeRequest("TestLegacyHashWrongPassword", true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusUnauthorized, rr.Code)
 }
 
 func (suite *LoginTestSuite) TestIncorrentBody() {
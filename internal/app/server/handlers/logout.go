@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+)
+
+// Logout закрывает сессию, к которой относится access-токен запроса: ни он,
+// ни refresh-токены сессии больше не принимаются
+type Logout struct {
+	db database.Service
+}
+
+func (h *Logout) Handler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token, err := GetTokenFromContext(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	err = h.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := h.db.RevokeSession(ctx, token.SessionID); err != nil {
+			return err
+		}
+		// отзыв сессии и так закрывает токен; jti сохраняем на случай,
+		// если запись о сессии удалят раньше, чем он истечет
+		return h.db.RevokeAccessToken(ctx, token.ID, time.Until(token.ExpiresAt))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Session %v closed", token.SessionID)
+	w.WriteHeader(http.StatusOK)
+}
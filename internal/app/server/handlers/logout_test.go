@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/suite"
+)
+
+// LogoutTestSuite проверяет выход вместе с CheckRevoked, как он стоит в
+// роутере
+type LogoutTestSuite struct {
+	AuthHandlerTestSuite
+}
+
+func (suite *LogoutTestSuite) SetupSuite() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.db = database.NewMockService(suite.ctrl)
+	logout := Logout{db: suite.db}
+	handler := CheckRevoked(suite.db)(http.HandlerFunc(logout.Handler))
+	suite.setupAuth(handler.ServeHTTP)
+}
+
+func (suite *LogoutTestSuite) TearDownSuite() {
+	suite.ctrl.Finish()
+}
+
+func (suite *LogoutTestSuite) makeRequest(testName string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/logout", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer: %v", suite.tokenSign))
+	suite.handler.ServeHTTP(rr, req)
+	log.Printf("[%v]: %v", testName, rr.Body.String())
+	return rr
+}
+
+func (suite *LogoutTestSuite) expectRevoked(revoked bool, err error) {
+	suite.db.EXPECT().
+		IsAccessTokenRevoked(gomock.Any(), gomock.Any(), gomock.Eq("session")).
+		Times(1).
+		Return(revoked, err)
+}
+
+func (suite *LogoutTestSuite) TestOk() {
+	suite.expectRevoked(false, nil)
+	suite.db.EXPECT().
+		WithinTransaction(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return fn(ctx)
+		})
+	suite.db.EXPECT().
+		RevokeSession(gomock.Any(), gomock.Eq("session")).
+		Times(1).
+		Return(nil)
+	// отзыв jti хранится, пока токен не истечет
+	ttl := gomock.AssignableToTypeOf(time.Duration(0))
+	suite.db.EXPECT().
+		RevokeAccessToken(gomock.Any(), gomock.Any(), ttl).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, jti string, ttl time.Duration) error {
+			suite.NotEmpty(jti)
+			suite.InDelta(time.Hour.Seconds(), ttl.Seconds(), 60)
+			return nil
+		})
+
+	rr := suite.makeRequest("TestOk")
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+func (suite *LogoutTestSuite) TestRevoked() {
+	suite.expectRevoked(true, nil)
+
+	rr := suite.makeRequest("TestRevoked")
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *LogoutTestSuite) TestCheckFailed() {
+	suite.expectRevoked(false, errors.New("connection reset"))
+
+	rr := suite.makeRequest("TestCheckFailed")
+	suite.Equal(http.StatusInternalServerError, rr.Code)
+}
+
+func TestLogoutTestSuite(t *testing.T) {
+	suite.Run(t, new(LogoutTestSuite))
+}
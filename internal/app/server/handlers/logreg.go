@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
 
+	"github.com/blokhinnv/gophermart/internal/app/auth"
 	"github.com/blokhinnv/gophermart/internal/app/database"
 )
 
@@ -17,9 +17,11 @@ type logRegRequestBody struct {
 const logRegBodyContentType = "application/json"
 
 type LogReg struct {
-	db             database.Service
-	signingKey     []byte
-	expireDuration time.Duration
+	db       database.Service
+	hasher   *auth.Hasher
+	sessions *Sessions
+	// проверяется только при регистрации: старые пароли продолжают работать
+	policy auth.PasswordPolicy
 }
 
 // чтение тела запроса с проверкой корректности
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+)
+
+type changePasswordRequestBody struct {
+	OldPassword string `json:"old_password" valid:"required"`
+	NewPassword string `json:"new_password" valid:"required"`
+}
+
+// ChangePassword меняет пароль по старому паролю. Остальные сессии
+// пользователя закрываются, текущая остается
+type ChangePassword struct {
+	db     database.Service
+	hasher *auth.Hasher
+	policy auth.PasswordPolicy
+	// общий с Login: подбирать старый пароль так же медленно, как при входе
+	throttle *auth.LoginThrottle
+}
+
+func (h *ChangePassword) Handler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bodyReader := func(bodyBytes []byte) (any, error) {
+		body := changePasswordRequestBody{}
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			return nil, fmt.Errorf(
+				"%w: incorrent body (error while unmarshaling)",
+				ErrIncorrectRequest,
+			)
+		}
+		return &body, nil
+	}
+	rawBody, err := ReadBodyWithBodyReader(r, logRegBodyContentType, bodyReader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := rawBody.(*changePasswordRequestBody)
+	token, err := GetTokenFromContext(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	userID, err := GetUserIDFromContext(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user, err := h.db.FindUserByID(ctx, userID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if err := h.policy.Check(user.Username, body.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	attempt := beginAttempt(w, h.throttle, "password change throttled", user.Username, ip)
+	if attempt == nil {
+		return
+	}
+	ok, _, err := h.hasher.Verify(body.OldPassword, user.HashedPassword)
+	if err != nil {
+		attempt.Abort()
+		internalError(w, fmt.Errorf("password hash of user %v: %w", user.ID, err))
+		return
+	}
+	if !ok {
+		attempt.Fail()
+		auditLogin("password change: wrong password", user.Username, ip)
+		http.Error(w, ErrIncorrectCredentials.Error(), http.StatusForbidden)
+		return
+	}
+	attempt.Succeed()
+
+	hash, err := h.hasher.Hash(body.NewPassword)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	err = h.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := h.db.SetPasswordHash(ctx, user.ID, hash); err != nil {
+			return err
+		}
+		return h.db.RevokeUserSessions(ctx, user.ID, token.SessionID)
+	})
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	log.Printf("Password of user %v changed", user.ID)
+	w.WriteHeader(http.StatusOK)
+}
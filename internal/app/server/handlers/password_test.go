@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChangePasswordTestSuite struct {
+	AuthHandlerTestSuite
+}
+
+func (suite *ChangePasswordTestSuite) SetupSuite() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.db = database.NewMockService(suite.ctrl)
+	h := ChangePassword{
+		db:       suite.db,
+		hasher:   testHasher,
+		policy:   auth.PasswordPolicy{MinLength: 6, ForbidLogin: true},
+		throttle: auth.NewLoginThrottle(testThrottleConfig),
+	}
+	suite.setupAuth(h.Handler)
+}
+
+func (suite *ChangePasswordTestSuite) TearDownSuite() {
+	suite.ctrl.Finish()
+}
+
+func (suite *ChangePasswordTestSuite) makeRequest(
+	testName string,
+	oldPassword, newPassword string,
+) *httptest.ResponseRecorder {
+	jsonStr := []byte(fmt.Sprintf(`{"old_password": %q, "new_password": %q}`, oldPassword, newPassword))
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/password", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer: %v", suite.tokenSign))
+	suite.handler.ServeHTTP(rr, req)
+	log.Printf("[%v]: %v", testName, rr.Body.String())
+	return rr
+}
+
+func (suite *ChangePasswordTestSuite) expectUser() {
+	suite.db.EXPECT().
+		FindUserByID(gomock.Any(), gomock.Eq(1)).
+		Times(1).
+		Return(&models.User{
+			ID:             1,
+			Username:       "nikita",
+			HashedPassword: mustHash("123456"),
+		}, nil)
+}
+
+func (suite *ChangePasswordTestSuite) TestOk() {
+	suite.expectUser()
+	suite.db.EXPECT().
+		WithinTransaction(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return fn(ctx)
+		})
+	suite.db.EXPECT().
+		SetPasswordHash(gomock.Any(), gomock.Eq(1), passwordHashOf("qwerty")).
+		Times(1).
+		Return(nil)
+	// текущая сессия остается
+	suite.db.EXPECT().
+		RevokeUserSessions(gomock.Any(), gomock.Eq(1), gomock.Eq("session")).
+		Times(1).
+		Return(nil)
+
+	rr := suite.makeRequest("TestOk", "123456", "qwerty")
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+func (suite *ChangePasswordTestSuite) TestWrongPassword() {
+	suite.expectUser()
+
+	rr := suite.makeRequest("TestWrongPassword", "654321", "qwerty")
+	suite.Equal(http.StatusForbidden, rr.Code)
+}
+
+func (suite *ChangePasswordTestSuite) TestWeakPassword() {
+	suite.expectUser()
+
+	rr := suite.makeRequest("TestWeakPassword", "123456", "Nikita")
+	suite.Equal(http.StatusBadRequest, rr.Code)
+	suite.Contains(rr.Body.String(), auth.ErrWeakPassword.Error())
+}
+
+func TestChangePasswordTestSuite(t *testing.T) {
+	suite.Run(t, new(ChangePasswordTestSuite))
+}
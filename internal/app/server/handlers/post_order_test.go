@@ -1,18 +1,14 @@
 package handlers
 
-// TODO: тесты для tracker + accrualSystem?
 import (
 	"bytes"
-	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
-	"github.com/blokhinnv/gophermart/internal/app/accrual"
 	"github.com/blokhinnv/gophermart/internal/app/database"
 	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
 	"github.com/golang/mock/gomock"
@@ -22,8 +18,7 @@ import (
 type PostOrderTestSuite struct {
 	suite.Suite
 	AuthHandlerTestSuite
-	accrualService *accrual.MockService
-	tracker        *ordertracker.MockTracker
+	tracker *ordertracker.MockTracker
 }
 
 func (suite *PostOrderTestSuite) SetupSuite() {
@@ -31,18 +26,11 @@ func (suite *PostOrderTestSuite) SetupSuite() {
 	suite.db = database.NewMockService(suite.ctrl)
 	suite.tracker = ordertracker.NewMockTracker(suite.ctrl)
 
-	suite.accrualService = accrual.NewMockService(suite.ctrl)
 	suite.db.EXPECT().
 		Tracker().
 		Return(suite.tracker)
 
-	postOrder := NewPostOrder(
-		suite.db,
-		2,
-		context.Background(),
-		suite.accrualService,
-		1*time.Second,
-	)
+	postOrder := NewPostOrder(suite.db)
 	handler := http.HandlerFunc(postOrder.Handler)
 	suite.setupAuth(handler)
 }
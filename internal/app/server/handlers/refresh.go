@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+)
+
+type refreshRequestBody struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов
+type Refresh struct {
+	sessions *Sessions
+}
+
+func (h *Refresh) Handler(w http.ResponseWriter, r *http.Request) {
+	bodyReader := func(bodyBytes []byte) (any, error) {
+		body := refreshRequestBody{}
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			return nil, fmt.Errorf(
+				"%w: incorrent body (error while unmarshaling)",
+				ErrIncorrectRequest,
+			)
+		}
+		return &body, nil
+	}
+	body, err := ReadBodyWithBodyReader(r, logRegBodyContentType, bodyReader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tokens, err := h.sessions.Refresh(r.Context(), body.(*refreshRequestBody).RefreshToken)
+	if err != nil {
+		// причину отказа клиенту не раскрываем: неизвестный, истекший,
+		// отозванный и повторно использованный токен для него одинаковы
+		if errors.Is(err, database.ErrTokenNotFound) ||
+			errors.Is(err, database.ErrTokenRevoked) ||
+			errors.Is(err, database.ErrTokenReused) {
+			log.Printf("Refresh rejected: %v", err)
+			http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeTokens(w, tokens)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/suite"
+)
+
+type RefreshTestSuite struct {
+	suite.Suite
+	db      *database.MockService
+	handler http.HandlerFunc
+	ctrl    *gomock.Controller
+}
+
+func (suite *RefreshTestSuite) SetupSuite() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.db = database.NewMockService(suite.ctrl)
+	refresh := Refresh{
+		sessions: NewSessions(suite.db, testKeys, time.Minute, time.Hour),
+	}
+	suite.handler = http.HandlerFunc(refresh.Handler)
+}
+
+func (suite *RefreshTestSuite) TearDownSuite() {
+	suite.ctrl.Finish()
+}
+
+func (suite *RefreshTestSuite) makeRequest(testName string, body io.Reader) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/token/refresh", body)
+	req.Header.Set("Content-Type", "application/json")
+	suite.handler.ServeHTTP(rr, req)
+	log.Printf("[%v]: %v", testName, rr.Body.String())
+	return rr
+}
+
+func (suite *RefreshTestSuite) TestOk() {
+	jsonStr := []byte(`{"refresh_token": "old"}`)
+	suite.db.EXPECT().
+		RotateRefreshToken(gomock.Any(), gomock.Eq(auth.HashOpaqueToken("old")), gomock.Any(), gomock.Eq(time.Hour)).
+		Times(1).
+		Return(&models.Session{ID: "session", UserID: 1, Username: "nikita"}, nil)
+
+	rr := suite.makeRequest("TestOk", bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusOK, rr.Code)
+	var tokens tokenResponse
+	suite.Require().NoError(json.Unmarshal(rr.Body.Bytes(), &tokens))
+	suite.NotEmpty(tokens.AccessToken)
+	suite.NotEqual("old", tokens.RefreshToken)
+	suite.Equal(int64(60), tokens.ExpiresIn)
+}
+
+// клиент не узнает, почему токен не подошел
+func (suite *RefreshTestSuite) TestRejected() {
+	for _, err := range []error{
+		database.ErrTokenNotFound,
+		fmt.Errorf("%w: session 1", database.ErrTokenRevoked),
+		fmt.Errorf("%w: session 1", database.ErrTokenReused),
+	} {
+		jsonStr := []byte(`{"refresh_token": "old"}`)
+		suite.db.EXPECT().
+			RotateRefreshToken(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(nil, err)
+
+		rr := suite.makeRequest("TestRejected", bytes.NewBuffer(jsonStr))
+		suite.Equal(http.StatusUnauthorized, rr.Code)
+		suite.Equal(ErrInvalidToken.Error()+"\n", rr.Body.String())
+	}
+}
+
+func (suite *RefreshTestSuite) TestNoToken() {
+	rr := suite.makeRequest("TestNoToken", bytes.NewBufferString(`{}`))
+	suite.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func TestRefreshTestSuite(t *testing.T) {
+	suite.Run(t, new(RefreshTestSuite))
+}
@@ -2,10 +2,8 @@ package handlers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 
-	"github.com/blokhinnv/gophermart/internal/app/auth"
 	"github.com/blokhinnv/gophermart/internal/app/database"
 )
 
@@ -22,7 +20,16 @@ func (h *Register) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), status)
 		return
 	}
-	user, err := h.db.AddUser(ctx, body.Login, body.Password)
+	if err := h.policy.Check(body.Login, body.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := h.hasher.Hash(body.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := h.db.AddUser(ctx, body.Login, hash)
 	if err != nil {
 		if errors.Is(err, database.ErrUserAlreadyExists) {
 			http.Error(w, err.Error(), http.StatusConflict)
@@ -31,12 +38,10 @@ func (h *Register) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	token := auth.GenerateJWTToken(user, h.signingKey, h.expireDuration)
-	tokenSign, err := token.SignedString(h.signingKey)
+	tokens, err := h.sessions.Start(ctx, user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Authorization", fmt.Sprintf("Bearer: %v", tokenSign))
-	w.WriteHeader(http.StatusOK)
+	writeTokens(w, tokens)
 }
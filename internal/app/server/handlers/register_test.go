@@ -45,9 +45,9 @@ func (suite *RegisterTestSuite) SetupSuite() {
 
 	reg := Register{
 		LogReg: LogReg{
-			db:             suite.db,
-			signingKey:     []byte("qwerty"),
-			expireDuration: 1 * time.Hour,
+			db:       suite.db,
+			hasher:   testHasher,
+			sessions: NewSessions(suite.db, testKeys, time.Minute, time.Hour),
 		},
 	}
 	suite.handler = http.HandlerFunc(reg.Handler)
@@ -60,14 +60,14 @@ func (suite *RegisterTestSuite) TearDownSuite() {
 func (suite *RegisterTestSuite) TestSingle() {
 	jsonStr := []byte(`{"login":"nikita", "password": "123"}`)
 	suite.db.EXPECT().
-		AddUser(gomock.Any(), gomock.Eq("nikita"), gomock.Eq("123")).
+		AddUser(gomock.Any(), gomock.Eq("nikita"), passwordHashOf("123")).
 		Times(1).
 		Return(&models.User{
 			ID:             1,
 			Username:       "nikita",
-			HashedPassword: auth.GenerateHash("123", "456"),
-			Salt:           "456",
+			HashedPassword: mustHash("123"),
 		}, nil)
+	expectSession(suite.db, 1)
 
 	rr := suite.makeRequest("TestSingle", true, bytes.NewBuffer(jsonStr))
 	suite.Equal(http.StatusOK, rr.Code)
@@ -76,18 +76,18 @@ func (suite *RegisterTestSuite) TestSingle() {
 func (suite *RegisterTestSuite) TestAlreadyExisted() {
 	jsonStr := []byte(`{"login":"nikita", "password": "123"}`)
 	suite.db.EXPECT().
-		AddUser(gomock.Any(), gomock.Eq("nikita"), gomock.Eq("123")).
+		AddUser(gomock.Any(), gomock.Eq("nikita"), passwordHashOf("123")).
 		Times(1).
 		Return(&models.User{
 			ID:             1,
 			Username:       "nikita",
-			HashedPassword: auth.GenerateHash("123", "456"),
-			Salt:           "456",
+			HashedPassword: mustHash("123"),
 		}, nil)
+	expectSession(suite.db, 1)
 	resp1 := suite.makeRequest("TestAlreadyExisted", true, bytes.NewBuffer(jsonStr))
 	suite.Equal(http.StatusOK, resp1.Code)
 	suite.db.EXPECT().
-		AddUser(gomock.Any(), gomock.Eq("nikita"), gomock.Eq("123")).
+		AddUser(gomock.Any(), gomock.Eq("nikita"), passwordHashOf("123")).
 		Times(1).
 		Return(nil, fmt.Errorf("%w: %v", database.ErrUserAlreadyExists, "nikita"))
 	resp2 := suite.makeRequest("TestAlreadyExisted", true, bytes.NewBuffer(jsonStr))
@@ -107,6 +107,26 @@ func (suite *RegisterTestSuite) TestNoContentType() {
 
 }
 
+func (suite *RegisterTestSuite) TestWeakPassword() {
+	reg := Register{
+		LogReg: LogReg{
+			db:       suite.db,
+			hasher:   testHasher,
+			sessions: NewSessions(suite.db, testKeys, time.Minute, time.Hour),
+			policy:   auth.PasswordPolicy{MinLength: 6, ForbidLogin: true},
+		},
+	}
+	// пользователь не создается: AddUser не ожидается
+	for _, password := range []string{"123", "NiKiTa"} {
+		jsonStr := []byte(fmt.Sprintf(`{"login":"nikita", "password": %q}`, password))
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/user/register", bytes.NewBuffer(jsonStr))
+		req.Header.Set("Content-Type", "application/json")
+		reg.Handler(rr, req)
+		suite.Equal(http.StatusBadRequest, rr.Code, password)
+	}
+}
+
 func TestRegisterTestSuite(t *testing.T) {
 	suite.Run(t, new(RegisterTestSuite))
 }
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/notify"
+)
+
+type resetRequestBody struct {
+	Login string `json:"login" valid:"required"`
+}
+
+type resetConfirmRequestBody struct {
+	Token       string `json:"token"        valid:"required"`
+	NewPassword string `json:"new_password" valid:"required"`
+}
+
+// PasswordReset выдает одноразовые токены сброса пароля и меняет пароль по
+// ним. Токен доставляется через notifier, в БД хранится только его хэш
+type PasswordReset struct {
+	db       database.Service
+	hasher   *auth.Hasher
+	policy   auth.PasswordPolicy
+	notifier notify.Notifier
+	ttl      time.Duration
+	// отдельный от входа: запросы сброса для чужого логина не должны
+	// блокировать его владельцу вход
+	throttle *auth.LoginThrottle
+	// запускает отправку токена после ответа; nil - в отдельной горутине
+	background func(task func())
+}
+
+// RequestHandler отправляет пользователю токен сброса. Ответ и время ответа
+// не зависят от того, есть ли такой пользователь: иначе по нему можно было бы
+// перебирать логины. Поэтому пользователь ищется и токен отправляется уже
+// после ответа
+func (h *PasswordReset) RequestHandler(w http.ResponseWriter, r *http.Request) {
+	bodyReader := func(bodyBytes []byte) (any, error) {
+		body := resetRequestBody{}
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			return nil, fmt.Errorf(
+				"%w: incorrent body (error while unmarshaling)",
+				ErrIncorrectRequest,
+			)
+		}
+		return &body, nil
+	}
+	rawBody, err := ReadBodyWithBodyReader(r, logRegBodyContentType, bodyReader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := rawBody.(*resetRequestBody)
+	ip := clientIP(r)
+	// каждый запрос учитывается как неудачная попытка: новый токен отменяет
+	// предыдущий, и без ограничения можно было бы не давать владельцу
+	// сбросить пароль и заваливать его уведомлениями
+	attempt := beginAttempt(w, h.throttle, "password reset throttled", body.Login, ip)
+	if attempt == nil {
+		return
+	}
+	attempt.Fail()
+
+	h.runBackground(func() {
+		// запрос к этому моменту уже может быть завершен
+		ctx, cancel := context.WithTimeout(context.Background(), resetSendTimeout)
+		defer cancel()
+		if err := h.sendToken(ctx, body.Login, ip); err != nil {
+			log.Printf("Error while sending password reset token: %v", err)
+		}
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *PasswordReset) runBackground(task func()) {
+	if h.background != nil {
+		h.background(task)
+		return
+	}
+	go task()
+}
+
+// сколько ждать хранилище и notifier при отправке токена
+const resetSendTimeout = 30 * time.Second
+
+func (h *PasswordReset) sendToken(ctx context.Context, login, ip string) error {
+	user, err := h.db.FindUser(ctx, login)
+	if errors.Is(err, database.ErrUserNotFound) {
+		auditLogin("password reset: unknown user", login, ip)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(h.ttl)
+	if err := h.db.CreateResetToken(ctx, user.ID, hash, h.ttl); err != nil {
+		return fmt.Errorf("user %v: %w", user.ID, err)
+	}
+	err = h.notifier.Notify(ctx, notify.Notification{
+		Kind:      notify.KindPasswordReset,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("user %v: %w", user.ID, err)
+	}
+	return nil
+}
+
+// ConfirmHandler меняет пароль по токену сброса и закрывает все сессии
+// пользователя
+func (h *PasswordReset) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bodyReader := func(bodyBytes []byte) (any, error) {
+		body := resetConfirmRequestBody{}
+		if err := json.Unmarshal(bodyBytes, &body); err != nil {
+			return nil, fmt.Errorf(
+				"%w: incorrent body (error while unmarshaling)",
+				ErrIncorrectRequest,
+			)
+		}
+		return &body, nil
+	}
+	rawBody, err := ReadBodyWithBodyReader(r, logRegBodyContentType, bodyReader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body := rawBody.(*resetConfirmRequestBody)
+	// логин станет известен только по токену; остальное проверяем до
+	// дорогого хэширования
+	if err := h.policy.Check("", body.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := h.hasher.Hash(body.NewPassword)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	var userID int
+	err = h.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		userID, err = h.db.ConsumeResetToken(ctx, auth.HashOpaqueToken(body.Token))
+		if err != nil {
+			return err
+		}
+		user, err := h.db.FindUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		// с неподходящим паролем токен не гасится: транзакция откатится
+		if err := h.policy.Check(user.Username, body.NewPassword); err != nil {
+			return err
+		}
+		if err := h.db.SetPasswordHash(ctx, userID, hash); err != nil {
+			return err
+		}
+		return h.db.RevokeUserSessions(ctx, userID, "")
+	})
+	switch {
+	case errors.Is(err, database.ErrTokenNotFound):
+		log.Printf("Password reset rejected: %v", err)
+		http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrWeakPassword):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		internalError(w, err)
+		return
+	}
+	log.Printf("Password of user %v reset", userID)
+	w.WriteHeader(http.StatusOK)
+}
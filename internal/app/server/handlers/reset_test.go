@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/notify"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/suite"
+)
+
+// notifications запоминает отправленные уведомления
+type notifications []notify.Notification
+
+func (n *notifications) Notify(ctx context.Context, notification notify.Notification) error {
+	*n = append(*n, notification)
+	return nil
+}
+
+type PasswordResetTestSuite struct {
+	suite.Suite
+	db       *database.MockService
+	ctrl     *gomock.Controller
+	sent     notifications
+	handlers PasswordReset
+}
+
+func (suite *PasswordResetTestSuite) SetupSuite() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.db = database.NewMockService(suite.ctrl)
+	suite.handlers = PasswordReset{
+		db:       suite.db,
+		hasher:   testHasher,
+		policy:   auth.PasswordPolicy{MinLength: 6, ForbidLogin: true},
+		notifier: &suite.sent,
+		ttl:      time.Hour,
+		throttle: auth.NewLoginThrottle(testThrottleConfig),
+		// проверяем отправку сразу после ответа
+		background: runNow,
+	}
+}
+
+func runNow(task func()) {
+	task()
+}
+
+func (suite *PasswordResetTestSuite) SetupTest() {
+	suite.sent = nil
+}
+
+func (suite *PasswordResetTestSuite) TearDownSuite() {
+	suite.ctrl.Finish()
+}
+
+func (suite *PasswordResetTestSuite) makeRequest(
+	testName string,
+	handler http.HandlerFunc,
+	body string,
+) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/user/password/reset", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(rr, req)
+	log.Printf("[%v]: %v", testName, rr.Body.String())
+	return rr
+}
+
+func (suite *PasswordResetTestSuite) expectTransaction() {
+	suite.db.EXPECT().
+		WithinTransaction(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return fn(ctx)
+		})
+}
+
+func (suite *PasswordResetTestSuite) TestRequest() {
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nikita")).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita"}, nil)
+	var stored string
+	suite.db.EXPECT().
+		CreateResetToken(gomock.Any(), gomock.Eq(1), gomock.Any(), gomock.Eq(time.Hour)).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, userID int, hash string, ttl time.Duration) error {
+			stored = hash
+			return nil
+		})
+
+	rr := suite.makeRequest("TestRequest", suite.handlers.RequestHandler, `{"login": "nikita"}`)
+	suite.Equal(http.StatusAccepted, rr.Code)
+	suite.Require().Len(suite.sent, 1)
+	n := suite.sent[0]
+	suite.Equal(notify.KindPasswordReset, n.Kind)
+	suite.Equal(1, n.UserID)
+	// в БД только хэш, сам токен уходит пользователю
+	suite.NotEqual(stored, n.Token)
+	suite.Equal(stored, auth.HashOpaqueToken(n.Token))
+	suite.NotContains(rr.Body.String(), n.Token)
+}
+
+// ответ для неизвестного логина тот же, что для существующего
+func (suite *PasswordResetTestSuite) TestRequestUnknownUser() {
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("nobody")).
+		Times(1).
+		Return(nil, fmt.Errorf("%w: %v", database.ErrUserNotFound, "nobody"))
+
+	rr := suite.makeRequest("TestRequestUnknownUser", suite.handlers.RequestHandler, `{"login": "nobody"}`)
+	suite.Equal(http.StatusAccepted, rr.Code)
+	suite.Empty(suite.sent)
+}
+
+// каждый запрос сброса - попытка: чужой сброс нельзя отменять бесконечно
+func (suite *PasswordResetTestSuite) TestRequestThrottled() {
+	h := &PasswordReset{
+		db:       suite.db,
+		notifier: &suite.sent,
+		ttl:      time.Hour,
+		throttle: auth.NewLoginThrottle(auth.ThrottleConfig{
+			Login:           auth.AttemptLimits{Free: 1},
+			IP:              auth.AttemptLimits{Free: 1000},
+			BaseDelay:       time.Minute,
+			MaxDelay:        time.Minute,
+			LockoutDuration: time.Hour,
+		}),
+		background: runNow,
+	}
+	suite.db.EXPECT().
+		FindUser(gomock.Any(), gomock.Eq("victim")).
+		Times(2).
+		Return(nil, fmt.Errorf("%w: %v", database.ErrUserNotFound, "victim"))
+
+	rr := suite.makeRequest("TestRequestThrottled", h.RequestHandler, `{"login": "victim"}`)
+	suite.Equal(http.StatusAccepted, rr.Code)
+	rr = suite.makeRequest("TestRequestThrottled", h.RequestHandler, `{"login": "victim"}`)
+	suite.Equal(http.StatusAccepted, rr.Code)
+	rr = suite.makeRequest("TestRequestThrottled", h.RequestHandler, `{"login": "victim"}`)
+	suite.Equal(http.StatusTooManyRequests, rr.Code)
+	suite.NotEmpty(rr.Header().Get("Retry-After"))
+}
+
+func (suite *PasswordResetTestSuite) TestConfirm() {
+	token, hash, err := auth.NewOpaqueToken()
+	suite.Require().NoError(err)
+	suite.expectTransaction()
+	suite.db.EXPECT().
+		ConsumeResetToken(gomock.Any(), gomock.Eq(hash)).
+		Times(1).
+		Return(1, nil)
+	suite.db.EXPECT().
+		FindUserByID(gomock.Any(), gomock.Eq(1)).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita"}, nil)
+	suite.db.EXPECT().
+		SetPasswordHash(gomock.Any(), gomock.Eq(1), passwordHashOf("qwerty")).
+		Times(1).
+		Return(nil)
+	// после сброса закрываются все сессии
+	suite.db.EXPECT().
+		RevokeUserSessions(gomock.Any(), gomock.Eq(1), gomock.Eq("")).
+		Times(1).
+		Return(nil)
+
+	body := fmt.Sprintf(`{"token": %q, "new_password": "qwerty"}`, token)
+	rr := suite.makeRequest("TestConfirm", suite.handlers.ConfirmHandler, body)
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+func (suite *PasswordResetTestSuite) TestConfirmInvalidToken() {
+	suite.expectTransaction()
+	suite.db.EXPECT().
+		ConsumeResetToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(0, database.ErrTokenNotFound)
+
+	body := `{"token": "used", "new_password": "qwerty"}`
+	rr := suite.makeRequest("TestConfirmInvalidToken", suite.handlers.ConfirmHandler, body)
+	suite.Equal(http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *PasswordResetTestSuite) TestConfirmWeakPassword() {
+	suite.expectTransaction()
+	suite.db.EXPECT().
+		ConsumeResetToken(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(1, nil)
+	suite.db.EXPECT().
+		FindUserByID(gomock.Any(), gomock.Eq(1)).
+		Times(1).
+		Return(&models.User{ID: 1, Username: "nikita"}, nil)
+
+	body := `{"token": "token", "new_password": "NIKITA"}`
+	rr := suite.makeRequest("TestConfirmWeakPassword", suite.handlers.ConfirmHandler, body)
+	suite.Equal(http.StatusBadRequest, rr.Code)
+}
+
+func TestPasswordResetTestSuite(t *testing.T) {
+	suite.Run(t, new(PasswordResetTestSuite))
+}
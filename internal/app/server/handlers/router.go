@@ -1,11 +1,9 @@
 package handlers
 
 import (
-	"context"
-	"log"
-
-	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/auth"
 	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/notify"
 	"github.com/blokhinnv/gophermart/internal/app/server/config"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -16,64 +14,127 @@ type Router struct {
 	*chi.Mux
 	reg         *Register
 	login       *Login
+	refresh     *Refresh
+	logout      *Logout
 	postOrder   *PostOrder
 	getOrder    *GetOrder
 	balance     *Balance
 	withdraw    *Withdraw
 	withdrawals *Withdrawals
+	health      *Health
+	jwks        *JWKS
+	callback    *AccrualCallback
+	password    *ChangePassword
+	reset       *PasswordReset
 }
 
-func (r *Router) Shutdown() {
-	log.Println("Shutting down Router...")
-	// хочу убедиться, что все горутины этого хендлера завершились,
-	// прежде чем двигаться дальше
-	r.postOrder.WaitDone()
-}
-
-func NewRouter(db database.Service, cfg *config.Config, serverCtx context.Context) Router {
+func NewRouter(
+	db database.Service,
+	cfg *config.Config,
+	accrualHealth AccrualHealth,
+	updater OrderUpdater,
+	hasher *auth.Hasher,
+	keys *auth.KeyRing,
+	notifier notify.Notifier,
+) Router {
 	rt := Router{
 		Mux: chi.NewRouter(),
 	}
+	sessions := NewSessions(
+		db,
+		keys,
+		cfg.JWTExpireDuration,
+		cfg.JWTRefreshExpireDuration,
+	)
+	throttleConfig := auth.ThrottleConfig{
+		Login: auth.AttemptLimits{
+			Free:    cfg.LoginFreeAttempts,
+			Lockout: cfg.LoginLockoutThreshold,
+		},
+		IP: auth.AttemptLimits{
+			Free:    cfg.LoginIPFreeAttempts,
+			Lockout: cfg.LoginIPLockoutThreshold,
+		},
+		BaseDelay:       cfg.LoginBaseDelay,
+		MaxDelay:        cfg.LoginMaxDelay,
+		LockoutDuration: cfg.LoginLockoutDuration,
+	}
+	throttle := auth.NewLoginThrottle(throttleConfig)
+	policy := auth.PasswordPolicy{
+		MinLength:      cfg.PasswordMinLength,
+		MaxLength:      cfg.PasswordMaxLength,
+		MinCharClasses: cfg.PasswordMinCharClasses,
+		MaxBytes:       hasher.MaxPasswordBytes(),
+		ForbidLogin:    true,
+	}
 	rt.reg = &Register{
 		LogReg: LogReg{
-			db:             db,
-			signingKey:     []byte(cfg.JWTSigningKey),
-			expireDuration: cfg.JWTExpireDuration,
+			db:       db,
+			hasher:   hasher,
+			sessions: sessions,
+			policy:   policy,
 		},
 	}
 	rt.login = &Login{
 		LogReg: LogReg{
-			db:             db,
-			signingKey:     []byte(cfg.JWTSigningKey),
-			expireDuration: cfg.JWTExpireDuration,
+			db:       db,
+			hasher:   hasher,
+			sessions: sessions,
 		},
+		throttle: throttle,
 	}
-	tokenAuth := jwtauth.New("HS256", []byte(cfg.JWTSigningKey), nil)
-	accrualService := accrual.NewAccrualService(cfg.AccrualSystemAddress)
-	rt.postOrder = NewPostOrder(
-		db,
-		2,
-		serverCtx,
-		accrualService,
-		cfg.AccrualSystemPoolInterval,
-	)
+	rt.password = &ChangePassword{
+		db:       db,
+		hasher:   hasher,
+		policy:   policy,
+		throttle: throttle,
+	}
+	rt.refresh = &Refresh{sessions: sessions}
+	rt.logout = &Logout{db: db}
+	rt.postOrder = NewPostOrder(db)
 
 	rt.getOrder = &GetOrder{db: db}
 	rt.balance = &Balance{db: db}
 	rt.withdraw = &Withdraw{db: db}
 	rt.withdrawals = &Withdrawals{db: db}
+	rt.health = &Health{accrual: accrualHealth}
+	rt.jwks = &JWKS{keys: keys, maxAge: cfg.JWTKeysReloadInterval}
 
 	rt.Use(middleware.Logger)
+	rt.Get("/health", rt.health.Handler)
+	rt.Get("/.well-known/jwks.json", rt.jwks.Handler)
+	// без секрета уведомлениям нельзя доверять - принимаем только опрос
+	if cfg.AccrualCallbackSecret != "" {
+		rt.callback = NewAccrualCallback(updater, cfg.AccrualCallbackSecret)
+		rt.Post("/api/accrual/callback", rt.callback.Handler)
+	}
 	rt.Route("/api/user", func(r chi.Router) {
 		// доступны без авторизации
 		r.Group(func(r chi.Router) {
 			r.Post("/register", rt.reg.Handler)
 			r.Post("/login", rt.login.Handler)
+			r.Post("/token/refresh", rt.refresh.Handler)
+			// без способа доставить токен сбросить пароль нельзя
+			if notifier != nil {
+				rt.reset = &PasswordReset{
+					db:       db,
+					hasher:   hasher,
+					policy:   policy,
+					notifier: notifier,
+					ttl:      cfg.PasswordResetTokenTTL,
+					throttle: auth.NewLoginThrottle(throttleConfig),
+				}
+				r.Post("/password/reset", rt.reset.RequestHandler)
+				r.Post("/password/reset/confirm", rt.reset.ConfirmHandler)
+			}
 		})
 		// доступны с авторизацией
 		r.Group(func(r chi.Router) {
-			r.Use(jwtauth.Verifier(tokenAuth))
+			r.Use(Verifier(keys))
 			r.Use(jwtauth.Authenticator)
+			r.Use(CheckRevoked(db))
+			r.Post("/logout", rt.logout.Handler)
+			r.Post("/password", rt.password.Handler)
 			r.Post("/orders", rt.postOrder.Handler)
 			r.Get("/orders", rt.getOrder.Handler)
 			r.Get("/balance", rt.balance.Handler)
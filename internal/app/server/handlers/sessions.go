@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+// tokenResponse - пара токенов, которую получает клиент при входе и обмене
+// refresh-токена
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// время жизни access-токена в секундах
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// Sessions выдает токены. Каждый вход открывает сессию: короткоживущие
+// access-токены и цепочку одноразовых refresh-токенов, которые обмениваются
+// на новую пару. Отзыв сессии делает недействительными все ее токены
+type Sessions struct {
+	db         database.Service
+	keys       *auth.KeyRing
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewSessions(
+	db database.Service,
+	keys *auth.KeyRing,
+	accessTTL, refreshTTL time.Duration,
+) *Sessions {
+	return &Sessions{
+		db:         db,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Start открывает новую сессию пользователя
+func (s *Sessions) Start(ctx context.Context, user *models.User) (*tokenResponse, error) {
+	sessionID, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	refresh, refreshHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	session := models.Session{ID: sessionID, UserID: user.ID, Username: user.Username}
+	if err := s.db.CreateSession(ctx, session, refreshHash, s.refreshTTL); err != nil {
+		return nil, err
+	}
+	return s.tokens(user, sessionID, refresh)
+}
+
+// Refresh обменивает refresh-токен на новую пару в той же сессии
+func (s *Sessions) Refresh(ctx context.Context, token string) (*tokenResponse, error) {
+	refresh, refreshHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.db.RotateRefreshToken(ctx, auth.HashOpaqueToken(token), refreshHash, s.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{ID: session.UserID, Username: session.Username}
+	return s.tokens(&user, session.ID, refresh)
+}
+
+func (s *Sessions) tokens(user *models.User, sessionID, refresh string) (*tokenResponse, error) {
+	claims, err := auth.NewClaims(user, sessionID, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	tokenSign, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenResponse{
+		AccessToken:  tokenSign,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+// writeTokens отдает пару токенов; access-токен по-прежнему дублируется в
+// заголовке Authorization
+func writeTokens(w http.ResponseWriter, tokens *tokenResponse) {
+	encoded, err := json.Marshal(tokens)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Authorization", fmt.Sprintf("Bearer: %v", tokens.AccessToken))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(encoded)
+}
+
+// CheckRevoked пропускает только access-токены действующих сессий, которые
+// не были отозваны. Ставится после jwtauth.Authenticator
+func CheckRevoked(db database.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			token, err := GetTokenFromContext(ctx)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			revoked, err := db.IsAccessTokenRevoked(ctx, token.ID, token.SessionID)
+			if err != nil {
+				log.Printf("Error while checking token %v: %v", token.ID, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 )
 
 type Withdraw struct {
@@ -15,8 +16,8 @@ type Withdraw struct {
 }
 
 type withdrawRequestBody struct {
-	OrderID string  `valid:"luhn,required" json:"order"`
-	Sum     float64 `valid:"required"      json:"sum"`
+	OrderID string       `valid:"luhn,required"     json:"order"`
+	Sum     money.Amount `valid:"positive,required" json:"sum"`
 }
 
 const withdrawContentType = "application/json"
@@ -61,23 +62,12 @@ func (h *Withdraw) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	balance, err := h.db.GetBalance(ctx, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if balance.Current.Float64 < body.Sum {
-		http.Error(
-			w,
-			fmt.Errorf("%w: userID=%v request=%+v", ErrNotEnoughBalance, userID, body).Error(),
-			http.StatusPaymentRequired,
-		)
-		return
-	}
+	// проверка баланса и списание происходят атомарно на стороне БД
 	err = h.db.AddWithdrawalRecord(ctx, body.OrderID, body.Sum, userID)
 	if err != nil {
-		if errors.Is(err, database.ErrMissingOrderID) {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		var fundsErr *database.ErrInsufficientFunds
+		if errors.As(err, &fundsErr) {
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
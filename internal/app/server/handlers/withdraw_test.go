@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"bytes"
-	"database/sql"
 	"fmt"
 	"io"
 	"log"
@@ -11,7 +10,7 @@ import (
 	"testing"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
-	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/suite"
 )
@@ -65,12 +64,9 @@ func (suite *WithdrawTestSuite) TestNotEnoughBalance() {
 	jsonStr := []byte(`{"order":"2377225624", "sum": 751}`)
 
 	suite.db.EXPECT().
-		GetBalance(gomock.Any(), gomock.Eq(1)).
+		AddWithdrawalRecord(gomock.Any(), gomock.Eq("2377225624"), gomock.Eq(money.FromUnits(751)), gomock.Eq(1)).
 		Times(1).
-		Return(&models.Balance{
-			Current:   sql.NullFloat64{Float64: 100, Valid: true},
-			Withdrawn: sql.NullFloat64{Float64: 100, Valid: true},
-		}, nil)
+		Return(database.NewErrInsufficientFunds(1, money.FromUnits(100), money.FromUnits(751)))
 
 	rr := suite.makeRequest("TestNotEnoughBalance", true, true, bytes.NewBuffer(jsonStr))
 	suite.Equal(http.StatusPaymentRequired, rr.Code)
@@ -82,19 +78,29 @@ func (suite *WithdrawTestSuite) TestBadOrderIDFormat() {
 	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
 }
 
-func (suite *WithdrawTestSuite) TestOK() {
-	jsonStr := []byte(`{"order":"18", "sum": 10}`)
+func (suite *WithdrawTestSuite) TestNegativeSum() {
+	jsonStr := []byte(`{"order":"18", "sum": -10}`)
+	rr := suite.makeRequest("TestNegativeSum", true, true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusUnprocessableEntity, rr.Code)
+}
+
+func (suite *WithdrawTestSuite) TestFractionalSum() {
+	jsonStr := []byte(`{"order":"18", "sum": 0.3}`)
 
 	suite.db.EXPECT().
-		GetBalance(gomock.Any(), gomock.Eq(1)).
+		AddWithdrawalRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(30)), gomock.Eq(1)).
 		Times(1).
-		Return(&models.Balance{
-			Current:   sql.NullFloat64{Float64: 100, Valid: true},
-			Withdrawn: sql.NullFloat64{Float64: 100, Valid: true},
-		}, nil)
+		Return(nil)
+
+	rr := suite.makeRequest("TestFractionalSum", true, true, bytes.NewBuffer(jsonStr))
+	suite.Equal(http.StatusOK, rr.Code)
+}
+
+func (suite *WithdrawTestSuite) TestOK() {
+	jsonStr := []byte(`{"order":"18", "sum": 10}`)
 
 	suite.db.EXPECT().
-		AddWithdrawalRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(10.0), gomock.Eq(1)).
+		AddWithdrawalRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.FromUnits(10)), gomock.Eq(1)).
 		Times(1).
 		Return(nil)
 
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/models"
 )
 
 type Withdrawals struct {
@@ -19,7 +19,12 @@ func (h *Withdrawals) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	withdrawals, err := h.db.GetWithdrawals(ctx, userID)
+	query, err := parseListQuery(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withdrawals, err := h.db.GetWithdrawals(ctx, userID, fetchQuery(query))
 	if err != nil {
 		if errors.Is(err, database.ErrEmptyResult) {
 			http.Error(w, err.Error(), http.StatusNoContent)
@@ -28,12 +33,5 @@ func (h *Withdrawals) Handler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	withdrawalsEncoded, err := json.Marshal(withdrawals)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(withdrawalsEncoded)
+	writeList(w, r, withdrawals, query, (*models.Withdrawal).Cursor)
 }
@@ -5,11 +5,13 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/blokhinnv/gophermart/internal/app/database"
 	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -53,7 +55,7 @@ func (suite *WithdrawalsTestSuite) TestNoAuth() {
 
 func (suite *WithdrawalsTestSuite) TestNoContent() {
 	suite.db.EXPECT().
-		GetWithdrawals(gomock.Any(), gomock.Eq(1)).
+		GetWithdrawals(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(nil, database.ErrEmptyResult)
 
@@ -66,18 +68,18 @@ func (suite *WithdrawalsTestSuite) TestMany() {
 	withdrawals := []models.Withdrawal{
 		{
 			Order:       "18",
-			Sum:         123,
+			Sum:         money.FromUnits(123),
 			ProcessedAt: start,
 		},
 		{
 			Order:       "24",
-			Sum:         123,
+			Sum:         money.FromUnits(123),
 			ProcessedAt: start.Add(5 * time.Second),
 		},
 	}
 
 	suite.db.EXPECT().
-		GetWithdrawals(gomock.Any(), gomock.Eq(1)).
+		GetWithdrawals(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{})).
 		Times(1).
 		Return(withdrawals, nil)
 
@@ -93,6 +95,41 @@ func (suite *WithdrawalsTestSuite) TestMany() {
 	assert.JSONEq(suite.T(), expected, rr.Body.String())
 }
 
+func (suite *WithdrawalsTestSuite) TestPage() {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	to := start.Add(time.Hour)
+	withdrawals := []models.Withdrawal{
+		{Order: "18", Sum: money.FromUnits(1), ProcessedAt: start},
+		{Order: "24", Sum: money.FromUnits(2), ProcessedAt: start},
+	}
+	suite.db.EXPECT().
+		GetWithdrawals(gomock.Any(), gomock.Eq(1), gomock.Eq(models.ListQuery{Limit: 2, To: to})).
+		Times(1).
+		Return(withdrawals, nil)
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(
+		http.MethodGet,
+		"/api/user/withdrawals?limit=1&to="+url.QueryEscape(to.Format(time.RFC3339)),
+		nil,
+	)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer: %v", suite.tokenSign))
+	suite.handler.ServeHTTP(rr, req)
+	suite.Require().Equal(http.StatusOK, rr.Code)
+	expected := fmt.Sprintf(`[{"order":"18","sum":1,"processed_at":"%v"}]`, start.Format(time.RFC3339))
+	assert.JSONEq(suite.T(), expected, rr.Body.String())
+	suite.Contains(rr.Header().Get("Link"), "cursor="+encodeCursor(models.Cursor{At: start, Order: "18"}))
+}
+
+// у списаний нет статуса - фильтр по нему считается ошибкой запроса
+func (suite *WithdrawalsTestSuite) TestStatusFilter() {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/withdrawals?status=NEW", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer: %v", suite.tokenSign))
+	suite.handler.ServeHTTP(rr, req)
+	suite.Equal(http.StatusBadRequest, rr.Code)
+}
+
 func TestWithdrawalsTestSuite(t *testing.T) {
 	suite.Run(t, new(WithdrawalsTestSuite))
 }
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/server/config"
+)
+
+// ErrDevSigningKey - сервис запускают с секретом из репозитория
+var ErrDevSigningKey = errors.New(
+	"JWT_SIGNING_KEY has the default value; set JWT_KEYS_DIR or JWT_SIGNING_KEY, or run with DEV_MODE=true",
+)
+
+// newKeyRing готовит ключи подписи токенов. С JWT_KEYS_DIR токены
+// подписываются ключами из каталога, который перечитывается каждые
+// JWT_KEYS_RELOAD_INTERVAL; без него - общим секретом JWT_SIGNING_KEY
+func newKeyRing(ctx context.Context, cfg *config.Config) (*auth.KeyRing, error) {
+	if cfg.JWTKeyGracePeriod < cfg.JWTExpireDuration {
+		// иначе токены, выданные старым ключом, перестанут приниматься
+		// раньше, чем истекут
+		log.Printf(
+			"JWT_KEY_GRACE_PERIOD (%v) should be at least JWT_EXPIRE_DURATION (%v)",
+			cfg.JWTKeyGracePeriod,
+			cfg.JWTExpireDuration,
+		)
+	}
+	if cfg.JWTKeysDir == "" {
+		if cfg.JWTSigningKey == config.DevJWTSigningKey && !cfg.DevMode {
+			return nil, ErrDevSigningKey
+		}
+		key, err := auth.NewKey("default", []byte(cfg.JWTSigningKey), time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		return auth.NewKeyRing(cfg.JWTKeyGracePeriod, key)
+	}
+
+	ring, err := auth.NewKeyRing(cfg.JWTKeyGracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	rotation := auth.Rotation{
+		Dir:       auth.KeyDir(cfg.JWTKeysDir),
+		Algorithm: cfg.JWTKeyAlgorithm,
+		Interval:  cfg.JWTKeyRotationInterval,
+		// один интервал, чтобы ключ загрузили остальные экземпляры, и еще
+		// один на кэш JWKS у клиентов
+		Delay: 2 * cfg.JWTKeysReloadInterval,
+	}
+	if err := rotation.Reload(ring); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.JWTKeysReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// с прежними ключами сервис продолжает работать
+				if err := rotation.Reload(ring); err != nil {
+					log.Printf("Error while reloading signing keys: %v", err)
+				}
+			}
+		}
+	}()
+	return ring, nil
+}
@@ -8,9 +8,12 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/auth"
+	"github.com/blokhinnv/gophermart/internal/app/notify"
 	"github.com/blokhinnv/gophermart/internal/app/server/config"
 	"github.com/blokhinnv/gophermart/internal/app/server/handlers"
+	"github.com/blokhinnv/gophermart/internal/app/worker"
 )
 
 func RunServer(cfg *config.Config) {
@@ -22,22 +25,75 @@ func RunServer(cfg *config.Config) {
 		syscall.SIGQUIT,
 	)
 
-	db, err := database.NewDatabaseService(cfg, shutdownCtx)
+	hasher, err := auth.NewHasherByName(cfg.PasswordHash)
 	if err != nil {
 		log.Fatal(err)
 	}
+	keys, err := newKeyRing(shutdownCtx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var notifier notify.Notifier
+	if cfg.Notifier != "" {
+		if notifier, err = notify.New(cfg.Notifier, cfg.NotifierFile); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Println("NOTIFIER is not set: password reset is disabled")
+	}
+	db, err := newStorage(shutdownCtx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.AccrualTaskTimeout >= cfg.AccrualLeaseDuration {
+		// иначе задачу, которую еще обрабатывают, может забрать другой воркер
+		log.Printf(
+			"ACCRUAL_TASK_TIMEOUT (%v) should be less than ACCRUAL_LEASE_DURATION (%v)",
+			cfg.AccrualTaskTimeout,
+			cfg.AccrualLeaseDuration,
+		)
+	}
+	accrualService := accrual.NewAccrualService(accrual.Config{
+		Address:          cfg.AccrualSystemAddress,
+		Timeout:          cfg.AccrualRequestTimeout,
+		RateLimit:        cfg.AccrualRateLimit,
+		FailureThreshold: cfg.AccrualFailureThreshold,
+		OpenTimeout:      cfg.AccrualOpenTimeout,
+	})
+	accrualWorker := worker.NewWorker(db, accrualService, worker.Config{
+		Workers:       cfg.AccrualWorkers,
+		MinWorkers:    cfg.AccrualWorkersMin,
+		MaxWorkers:    cfg.AccrualWorkersMax,
+		ScaleInterval: cfg.AccrualScaleInterval,
+		PollInterval:  cfg.AccrualSystemPoolInterval,
+		TaskTimeout:   cfg.AccrualTaskTimeout,
+		BatchSize:     cfg.AccrualBatchSize,
+		Parallelism:   cfg.AccrualParallelism,
+		LeaseDuration: cfg.AccrualLeaseDuration,
+	})
+	accrualWorker.Start(shutdownCtx)
 
-	r := handlers.NewRouter(db, cfg, shutdownCtx)
+	r := handlers.NewRouter(db, cfg, accrualService, accrualWorker, hasher, keys, notifier)
 
 	go func() {
 		<-shutdownCtx.Done()
 		log.Printf("Shutting down gracefully...")
-		r.Shutdown()
+		// хочу убедиться, что все воркеры завершились,
+		// прежде чем закрывать соединение с БД
+		accrualWorker.Stop()
+		stats := accrualService.LimiterStats()
+		log.Printf(
+			"Accrual client throttled %v requests for %v in total (%v pauses after 429)",
+			stats.Waits,
+			stats.Throttled,
+			stats.Pauses,
+		)
 		db.Close()
 		log.Printf("Bye...")
 		os.Exit(0)
 	}()
 
-	log.Printf("Starting server with config %+v\n", cfg)
+	log.Printf("Starting server with config %v\n", cfg)
 	log.Fatal(http.ListenAndServe(cfg.RunAddress, r))
 }
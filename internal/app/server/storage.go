@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/memory"
+	"github.com/blokhinnv/gophermart/internal/app/database/migration"
+	"github.com/blokhinnv/gophermart/internal/app/server/config"
+)
+
+// newStorage открывает хранилище, выбранное в DATABASE_BACKEND
+func newStorage(ctx context.Context, cfg *config.Config) (database.Service, error) {
+	switch cfg.DatabaseBackend {
+	case config.BackendPostgres:
+		db, err := database.NewDatabaseService(cfg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := prepareSchema(ctx, db, cfg.DatabaseMigrate); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	case config.BackendMemory:
+		log.Println("Using in-memory storage: all data will be lost on shutdown")
+		return memory.NewService(database.NewRetryPolicy(cfg), cfg.AccrualLeaseDuration), nil
+	}
+	return nil, fmt.Errorf("unknown DATABASE_BACKEND %q", cfg.DatabaseBackend)
+}
+
+// prepareSchema накатывает миграции или проверяет версию схемы, как задано
+// в DATABASE_MIGRATE. С несовместимой схемой сервис не запускается: первый
+// же запрос к ней упал бы или, хуже, испортил данные
+func prepareSchema(ctx context.Context, db *database.DatabaseService, mode string) error {
+	if mode == config.MigrateOff {
+		return nil
+	}
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case config.MigrateUp:
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+	case config.MigrateVerify:
+	default:
+		return fmt.Errorf("unknown DATABASE_MIGRATE %q", mode)
+	}
+	err = migrator.Check(ctx)
+	if errors.Is(err, migration.ErrSchemaOutdated) {
+		return fmt.Errorf("%w; run `gophermart migrate up` or set DATABASE_MIGRATE=up", err)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Database schema version %v", migrator.Latest())
+	return nil
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"github.com/ShiraazMoollatjie/goluhn"
 	"github.com/asaskevich/govalidator"
+	"github.com/blokhinnv/gophermart/internal/app/money"
 )
 
 func init() {
@@ -16,5 +17,12 @@ func init() {
 		}
 		return goluhn.Validate(v) == nil
 	})
+	govalidator.CustomTypeTagMap.Set("positive", func(i interface{}, context interface{}) bool {
+		v, ok := i.(money.Amount)
+		if !ok {
+			return false
+		}
+		return v > 0
+	})
 
 }
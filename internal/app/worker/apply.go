@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+// Apply применяет сведения о заказе, которые система расчета прислала сама.
+// Путь тот же, что и у опроса, поэтому результат, уже полученный опросом,
+// повторно не применяется: changed = false. Переход, который не допускает
+// машина состояний, возвращает ошибку с models.ErrIllegalTransition, а
+// неизвестный заказ - database.ErrMissingOrderID
+func (w *Worker) Apply(ctx context.Context, info *accrual.OrderInfo) (changed bool, err error) {
+	return w.apply(ctx, info, nil)
+}
+
+// apply в одной транзакции переводит заказ в новый статус, начисляет баллы и
+// обновляет очередь. task - задача опроса; nil, если сведения пришли от
+// системы расчета
+func (w *Worker) apply(
+	ctx context.Context,
+	info *accrual.OrderInfo,
+	task *ordertracker.Task,
+) (changed bool, err error) {
+	status := info.Status
+	err = w.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		changed = false
+		// опрос и уведомления об одном заказе ждут друг друга на этой
+		// блокировке, поэтому переход проверяется по актуальному статусу
+		current, err := w.db.LockOrderStatus(ctx, info.Order)
+		if err != nil {
+			return err
+		}
+		if current.Terminal() {
+			// заказ уже обработан другим путем - опрашивать его больше не нужно
+			if task != nil {
+				if status != current {
+					log.Printf("OrderID=%v is already %v, ignoring %v", info.Order, current, status)
+				}
+				return w.tracker.Delete(ctx, info.Order)
+			}
+			if status == current {
+				return nil
+			}
+		}
+		if err := models.CheckTransition(current, status); err != nil {
+			return err
+		}
+		if status != current {
+			// обновить запись о заказе
+			if err := w.db.UpdateOrderStatus(ctx, info.Order, string(status)); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if status == models.StatusProcessed {
+			// если заказ обработан - добавим запись с баллами
+			err = w.db.AddAccrualRecord(ctx, info.Order, info.Accrual)
+			if err != nil {
+				if !errors.Is(err, database.ErrAccrualAlreadyAdded) {
+					return err
+				}
+				// баллы уже начислены - осталось убрать заказ из очереди
+				log.Printf("Accrual for orderID=%v already added", info.Order)
+			}
+		}
+		// из терминального статуса (PROCESSED, INVALID) заказ уже не выйдет -
+		// удаляем его из очереди на обработку
+		if status.Terminal() {
+			return w.tracker.Delete(ctx, info.Order)
+		}
+		// если не обработан - возвращаем в работу с задержкой; задачу,
+		// которую сейчас никто не опрашивает, не трогаем
+		if task != nil {
+			return w.tracker.UpdateStatusAndRelease(ctx, task, database.STATUSES[string(status)])
+		}
+		return nil
+	})
+	return changed, err
+}
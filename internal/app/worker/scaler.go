@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// если на столько запросов приходит 429, больше горутин не нужно: система
+// расчета все равно не примет больше
+const maxThrottledShare = 0.1
+
+// adaptive возвращает true, если количество горутин подстраивается под нагрузку
+func (cfg Config) adaptive() bool {
+	return cfg.MinWorkers > 0 && cfg.MaxWorkers > cfg.MinWorkers && cfg.ScaleInterval > 0
+}
+
+// scale периодически пересматривает количество горутин
+func (w *Worker) scale(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.cfg.ScaleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.rescale(ctx)
+		}
+	}
+}
+
+func (w *Worker) rescale(ctx context.Context) {
+	depth, err := w.tracker.Depth(ctx)
+	if err != nil {
+		log.Printf("Error while getting queue depth: %v", err)
+		return
+	}
+	current := w.Size()
+	target := desiredWorkers(
+		current,
+		depth,
+		w.requests.Swap(0),
+		w.throttled.Swap(0),
+		w.cfg,
+	)
+	if target != current {
+		log.Printf("Scaling accrual workers %v -> %v (queue depth %v)", current, target, depth)
+		w.resize(ctx, target)
+	}
+}
+
+// desiredWorkers решает, сколько горутин нужно: при частых 429 - меньше,
+// если очередь не помещается в одну пачку на горутину - больше, если
+// очередь пуста - меньше. Размер меняется на одну горутину за раз
+func desiredWorkers(current, depth int, requests, throttled int64, cfg Config) int {
+	target := current
+	switch {
+	case requests > 0 && float64(throttled)/float64(requests) > maxThrottledShare:
+		target--
+	case depth > current*cfg.BatchSize:
+		target++
+	case depth == 0:
+		target--
+	}
+	return clamp(target, cfg.MinWorkers, cfg.MaxWorkers)
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDesiredWorkers(t *testing.T) {
+	cfg := Config{MinWorkers: 1, MaxWorkers: 4, BatchSize: 10}
+	tests := []struct {
+		name      string
+		current   int
+		depth     int
+		requests  int64
+		throttled int64
+		want      int
+	}{
+		{"backlog", 2, 100, 20, 0, 3},
+		{"backlog at max", 4, 1000, 20, 0, 4},
+		{"fits in batches", 2, 15, 20, 1, 2},
+		{"empty queue", 3, 0, 0, 0, 2},
+		{"empty queue at min", 1, 0, 0, 0, 1},
+		{"throttled", 3, 1000, 20, 5, 2},
+		{"throttled at min", 1, 1000, 20, 20, 1},
+	}
+	for _, tt := range tests {
+		got := desiredWorkers(tt.current, tt.depth, tt.requests, tt.throttled, cfg)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	assert.False(t, Config{Workers: 2}.adaptive())
+	assert.False(t, Config{MinWorkers: 2, MaxWorkers: 2, ScaleInterval: 1}.adaptive())
+	assert.True(t, Config{MinWorkers: 1, MaxWorkers: 2, ScaleInterval: 1}.adaptive())
+}
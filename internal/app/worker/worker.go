@@ -0,0 +1,416 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+)
+
+// Config - настройки обработчиков очереди заказов
+type Config struct {
+	// количество горутин, опрашивающих систему расчета баллов; в
+	// адаптивном режиме - начальное
+	Workers int
+	// границы адаптивного режима: если MaxWorkers больше MinWorkers,
+	// количество горутин подстраивается под очередь и ответы 429
+	MinWorkers int
+	MaxWorkers int
+	// как часто пересматривается количество горутин
+	ScaleInterval time.Duration
+	// как часто каждая горутина проверяет очередь без уведомлений: новые
+	// заказы будят горутины сразу, а таймер подбирает отложенные задачи
+	PollInterval time.Duration
+	// сколько времени отводится на обработку одной задачи
+	TaskTimeout time.Duration
+	// сколько задач горутина арендует за один запрос
+	BatchSize int
+	// сколько задач из пачки обрабатываются одновременно
+	Parallelism int
+	// срок аренды задачи в очереди: задачу, которую не успеть обработать
+	// до его конца, горутина отпускает
+	LeaseDuration time.Duration
+}
+
+// Worker забирает заказы из очереди, узнает их статус в системе
+// расчета баллов и сохраняет результат
+type Worker struct {
+	db            database.Service
+	tracker       ordertracker.Tracker
+	accrualSystem accrual.Service
+	cfg           Config
+	// сигнал горутинам, что в очереди могут быть задачи
+	wake chan struct{}
+	// запросы к системе расчета и ответы 429 с прошлого пересмотра размера
+	requests  atomic.Int64
+	throttled atomic.Int64
+
+	mu sync.Mutex
+	// по каналу на каждую работающую горутину: закрытие останавливает ее
+	stops    []chan struct{}
+	nextID   int
+	hostname string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWorker(
+	db database.Service,
+	accrualSystem accrual.Service,
+	cfg Config,
+) *Worker {
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.Parallelism < 1 {
+		cfg.Parallelism = 1
+	}
+	if cfg.adaptive() {
+		cfg.Workers = clamp(cfg.Workers, cfg.MinWorkers, cfg.MaxWorkers)
+	}
+	hostname, _ := os.Hostname()
+	return &Worker{
+		db:            db,
+		tracker:       db.Tracker(),
+		accrualSystem: accrualSystem,
+		cfg:           cfg,
+		wake:          make(chan struct{}, 1),
+		hostname:      hostname,
+	}
+}
+
+// Start запускает горутины-обработчики; они работают, пока не отменен ctx
+// или не вызван Stop
+func (w *Worker) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.wg.Add(1)
+	go w.forwardNotifications(ctx)
+	w.resize(ctx, w.cfg.Workers)
+	if w.cfg.adaptive() {
+		w.wg.Add(1)
+		go w.scale(ctx)
+	}
+}
+
+// Size возвращает количество работающих горутин-обработчиков
+func (w *Worker) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.stops)
+}
+
+// resize запускает или останавливает горутины, чтобы их стало n.
+// Остановленная горутина доделывает текущую пачку задач и выходит
+func (w *Worker) resize(ctx context.Context, n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.stops) < n {
+		stop := make(chan struct{})
+		w.stops = append(w.stops, stop)
+		// под этим именем горутина арендует задачи в очереди
+		owner := fmt.Sprintf("%v-%v-%v", w.hostname, os.Getpid(), w.nextID)
+		w.nextID++
+		w.wg.Add(1)
+		go w.loop(ctx, owner, stop)
+	}
+	for len(w.stops) > n {
+		last := len(w.stops) - 1
+		close(w.stops[last])
+		w.stops = w.stops[:last]
+	}
+}
+
+// forwardNotifications будит одну из горутин, когда в очередь добавили заказ
+func (w *Worker) forwardNotifications(ctx context.Context) {
+	defer w.wg.Done()
+	for range w.tracker.Notifications(ctx) {
+		w.signal()
+	}
+}
+
+// signal не блокируется: непрочитанные сигналы склеиваются
+func (w *Worker) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop останавливает обработчики и дожидается их завершения
+func (w *Worker) Stop() {
+	log.Println("Shutting down accrual workers...")
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context, owner string, stop <-chan struct{}) {
+	defer w.wg.Done()
+	// таймер - запасной вариант: уведомления могут потеряться, а отложенные
+	// задачи созревают без уведомлений
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Shutting down worker goroutine...")
+			return
+		case <-stop:
+			// остановка проверяется только между пачками: арендованные
+			// задачи всегда доводятся до конца или отпускаются
+			log.Printf("Scaling down: worker goroutine %v stopped", owner)
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		// пока система расчета просит подождать, задачи не забираем
+		if err := w.accrualSystem.WaitAvailable(ctx); err != nil {
+			continue
+		}
+		// ошибка касается одной задачи или временной недоступности БД:
+		// горутина продолжает работу до остановки воркера
+		found, err := w.safeProcessNext(ctx, owner)
+		if err != nil {
+			log.Printf("Error while processing task: %v", err)
+		}
+		// за этой задачей могут быть еще - не ждем следующего тика
+		if found {
+			w.signal()
+		}
+	}
+}
+
+// safeProcessNext не дает панике при обработке задачи завершить горутину
+func (w *Worker) safeProcessNext(ctx context.Context, owner string) (found bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing task: %v", r)
+		}
+	}()
+	return w.processNext(ctx, owner)
+}
+
+// errUnavailable - задача возвращена в очередь без попытки, потому что система
+// расчета просит подождать или недоступна
+var errUnavailable = errors.New("accrual system is unavailable")
+
+// postponedError - ошибка, из-за которой откладывается только текущая
+// задача: заказ будет опрошен снова по расписанию повторов, а горутина
+// продолжит работу
+type postponedError struct {
+	err error
+}
+
+func (e *postponedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *postponedError) Unwrap() error {
+	return e.err
+}
+
+func postpone(err error) error {
+	return &postponedError{err: err}
+}
+
+// storageError - задача не обработана из-за хранилища, а не из-за заказа или
+// системы расчета: задача возвращается в очередь, не тратя попытку
+type storageError struct {
+	err error
+}
+
+func (e *storageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+// processNext арендует пачку задач и обрабатывает их, не больше
+// Parallelism одновременно. found - стоит ли сразу проверить очередь снова.
+// Ошибки задач логируются; возвращается первая из них
+func (w *Worker) processNext(ctx context.Context, owner string) (found bool, err error) {
+	acquireCtx, cancel := context.WithTimeout(ctx, w.cfg.TaskTimeout)
+	tasks, err := w.tracker.AcquireBatch(acquireCtx, owner, w.cfg.BatchSize)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	acquiredAt := time.Now()
+
+	errs := make([]error, len(tasks))
+	sem := make(chan struct{}, w.cfg.Parallelism)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		sem <- struct{}{}
+		// пока задача ждала очереди, аренда могла подойти к концу: такую
+		// задачу отпускаем, чтобы ее не забрали во время обработки
+		if w.leaseTooShort(acquiredAt) || ctx.Err() != nil {
+			<-sem
+			errs[i] = w.release(task, 0)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, task *ordertracker.Task) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = w.processTask(ctx, task)
+		}(i, task)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, errUnavailable):
+		default:
+			found = true
+			if len(tasks) > 1 {
+				log.Printf("Error while processing orderID=%v: %v", tasks[i].OrderID, err)
+			}
+		}
+	}
+	return found, firstError(errs)
+}
+
+// leaseTooShort возвращает true, если задачу, арендованную в acquiredAt, уже
+// не успеть обработать до конца аренды
+func (w *Worker) leaseTooShort(acquiredAt time.Time) bool {
+	if w.cfg.LeaseDuration <= 0 {
+		return false
+	}
+	return time.Since(acquiredAt)+w.cfg.TaskTimeout >= w.cfg.LeaseDuration
+}
+
+// firstError возвращает первую ошибку, кроме errUnavailable
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, errUnavailable) {
+			return err
+		}
+	}
+	return nil
+}
+
+// processTask обрабатывает арендованную задачу; при ошибке задача
+// возвращается в очередь с учетом попытки
+func (w *Worker) processTask(ctx context.Context, task *ordertracker.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.TaskTimeout)
+	defer cancel()
+	if task.Reclaimed {
+		log.Printf("Reclaimed orderID=%v after expired lease", task.OrderID)
+	}
+	err := w.process(ctx, task)
+	var storageErr *storageError
+	switch {
+	case err == nil, errors.Is(err, ordertracker.ErrLeaseLost):
+	case errors.Is(err, errUnavailable):
+		return err
+	case errors.As(err, &storageErr):
+		// заказ тут ни при чем: возвращаем задачу без попытки. Пауза - чтобы
+		// не крутить ее впустую, пока хранилище не ответит
+		releaseCtx, cancel := releaseContext()
+		defer cancel()
+		if releaseErr := w.tracker.Release(releaseCtx, task, w.cfg.PollInterval); releaseErr != nil {
+			log.Printf("Error while releasing orderID=%v: %v", task.OrderID, releaseErr)
+		}
+	default:
+		// не держим задачу до истечения аренды: засчитываем попытку и
+		// возвращаем ее в очередь
+		releaseCtx, cancel := releaseContext()
+		defer cancel()
+		if releaseErr := w.tracker.UpdateStatusAndRelease(releaseCtx, task, task.StatusID); releaseErr != nil {
+			log.Printf("Error while releasing orderID=%v: %v", task.OrderID, releaseErr)
+		}
+	}
+	var postponed *postponedError
+	if errors.As(err, &postponed) {
+		log.Printf("Postponing orderID=%v: %v", task.OrderID, err)
+		return nil
+	}
+	return err
+}
+
+// releaseTimeout - сколько ждать хранилище, возвращая задачу в очередь
+const releaseTimeout = 5 * time.Second
+
+// releaseContext - контекст для возврата задачи в очередь. Контекст задачи
+// для этого не годится: ошибка часто и означает, что он истек, а без
+// возврата задача простоит до конца аренды
+func releaseContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), releaseTimeout)
+}
+
+// release возвращает задачу в очередь без попытки и сообщает errUnavailable
+func (w *Worker) release(task *ordertracker.Task, delay time.Duration) error {
+	ctx, cancel := releaseContext()
+	defer cancel()
+	if err := w.tracker.Release(ctx, task, delay); err != nil {
+		if errors.Is(err, ordertracker.ErrLeaseLost) {
+			return err
+		}
+		return &storageError{err: fmt.Errorf("release orderID=%v: %w", task.OrderID, err)}
+	}
+	return errUnavailable
+}
+
+func (w *Worker) process(ctx context.Context, task *ordertracker.Task) error {
+	// делаем запрос к системе расчета баллов
+	info, err := w.accrualSystem.GetOrderInfo(ctx, task.OrderID)
+	// запрос не отправлялся: своя очередь в лимитере не подошла бы до конца
+	// отведенного на задачу времени. Ни запросом, ни 429 это не считается,
+	// иначе автомасштабирование решит, что система расчета перегружена
+	var deadlineErr *accrual.ErrLimiterDeadline
+	if errors.As(err, &deadlineErr) {
+		return w.release(task, deadlineErr.Wait)
+	}
+	w.requests.Add(1)
+	if err != nil {
+		// если заспамили - возвращаем задачу в работу после Retry-After;
+		// паузу для всех горутин выдерживает лимитер клиента,
+		// попыткой такой запрос не считается
+		var tmrErr *accrual.ErrTooManyRequests
+		if errors.As(err, &tmrErr) {
+			w.throttled.Add(1)
+			return w.release(task, tmrErr.RetryAfter)
+		}
+		// система расчета недоступна - заказ тут ни при чем, попытку не засчитываем
+		if errors.Is(err, accrual.ErrCircuitOpen) {
+			return w.release(task, 0)
+		}
+		// заказ еще не зарегистрирован, система расчета ответила ошибкой или
+		// прислала что-то непонятное - спросим позже
+		var respErr *accrual.ErrUnexpectedResponse
+		if errors.Is(err, accrual.ErrOrderNotRegistered) ||
+			errors.Is(err, accrual.ErrBadResponse) ||
+			errors.As(err, &respErr) {
+			return postpone(err)
+		}
+		return err
+	}
+
+	if info.Order != task.OrderID {
+		return postpone(fmt.Errorf("response for orderID=%v has order=%v", task.OrderID, info.Order))
+	}
+	_, err = w.apply(ctx, info, task)
+	switch {
+	case err == nil, errors.Is(err, ordertracker.ErrLeaseLost):
+		return err
+	case errors.Is(err, models.ErrIllegalTransition):
+		return postpone(err)
+	}
+	return &storageError{err: err}
+}
@@ -0,0 +1,920 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blokhinnv/gophermart/internal/app/accrual"
+	"github.com/blokhinnv/gophermart/internal/app/accrual/accrualtest"
+	"github.com/blokhinnv/gophermart/internal/app/database"
+	"github.com/blokhinnv/gophermart/internal/app/database/ordertracker"
+	"github.com/blokhinnv/gophermart/internal/app/models"
+	"github.com/blokhinnv/gophermart/internal/app/money"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerTestSuite struct {
+	suite.Suite
+	ctrl           *gomock.Controller
+	db             *database.MockService
+	tracker        *ordertracker.MockTracker
+	accrualService *accrual.MockService
+	worker         *Worker
+}
+
+func (suite *WorkerTestSuite) SetupTest() {
+	suite.ctrl = gomock.NewController(suite.T())
+	suite.db = database.NewMockService(suite.ctrl)
+	suite.tracker = ordertracker.NewMockTracker(suite.ctrl)
+	suite.accrualService = accrual.NewMockService(suite.ctrl)
+	suite.db.EXPECT().
+		Tracker().
+		Return(suite.tracker)
+	suite.worker = NewWorker(suite.db, suite.accrualService, Config{
+		Workers:      2,
+		PollInterval: 10 * time.Millisecond,
+		TaskTimeout:  time.Second,
+	})
+}
+
+// expectTransaction ожидает times вызовов WithinTransaction, которые
+// просто выполняют переданную функцию
+func (suite *WorkerTestSuite) expectTransaction(times int) {
+	suite.db.EXPECT().
+		WithinTransaction(gomock.Any(), gomock.Any()).
+		Times(times).
+		DoAndReturn(func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return fn(ctx)
+		})
+}
+
+// expectLockedStatus ожидает times блокировок заказа orderID, который
+// сейчас в статусе status
+func (suite *WorkerTestSuite) expectLockedStatus(orderID any, status models.OrderStatus, times int) {
+	suite.db.EXPECT().
+		LockOrderStatus(gomock.Any(), gomock.Eq(orderID)).
+		Times(times).
+		Return(status, nil)
+}
+
+// expectNotifications подменяет уведомления трекера: сигнал, отправленный в
+// возвращенный канал, получит воркер
+func (suite *WorkerTestSuite) expectNotifications() chan<- struct{} {
+	in := make(chan struct{})
+	suite.tracker.EXPECT().
+		Notifications(gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context) <-chan struct{} {
+			out := make(chan struct{})
+			go func() {
+				defer close(out)
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-in:
+						select {
+						case out <- struct{}{}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}()
+			return out
+		})
+	return in
+}
+
+// processNext обрабатывает одну задачу и проверяет, что она нашлась
+func (suite *WorkerTestSuite) processNext() error {
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.True(found)
+	return err
+}
+
+func (suite *WorkerTestSuite) TearDownTest() {
+	suite.ctrl.Finish()
+}
+
+func (suite *WorkerTestSuite) TestEmptyQueue() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return(nil, nil)
+
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.NoError(err)
+	suite.False(found)
+}
+
+func (suite *WorkerTestSuite) TestProcessed() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 0, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 50050}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusNew, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSED")).
+		Times(1).
+		Return(nil)
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(50050))).
+		Times(1).
+		Return(nil)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+}
+
+func (suite *WorkerTestSuite) TestProcessedTwice() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 2, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 50050}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusProcessing, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSED")).
+		Times(1).
+		Return(nil)
+	// баллы за заказ уже начислены - второй раз не начисляем, но из очереди убираем
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(50050))).
+		Times(1).
+		Return(database.ErrAccrualAlreadyAdded)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+}
+
+func (suite *WorkerTestSuite) TestProcessedRollback() {
+	errDB := errors.New("connection reset")
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 2, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 50050}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusProcessing, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSED")).
+		Times(1).
+		Return(nil)
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(50050))).
+		Times(1).
+		Return(errDB)
+	// транзакция откатилась из-за хранилища - задача возвращается в
+	// очередь без попытки
+	suite.tracker.EXPECT().
+		Release(gomock.Any(), gomock.Any(), gomock.Eq(suite.worker.cfg.PollInterval)).
+		Times(1).
+		Return(nil)
+
+	suite.ErrorIs(suite.processNext(), errDB)
+}
+
+// если не удалось вернуть задачу в очередь после 429, попытка тоже не
+// тратится: система расчета заказ не проверяла
+func (suite *WorkerTestSuite) TestReleaseFailed() {
+	errDB := errors.New("connection reset")
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, accrual.NewErrTooManyRequests(time.Second))
+	gomock.InOrder(
+		suite.tracker.EXPECT().
+			Release(gomock.Any(), gomock.Any(), gomock.Eq(time.Second)).
+			Times(1).
+			Return(errDB),
+		suite.tracker.EXPECT().
+			Release(gomock.Any(), gomock.Any(), gomock.Eq(suite.worker.cfg.PollInterval)).
+			Times(1).
+			Return(nil),
+	)
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+
+	suite.ErrorIs(suite.processNext(), errDB)
+}
+
+func (suite *WorkerTestSuite) TestProcessing() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessing}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusRegistered, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSING")).
+		Times(1).
+		Return(nil)
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(database.STATUSES["PROCESSING"])).
+		Times(1).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+}
+
+func (suite *WorkerTestSuite) TestInvalid() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 2, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusInvalid}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusProcessing, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("INVALID")).
+		Times(1).
+		Return(nil)
+	// баллы не начисляются, а заказ уходит из очереди
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+}
+
+// TestPostponed проверяет ответы, после которых задача откладывается с
+// учетом попытки, а горутина продолжает работу
+func (suite *WorkerTestSuite) TestPostponed() {
+	tests := []struct {
+		name     string
+		statusID int
+		// статус заказа в БД; пусто, если до БД дело не доходит
+		locked models.OrderStatus
+		info   *accrual.OrderInfo
+		err    error
+	}{
+		{name: "not registered", statusID: 0, err: accrual.ErrOrderNotRegistered},
+		{
+			name:     "server error",
+			statusID: 0,
+			err:      &accrual.ErrUnexpectedResponse{StatusCode: 500, Body: "internal error"},
+		},
+		{name: "bad response", statusID: 0, err: fmt.Errorf("%w: unknown status", accrual.ErrBadResponse)},
+		{
+			name:     "other order",
+			statusID: 0,
+			info:     &accrual.OrderInfo{Order: "26", Status: models.StatusProcessing},
+		},
+		{
+			name:     "backwards",
+			statusID: 2,
+			locked:   models.StatusProcessing,
+			info:     &accrual.OrderInfo{Order: "18", Status: models.StatusRegistered},
+		},
+	}
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			suite.tracker.EXPECT().
+				AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+				Times(1).
+				Return([]*ordertracker.Task{{OrderID: "18", StatusID: tt.statusID, Owner: "test"}}, nil)
+			suite.accrualService.EXPECT().
+				GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+				Times(1).
+				Return(tt.info, tt.err)
+			if tt.locked != "" {
+				suite.expectTransaction(1)
+				suite.expectLockedStatus("18", tt.locked, 1)
+			}
+			suite.db.EXPECT().
+				UpdateOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+				Times(0)
+			suite.tracker.EXPECT().
+				UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(tt.statusID)).
+				Times(1).
+				Return(nil)
+
+			suite.NoError(suite.processNext())
+		})
+	}
+}
+
+// TestAlreadyTerminal проверяет, что заказ, который система расчета уже
+// довела до конца через уведомление, опрос только убирает из очереди
+func (suite *WorkerTestSuite) TestAlreadyTerminal() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 2, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 100}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusProcessed, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(0)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+}
+
+// TestApply проверяет уведомления системы расчета: они проходят ту же
+// машину состояний, а повтор уже примененного результата ничего не меняет
+func (suite *WorkerTestSuite) TestApply() {
+	ctx := context.Background()
+	processed := &accrual.OrderInfo{Order: "18", Status: models.StatusProcessed, Accrual: 50050}
+
+	suite.Run("processed", func() {
+		suite.expectTransaction(1)
+		suite.expectLockedStatus("18", models.StatusProcessing, 1)
+		suite.db.EXPECT().
+			UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSED")).
+			Times(1).
+			Return(nil)
+		suite.db.EXPECT().
+			AddAccrualRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(50050))).
+			Times(1).
+			Return(nil)
+		suite.tracker.EXPECT().
+			Delete(gomock.Any(), gomock.Eq("18")).
+			Times(1).
+			Return(nil)
+		changed, err := suite.worker.Apply(ctx, processed)
+		suite.NoError(err)
+		suite.True(changed)
+	})
+	suite.Run("duplicate", func() {
+		suite.expectTransaction(1)
+		suite.expectLockedStatus("18", models.StatusProcessed, 1)
+		changed, err := suite.worker.Apply(ctx, processed)
+		suite.NoError(err)
+		suite.False(changed)
+	})
+	suite.Run("processing", func() {
+		// задачу в очереди не трогаем: ее арендует и отпускает опрос
+		suite.expectTransaction(1)
+		suite.expectLockedStatus("18", models.StatusRegistered, 1)
+		suite.db.EXPECT().
+			UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSING")).
+			Times(1).
+			Return(nil)
+		changed, err := suite.worker.Apply(ctx, &accrual.OrderInfo{Order: "18", Status: models.StatusProcessing})
+		suite.NoError(err)
+		suite.True(changed)
+	})
+	suite.Run("stale", func() {
+		suite.expectTransaction(1)
+		suite.expectLockedStatus("18", models.StatusProcessing, 1)
+		_, err := suite.worker.Apply(ctx, &accrual.OrderInfo{Order: "18", Status: models.StatusRegistered})
+		suite.ErrorIs(err, models.ErrIllegalTransition)
+	})
+	suite.Run("changed after processed", func() {
+		suite.expectTransaction(1)
+		suite.expectLockedStatus("18", models.StatusProcessed, 1)
+		_, err := suite.worker.Apply(ctx, &accrual.OrderInfo{Order: "18", Status: models.StatusInvalid})
+		suite.ErrorIs(err, models.ErrIllegalTransition)
+	})
+	suite.Run("unknown order", func() {
+		suite.expectTransaction(1)
+		suite.db.EXPECT().
+			LockOrderStatus(gomock.Any(), gomock.Eq("26")).
+			Times(1).
+			Return(models.OrderStatus(""), database.ErrMissingOrderID)
+		_, err := suite.worker.Apply(ctx, &accrual.OrderInfo{Order: "26", Status: models.StatusProcessed})
+		suite.ErrorIs(err, database.ErrMissingOrderID)
+	})
+}
+
+// TestAccrualServer проводит заказ через настоящий клиент и поддельную
+// систему расчета
+func (suite *WorkerTestSuite) TestAccrualServer() {
+	srv := accrualtest.NewServer()
+	defer srv.Close()
+	srv.SetOrder("18", accrualtest.Registered(), accrualtest.Processed(50050))
+	suite.db.EXPECT().
+		Tracker().
+		Return(suite.tracker)
+	suite.worker = NewWorker(suite.db, accrual.NewAccrualService(accrual.Config{
+		Address: srv.URL,
+		Timeout: time.Second,
+	}), suite.worker.cfg)
+
+	gomock.InOrder(
+		suite.tracker.EXPECT().
+			AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+			Return([]*ordertracker.Task{{OrderID: "18", StatusID: 0, Owner: "test"}}, nil),
+		suite.tracker.EXPECT().
+			AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+			Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil),
+	)
+	suite.expectTransaction(2)
+	gomock.InOrder(
+		suite.db.EXPECT().
+			LockOrderStatus(gomock.Any(), gomock.Eq("18")).
+			Return(models.StatusNew, nil),
+		suite.db.EXPECT().
+			LockOrderStatus(gomock.Any(), gomock.Eq("18")).
+			Return(models.StatusRegistered, nil),
+	)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("REGISTERED")).
+		Return(nil)
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(database.STATUSES["REGISTERED"])).
+		Return(nil)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSED")).
+		Return(nil)
+	suite.db.EXPECT().
+		AddAccrualRecord(gomock.Any(), gomock.Eq("18"), gomock.Eq(money.Amount(50050))).
+		Return(nil)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("18")).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+	suite.NoError(suite.processNext())
+	suite.Equal(2, srv.Requests("18"))
+}
+
+func (suite *WorkerTestSuite) TestTooManyRequests() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, accrual.NewErrTooManyRequests(0))
+	suite.tracker.EXPECT().
+		Release(gomock.Any(), gomock.Any(), gomock.Eq(time.Duration(0))).
+		Times(1).
+		Return(nil)
+
+	// следующую задачу горутина сразу не берет
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.NoError(err)
+	suite.False(found)
+}
+
+// до запроса дело не дошло: задача возвращается без попытки и не считается
+// ответом 429
+func (suite *WorkerTestSuite) TestLimiterDeadline() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, &accrual.ErrLimiterDeadline{Wait: time.Minute})
+	suite.tracker.EXPECT().
+		Release(gomock.Any(), gomock.Any(), gomock.Eq(time.Minute)).
+		Times(1).
+		Return(nil)
+
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.NoError(err)
+	suite.False(found)
+	suite.Equal(int64(0), suite.worker.requests.Load())
+	suite.Equal(int64(0), suite.worker.throttled.Load())
+}
+
+func (suite *WorkerTestSuite) TestCircuitOpen() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, accrual.ErrCircuitOpen)
+	// попытка не засчитывается
+	suite.tracker.EXPECT().
+		Release(gomock.Any(), gomock.Any(), gomock.Eq(time.Duration(0))).
+		Times(1).
+		Return(nil)
+
+	// следующую задачу горутина сразу не берет
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.NoError(err)
+	suite.False(found)
+}
+
+func (suite *WorkerTestSuite) TestAccrualSystemError() {
+	errAccrual := errors.New("connection refused")
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, errAccrual)
+	// задача не должна остаться арендованной
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(1)).
+		Times(1).
+		Return(nil)
+
+	suite.ErrorIs(suite.processNext(), errAccrual)
+}
+
+// задача, обработка которой не уложилась в TaskTimeout, возвращается в
+// очередь уже без контекста задачи
+func (suite *WorkerTestSuite) TestReleaseAfterTimeout() {
+	suite.worker.cfg.TaskTimeout = 10 * time.Millisecond
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, orderID string) (*accrual.OrderInfo, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(1)).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, task *ordertracker.Task, statusID int) error {
+			return ctx.Err()
+		})
+
+	suite.ErrorIs(suite.processNext(), context.DeadlineExceeded)
+}
+
+func (suite *WorkerTestSuite) TestLeaseLost() {
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "18", Status: models.StatusProcessing}, nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusRegistered, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSING")).
+		Times(1).
+		Return(nil)
+	// аренду забрал другой воркер - повторно отпускать задачу нельзя
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(ordertracker.ErrLeaseLost)
+
+	suite.ErrorIs(suite.processNext(), ordertracker.ErrLeaseLost)
+}
+
+func (suite *WorkerTestSuite) TestStartStop() {
+	suite.expectNotifications()
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil, nil)
+	suite.accrualService.EXPECT().
+		WaitAvailable(gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	suite.worker.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		suite.worker.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.Fail("workers did not stop")
+	}
+}
+
+func (suite *WorkerTestSuite) TestStopOnContextCancel() {
+	suite.expectNotifications()
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.worker.Start(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		suite.worker.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.Fail("workers did not stop after context cancel")
+	}
+}
+
+func (suite *WorkerTestSuite) TestBatchParallelism() {
+	const batch = 6
+	suite.worker.cfg.BatchSize = batch
+	suite.worker.cfg.Parallelism = 2
+	tasks := make([]*ordertracker.Task, 0, batch)
+	for i := 0; i < batch; i++ {
+		tasks = append(tasks, &ordertracker.Task{OrderID: fmt.Sprint(i), StatusID: 1, Owner: "test"})
+	}
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Eq(batch)).
+		Times(1).
+		Return(tasks, nil)
+	var running, maxRunning atomic.Int32
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Any()).
+		Times(batch).
+		DoAndReturn(func(ctx context.Context, orderID string) (*accrual.OrderInfo, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return &accrual.OrderInfo{Order: orderID, Status: models.StatusProcessing}, nil
+		})
+	suite.expectTransaction(batch)
+	suite.db.EXPECT().
+		LockOrderStatus(gomock.Any(), gomock.Any()).
+		Times(batch).
+		Return(models.StatusRegistered, nil)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Any(), gomock.Eq("PROCESSING")).
+		Times(batch).
+		Return(nil)
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(database.STATUSES["PROCESSING"])).
+		Times(batch).
+		Return(nil)
+
+	suite.NoError(suite.processNext())
+	suite.Equal(int32(2), maxRunning.Load())
+}
+
+func (suite *WorkerTestSuite) TestBatchPerTaskRelease() {
+	errAccrual := errors.New("connection refused")
+	suite.worker.cfg.BatchSize = 2
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Eq(2)).
+		Times(1).
+		Return([]*ordertracker.Task{
+			{OrderID: "18", StatusID: 1, Owner: "test"},
+			{OrderID: "26", StatusID: 2, Owner: "test"},
+		}, nil)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		Return(nil, errAccrual)
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("26")).
+		Times(1).
+		Return(&accrual.OrderInfo{Order: "26", Status: models.StatusInvalid}, nil)
+	// неудача одной задачи не мешает остальным
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(
+			gomock.Any(),
+			gomock.Eq(&ordertracker.Task{OrderID: "18", StatusID: 1, Owner: "test"}),
+			gomock.Eq(1),
+		).
+		Times(1).
+		Return(nil)
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("26", models.StatusProcessing, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("26"), gomock.Eq("INVALID")).
+		Times(1).
+		Return(nil)
+	suite.tracker.EXPECT().
+		Delete(gomock.Any(), gomock.Eq("26")).
+		Times(1).
+		Return(nil)
+
+	suite.ErrorIs(suite.processNext(), errAccrual)
+}
+
+func (suite *WorkerTestSuite) TestLeaseTooShort() {
+	suite.worker.cfg.LeaseDuration = suite.worker.cfg.TaskTimeout
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Eq("test"), gomock.Any()).
+		Times(1).
+		Return([]*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: "test"}}, nil)
+	// не успеем обработать до конца аренды - отпускаем без попытки
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Any()).
+		Times(0)
+	suite.tracker.EXPECT().
+		Release(gomock.Any(), gomock.Any(), gomock.Eq(time.Duration(0))).
+		Times(1).
+		Return(nil)
+
+	found, err := suite.worker.processNext(context.Background(), "test")
+	suite.NoError(err)
+	suite.False(found)
+}
+
+// TestLoopSurvivesErrors проверяет, что ошибки и паники при обработке
+// задач не завершают горутины воркера
+func (suite *WorkerTestSuite) TestLoopSurvivesErrors() {
+	suite.expectNotifications()
+	var calls atomic.Int32
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context, owner string, limit int) ([]*ordertracker.Task, error) {
+			if calls.Add(1)%2 == 0 {
+				panic("boom")
+			}
+			return nil, errors.New("connection reset")
+		})
+	suite.accrualService.EXPECT().
+		WaitAvailable(gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	suite.worker.Start(context.Background())
+	suite.Eventually(func() bool {
+		return calls.Load() >= 10
+	}, time.Second, 10*time.Millisecond)
+	suite.worker.Stop()
+}
+
+func (suite *WorkerTestSuite) TestAdaptiveScaling() {
+	suite.worker.cfg.Workers = 1
+	suite.worker.cfg.MinWorkers = 1
+	suite.worker.cfg.MaxWorkers = 3
+	suite.worker.cfg.ScaleInterval = 10 * time.Millisecond
+	suite.expectNotifications()
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		Return(nil, nil)
+	suite.accrualService.EXPECT().
+		WaitAvailable(gomock.Any()).
+		AnyTimes().
+		Return(nil)
+	var depth atomic.Int32
+	depth.Store(1000)
+	suite.tracker.EXPECT().
+		Depth(gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context) (int, error) {
+			return int(depth.Load()), nil
+		})
+
+	suite.worker.Start(context.Background())
+	defer suite.worker.Stop()
+	suite.Eventually(func() bool { return suite.worker.Size() == 3 }, time.Second, 5*time.Millisecond)
+	depth.Store(0)
+	suite.Eventually(func() bool { return suite.worker.Size() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+// TestScaleDownFinishesTask проверяет, что остановленная при уменьшении
+// горутина доделывает арендованную задачу
+func (suite *WorkerTestSuite) TestScaleDownFinishesTask() {
+	suite.worker.cfg.Workers = 1
+	suite.expectNotifications()
+	var acquired atomic.Bool
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context, owner string, limit int) ([]*ordertracker.Task, error) {
+			if acquired.CompareAndSwap(false, true) {
+				return []*ordertracker.Task{{OrderID: "18", StatusID: 1, Owner: owner}}, nil
+			}
+			return nil, nil
+		})
+	suite.accrualService.EXPECT().
+		WaitAvailable(gomock.Any()).
+		AnyTimes().
+		Return(nil)
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	suite.accrualService.EXPECT().
+		GetOrderInfo(gomock.Any(), gomock.Eq("18")).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, orderID string) (*accrual.OrderInfo, error) {
+			close(started)
+			<-proceed
+			return &accrual.OrderInfo{Order: "18", Status: models.StatusProcessing}, nil
+		})
+	suite.expectTransaction(1)
+	suite.expectLockedStatus("18", models.StatusRegistered, 1)
+	suite.db.EXPECT().
+		UpdateOrderStatus(gomock.Any(), gomock.Eq("18"), gomock.Eq("PROCESSING")).
+		Times(1).
+		Return(nil)
+	released := make(chan struct{})
+	suite.tracker.EXPECT().
+		UpdateStatusAndRelease(gomock.Any(), gomock.Any(), gomock.Eq(database.STATUSES["PROCESSING"])).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, task *ordertracker.Task, statusID int) error {
+			close(released)
+			return nil
+		})
+
+	ctx := context.Background()
+	suite.worker.Start(ctx)
+	defer suite.worker.Stop()
+	<-started
+	suite.worker.resize(ctx, 0)
+	suite.Equal(0, suite.worker.Size())
+	close(proceed)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		suite.Fail("task was abandoned on scale down")
+	}
+}
+
+func (suite *WorkerTestSuite) TestWakeOnNotification() {
+	// таймер не сработает за время теста - разбудить может только уведомление
+	suite.worker.cfg.PollInterval = time.Hour
+	notify := suite.expectNotifications()
+	acquired := make(chan struct{}, 10)
+	suite.tracker.EXPECT().
+		AcquireBatch(gomock.Any(), gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(ctx context.Context, owner string, limit int) ([]*ordertracker.Task, error) {
+			acquired <- struct{}{}
+			return nil, nil
+		})
+	suite.accrualService.EXPECT().
+		WaitAvailable(gomock.Any()).
+		AnyTimes().
+		Return(nil)
+
+	suite.worker.Start(context.Background())
+	defer suite.worker.Stop()
+	select {
+	case <-acquired:
+		suite.Fail("worker polled without notification")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	notify <- struct{}{}
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		suite.Fail("worker was not woken by notification")
+	}
+}
+
+func TestWorkerTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerTestSuite))
+}